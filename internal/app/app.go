@@ -1,21 +1,60 @@
 package app
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"database/sql"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"io"
 	"myoidc/internal/config"
 	"myoidc/internal/handler/http"
+	"myoidc/internal/handler/http/admin"
+	"myoidc/internal/handler/http/auth"
+	"myoidc/internal/handler/http/authz"
+	"myoidc/internal/handler/http/csrf"
+	"myoidc/internal/handler/http/forwardauth"
 	"myoidc/internal/handler/http/oidc"
+	"myoidc/internal/handler/http/proxy"
+	"myoidc/internal/service/identity"
 	oidccli "myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/client/mapping"
 	"myoidc/internal/service/oidc/client/oauth0"
+	"myoidc/internal/service/oidc/client/preset"
 	"myoidc/internal/service/oidc/pkce"
+	"myoidc/internal/service/oidc/transaction"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/encrypted"
+	"myoidc/internal/service/session/event"
 	"myoidc/internal/service/session/inmemory"
+	"myoidc/internal/service/session/limit"
+	sessredis "myoidc/internal/service/session/redis"
+	"myoidc/internal/service/session/sqldb"
+	"myoidc/internal/service/session/stateless"
+	admin_sessions "myoidc/internal/usecase/admin/sessions"
+	csrf_uc "myoidc/internal/usecase/csrf"
 	oidc_callback "myoidc/internal/usecase/oidc/callback"
 	oidc_login "myoidc/internal/usecase/oidc/login"
+	oidc_logout "myoidc/internal/usecase/oidc/logout"
 	oidc_userinfo "myoidc/internal/usecase/oidc/userinfo"
 	"myoidc/pkg/errors"
+	"myoidc/pkg/httpclient"
+	"myoidc/pkg/keyring"
 	"myoidc/pkg/log"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 func init() {
@@ -23,23 +62,110 @@ func init() {
 		log.LogrusFormatter(&logrus.TextFormatter{DisableQuote: true}),
 	))
 	oidccli.RegisterUnmarshaler("oauth0", &oauth0.OAuth0Unmarshaler{})
+
+	oidccli.RegisterPreset(preset.GitHub, preset.NewGitHubClient)
+	oidccli.RegisterUnmarshaler(preset.GitHub, preset.GitHubUnmarshaler)
+	oidccli.RegisterPreset(preset.GitLab, preset.NewGitLabClient)
+	oidccli.RegisterUnmarshaler(preset.GitLab, preset.GitLabUnmarshaler)
+	oidccli.RegisterPreset(preset.Google, preset.NewGoogleClient)
+	oidccli.RegisterUnmarshaler(preset.Google, preset.GoogleUnmarshaler)
+	oidccli.RegisterPreset(preset.Entra, preset.NewEntraClient)
+	oidccli.RegisterUnmarshaler(preset.Entra, preset.EntraUnmarshaler)
+	oidccli.RegisterPreset(preset.Keycloak, preset.NewKeycloakClient)
+	oidccli.RegisterUnmarshaler(preset.Keycloak, preset.KeycloakUnmarshaler)
 }
 
 type App struct {
-	cfg *config.Config
-	r   *fiber.App
-	l   log.Logger
+	cfg     *config.Config
+	r       *fiber.App
+	l       log.Logger
+	closers []io.Closer
+	// proxy serves requests in proxy mode, fiber app is its fallback.
+	proxy nethttp.Handler
 }
 
+// Run serves http until SIGINT or SIGTERM and then shuts down gracefully.
 func (app App) Run() {
-	err := app.r.Listen("0.0.0.0:8080")
+	const addr = "0.0.0.0:8080"
+	listen := func() error {
+		return app.r.Listen(addr)
+	}
+	shutdown := func() error {
+		return app.r.ShutdownWithTimeout(10 * time.Second)
+	}
+	if app.proxy != nil {
+		// net/http streams bodies and upgrades WebSocket connections of upstreams
+		srv := &nethttp.Server{Addr: addr, Handler: app.proxy}
+		listen = func() error {
+			err := srv.ListenAndServe()
+			if err == nethttp.ErrServerClosed {
+				return nil
+			}
+			return err
+		}
+		shutdown = func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return srv.Shutdown(ctx)
+		}
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		app.l.Info("shutting down")
+		err := shutdown()
+		if err != nil {
+			app.l.WithError(err).Error("failed to shutdown http server")
+		}
+	}()
+
+	err := listen()
 	if err != nil {
 		app.l.WithError(err).Fatal("failed to start http server")
 	}
+
+	for i := len(app.closers) - 1; i >= 0; i-- {
+		err = app.closers[i].Close()
+		if err != nil {
+			app.l.WithError(err).Error("failed to release resources")
+		}
+	}
+}
+
+// Option customizes the app built by Setup.
+type Option func(o *options)
+
+type options struct {
+	observers []func(d *event.Dispatcher)
+}
+
+// WithSessionObserver subscribes obs to session events, it is called on the request path.
+func WithSessionObserver(obs event.Observer) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, func(d *event.Dispatcher) {
+			d.Subscribe(obs)
+		})
+	}
+}
+
+// WithAsyncSessionObserver subscribes obs to session events delivered in background,
+// events are dropped when more than buffer events are queued.
+func WithAsyncSessionObserver(obs event.Observer, buffer int) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, func(d *event.Dispatcher) {
+			d.SubscribeAsync(obs, buffer)
+		})
+	}
 }
 
-func Setup() *App {
+func Setup(opts ...Option) *App {
 	l := log.GetDefault()
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
 
 	// load configs
 	cfg := config.NewConfig()
@@ -49,18 +175,50 @@ func Setup() *App {
 	}
 
 	// setup services
-	sm := inmemory.NewManager()
+	sm, tombstones, smCloser, err := buildSessionManager(cfg.Session, l)
+	if err != nil {
+		l.WithError(err).Fatal("session store setup error")
+	}
+	sm, err = buildSessionEncryption(cfg.Session, sm)
+	if err != nil {
+		l.WithError(err).Fatal("session encryption setup error")
+	}
+	events := event.NewDispatcher()
+	for _, subscribe := range o.observers {
+		subscribe(events)
+	}
+	sm = event.NewManager(sm, events)
+	sm, err = buildSessionLimits(cfg, sm, tombstones)
+	if err != nil {
+		l.WithError(err).Fatal("session limits setup error")
+	}
 	reg, err := buildOidcClientRegistry(cfg)
 	if err != nil {
 		l.WithError(err).Fatal("oidc setup error")
 	}
 
+	txs, err := buildTransactionStore(cfg.Session, sm)
+	if err != nil {
+		l.WithError(err).Fatal("login transactions setup error")
+	}
+
 	// setup use cases
-	oidcLoginUseCase := oidc_login.NewUseCase(reg, sm)
-	oidcCallbackUseCase := oidc_callback.NewUseCase(reg, sm)
-	oidcUserInfoUseCase := oidc_userinfo.NewUseCase(reg, sm)
+	oidcLoginUseCase := oidc_login.NewUseCase(reg, txs, events)
+	oidcCallbackUseCase := oidc_callback.NewUseCase(reg, sm, txs, events)
+	oidcUserInfoUseCase := oidc_userinfo.NewUseCase(reg, sm, events, cfg.Session.UserInfoTTL)
+	oidcLogoutUseCase := oidc_logout.NewUseCase(sm)
 
 	// setup http handlers
+	signer, err := buildCookieSigner(cfg.Session, l)
+	if err != nil {
+		l.WithError(err).Fatal("session cookie setup error")
+	}
+	policy, err := buildCookiePolicy(cfg)
+	if err != nil {
+		l.WithError(err).Fatal("session cookie setup error")
+	}
+	sessCookie := http.NewSessionCookie(cfg.Cookie.Name, policy, signer)
+	txCookie := http.NewTransactionCookie(policy, signer, cfg.Session.TempTTL)
 	r := fiber.New(fiber.Config{AppName: "myoidc"})
 	r.Use(recover.New(recover.Config{
 		EnableStackTrace: true,
@@ -69,26 +227,446 @@ func Setup() *App {
 			l.WithError(err).Errorf("unhandled error on %s", c.Path())
 		},
 	}))
-	r.Get("/oauth/login", oidc.NewLoginHandler(oidcLoginUseCase, l).Handler())
-	r.Get("/oauth/callback", oidc.NewCallbackHandler(oidcCallbackUseCase, l).Handler())
-	r.Get("/oauth/userinfo", oidc.NewUserInfoHandler(oidcUserInfoUseCase, l).Handler())
-
-	r.Get("/*", func(c *fiber.Ctx) error {
-		sessId := http.GetCookie(c, http.CookieSessionId)
-		if sessId != "" {
-			return c.Redirect("/oauth/userinfo")
-		} else {
-			return c.Redirect("/oauth/login?providerName=myoidc")
+	var protection *csrf.Protection
+	if cfg.CSRF.Mode != "off" {
+		protection, err = buildCSRFProtection(cfg, csrf_uc.NewUseCase(sm), sessCookie, l)
+		if err != nil {
+			l.WithError(err).Fatal("csrf setup error")
 		}
+		r.Use(protection.Middleware())
+		r.Get("/oauth/csrf", protection.TokenHandler())
+	}
+	r.Get("/oauth/login", oidc.NewLoginHandler(oidcLoginUseCase, txCookie, cfg.ForwardAuth.RedirectHosts, l).Handler())
+	r.Get("/oauth/callback", oidc.NewCallbackHandler(oidcCallbackUseCase, sessCookie, txCookie, l).Handler())
+	r.Get("/oauth/userinfo", oidc.NewUserInfoHandler(oidcUserInfoUseCase, sessCookie, l).Handler())
+	r.Post("/oauth/logout", oidc.NewLogoutHandler(oidcLogoutUseCase, sessCookie, l).Handler())
+
+	if cfg.Admin.Token != "" {
+		adminRouter := r.Group("/admin", admin.NewBearerAuth(cfg.Admin.Token))
+		admin.NewSessionsHandler(admin_sessions.NewUseCase(sm), l).Register(adminRouter)
+	}
+
+	requireAuth := auth.NewRequireAuth(auth.Config{
+		ProviderName: loginProvider(cfg),
+	}, oidcUserInfoUseCase, sessCookie, l)
+	rules, err := buildAuthorizationRules(cfg.Authorization, l)
+	if err != nil {
+		l.WithError(err).Fatal("authorization setup error")
+	}
+	issuer, err := buildIdentityTokenIssuer(cfg)
+	if err != nil {
+		l.WithError(err).Fatal("identity token setup error")
+	}
+	forwardAuth, err := forwardauth.New(forwardauth.Config{
+		BaseURL:           cfg.Domain,
+		HeaderPrefix:      cfg.Proxy.HeaderPrefix,
+		PassAccessToken:   cfg.ForwardAuth.PassAccessToken,
+		PassIdentityToken: cfg.ForwardAuth.PassIdentityToken,
+	}, requireAuth, rules, issuer, l)
+	if err != nil {
+		l.WithError(err).Fatal("forward auth setup error")
+	}
+	r.All("/oauth/auth", forwardAuth.Handler())
+	r.All(forwardauth.ExtAuthzPrefix+"/*", forwardAuth.ExtAuthzHandler())
+
+	r.Get("/*", requireAuth.Handler(), rules.Handler(), func(c *fiber.Ctx) error {
+		return c.Redirect("/oauth/userinfo")
 	})
 
-	return &App{cfg, r, l}
+	var proxyHandler nethttp.Handler
+	if len(cfg.Proxy.Routes) > 0 {
+		proxyHandler, err = buildProxy(cfg, requireAuth, protection, rules, sessCookie, issuer, adaptor.FiberApp(r), l)
+		if err != nil {
+			l.WithError(err).Fatal("proxy setup error")
+		}
+	}
+
+	return &App{cfg, r, l, []io.Closer{smCloser, events}, proxyHandler}
+}
+
+// buildProxy forwards proxy routes and passes other requests to next handler.
+func buildProxy(
+	cfg *config.Config,
+	requireAuth *auth.RequireAuth,
+	protection *csrf.Protection,
+	rules *authz.Rules,
+	sessCookie *http.SessionCookie,
+	issuer *identity.TokenIssuer,
+	next nethttp.Handler,
+	l log.Logger,
+) (*proxy.Proxy, error) {
+	routes := make([]proxy.Route, 0, len(cfg.Proxy.Routes))
+	for i, r := range cfg.Proxy.Routes {
+		if r.Path == "/*" || strings.HasPrefix(r.Path, "/oauth/") || strings.HasPrefix(r.Path, "/admin") {
+			return nil, errors.Errorf("proxy route [%d] path \"%s\" overlaps myoidc routes", i, r.Path)
+		}
+		upstream, err := url.Parse(r.Upstream)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy route [%d] upstream", i)
+		}
+		routes = append(routes, proxy.Route{
+			Path:              r.Path,
+			Upstream:          upstream,
+			StripPrefix:       r.StripPrefix,
+			PassAccessToken:   r.PassAccessToken,
+			PassIdentityToken: r.PassIdentityToken,
+		})
+	}
+
+	return proxy.New(proxy.Config{
+		Routes:       routes,
+		HeaderPrefix: cfg.Proxy.HeaderPrefix,
+	}, requireAuth, protection, rules, sessCookie, issuer, next, l)
+}
+
+// buildIdentityTokenIssuer returns nil if identity token keys are not configured.
+func buildIdentityTokenIssuer(cfg *config.Config) (*identity.TokenIssuer, error) {
+	if len(cfg.Proxy.IdentityToken.Keys) == 0 {
+		return nil, nil
+	}
+	active, keys, err := parseKeys(cfg.Proxy.IdentityToken.ActiveKey, cfg.Proxy.IdentityToken.Keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid identity token keys")
+	}
+	for _, key := range keys {
+		if key.Id == active {
+			return identity.NewTokenIssuer(key, cfg.Domain, cfg.Proxy.IdentityToken.TTL)
+		}
+	}
+	return nil, errors.Errorf("active identity token key \"%s\" not found", active)
+}
+
+// loginProvider returns the provider of login started by protected routes.
+func loginProvider(cfg *config.Config) string {
+	if cfg.LoginProvider != "" || len(cfg.OidcClients) == 0 {
+		return cfg.LoginProvider
+	}
+	return cfg.OidcClients[0].ProviderName
+}
+
+func buildAuthorizationRules(cfg config.AuthorizationConfig, l log.Logger) (*authz.Rules, error) {
+	rules := make([]authz.Rule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		rules = append(rules, authz.Rule{
+			Path:       r.Path,
+			IgnoreCase: r.IgnoreCase,
+			Methods:    r.Methods,
+			Provider:   r.Provider,
+			Requirement: authz.Requirement{
+				AllOf: r.AllOf,
+				AnyOf: r.AnyOf,
+			},
+		})
+	}
+	return authz.NewRules(rules, l)
+}
+
+// buildSessionManager returns the store with tombstones of evicted sessions kept by the same backend.
+func buildSessionManager(cfg config.SessionConfig, l log.Logger) (session.Manager, limit.Tombstones, io.Closer, error) {
+	lifetime := session.Lifetime{
+		TempTTL:     cfg.TempTTL,
+		IdleTimeout: cfg.IdleTimeout,
+		AbsoluteTTL: cfg.AbsoluteTTL,
+	}
+
+	switch cfg.Store {
+	case "memory":
+		sm, closer, err := buildMemorySessionManager(cfg, lifetime, l)
+		return sm, limit.NewMemoryTombstones(), closer, err
+	case "redis":
+		rdb := buildRedisClient(cfg.Redis)
+		prefix := cfg.Redis.Prefix
+		if prefix == "" {
+			prefix = sessredis.DefaultPrefix
+		}
+		sm := sessredis.NewManager(rdb, session.WithLifetime(lifetime), sessredis.WithPrefix(prefix))
+		return sm, limit.NewRedisTombstones(rdb, prefix), rdb, nil
+	case sqldb.Postgres, sqldb.SQLite:
+		return buildSQLSessionManager(cfg, lifetime, l)
+	case "cookie":
+		// sessions are not listed, so limits are not supported
+		sm, closer, err := buildStatelessSessionManager(cfg, lifetime)
+		return sm, nil, closer, err
+	default:
+		return nil, nil, nil, errors.Errorf("unknown session store \"%s\"", cfg.Store)
+	}
+}
+
+func buildTransactionStore(cfg config.SessionConfig, sm session.Manager) (transaction.Store, error) {
+	switch cfg.Transactions.Store {
+	case "session":
+		return transaction.NewSessionStore(sm), nil
+	case "sealed":
+		keys, err := buildKeyRing(cfg.Transactions.ActiveKey, cfg.Transactions.Keys)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid login transaction keys")
+		}
+		return transaction.NewSealedStore(keys, cfg.TempTTL), nil
+	default:
+		return nil, errors.Errorf("unknown login transaction store \"%s\"", cfg.Transactions.Store)
+	}
+}
+
+// buildSessionEncryption wraps the manager if token encryption keys are configured.
+func buildSessionEncryption(cfg config.SessionConfig, sm session.Manager) (session.Manager, error) {
+	if len(cfg.Encryption.Keys) == 0 {
+		return sm, nil
+	}
+	if cfg.Store == "cookie" {
+		return nil, errors.Error("cookie session store is encrypted by cookie keys")
+	}
+	keys, err := buildKeyRing(cfg.Encryption.ActiveKey, cfg.Encryption.Keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid session encryption keys")
+	}
+	return encrypted.NewManager(sm, keys), nil
+}
+
+// buildSessionLimits wraps the manager if any provider limits sessions. Eviction reasons are
+// kept by tombstones of the session store.
+func buildSessionLimits(cfg *config.Config, sm session.Manager, tombstones limit.Tombstones) (session.Manager, error) {
+	policies := make(map[string]limit.Policy)
+	for _, conf := range cfg.OidcClients {
+		if conf.SessionLimit.Max <= 0 {
+			continue
+		}
+		policy := conf.SessionLimit.Policy
+		if policy == "" {
+			policy = limit.PolicyReject
+		}
+		policies[conf.ProviderName] = limit.Policy{Max: conf.SessionLimit.Max, Policy: policy}
+	}
+	if len(policies) == 0 {
+		return sm, nil
+	}
+	if tombstones == nil {
+		return nil, errors.Errorf("session limits are not supported by %s session store", cfg.Session.Store)
+	}
+	return limit.NewManager(sm, policies, tombstones)
+}
+
+func buildRedisClient(cfg config.RedisConfig) *goredis.Client {
+	opts := &goredis.Options{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	}
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return goredis.NewClient(opts)
+}
+
+func buildStatelessSessionManager(cfg config.SessionConfig, lifetime session.Lifetime) (session.Manager, io.Closer, error) {
+	keys, err := buildKeyRing(cfg.Cookie.ActiveKey, cfg.Cookie.Keys)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid cookie session keys")
+	}
+
+	opts := []session.Option{session.WithLifetime(lifetime)}
+	var closer io.Closer = closerFunc(func() error { return nil })
+	switch cfg.Cookie.Revocation {
+	case "":
+	case "memory":
+		opts = append(opts, stateless.WithRevocationList(stateless.NewMemoryRevocationList()))
+	case "redis":
+		rdb := buildRedisClient(cfg.Redis)
+		prefix := cfg.Redis.Prefix
+		if prefix == "" {
+			prefix = sessredis.DefaultPrefix
+		}
+		opts = append(opts, stateless.WithRevocationList(stateless.NewRedisRevocationList(rdb, prefix)))
+		closer = rdb
+	default:
+		return nil, nil, errors.Errorf("unknown session revocation list \"%s\"", cfg.Cookie.Revocation)
+	}
+	return stateless.NewManager(keys, opts...), closer, nil
+}
+
+func buildKeyRing(active string, cfg []config.KeyConfig) (*keyring.KeyRing, error) {
+	active, keys, err := parseKeys(active, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.New(active, keys...)
+}
+
+func buildCookiePolicy(cfg *config.Config) (http.CookiePolicy, error) {
+	policy := http.DefaultCookiePolicy()
+	policy.Domain = cfg.Cookie.Domain
+	policy.SameSite = strings.ToLower(cfg.Cookie.SameSite)
+	switch cfg.Cookie.Secure {
+	case "auto":
+		policy.Secure = strings.HasPrefix(cfg.Domain, "https://")
+	case "always":
+		policy.Secure = true
+	case "never":
+	default:
+		return policy, errors.Errorf("unknown cookie Secure mode \"%s\"", cfg.Cookie.Secure)
+	}
+	if cfg.Cookie.Persistent {
+		policy.MaxAge = cfg.Session.AbsoluteTTL
+		if policy.MaxAge == 0 {
+			if cfg.Session.Store != "cookie" {
+				// stored session cookies are reissued only on login, so they would die IdleTimeout after it
+				return policy, errors.Error("persistent cookie requires Session.AbsoluteTTL unless \"cookie\" session store is used")
+			}
+			policy.MaxAge = cfg.Session.IdleTimeout
+		}
+	}
+	return policy, policy.Validate(cfg.Cookie.Name)
+}
+
+// buildCSRFProtection allows requests from Domain origin and trusted origins, forward auth
+// requests are not checked.
+func buildCSRFProtection(cfg *config.Config, uc *csrf_uc.UseCase, sessCookie *http.SessionCookie, l log.Logger) (*csrf.Protection, error) {
+	if cfg.CSRF.Mode == csrf.ModeDoubleSubmit && cfg.Session.Store == "cookie" {
+		// double submit tokens are bound to the session id, which cookie store reissues on access
+		return nil, errors.Error("double submit csrf mode doesn't support \"cookie\" session store, use synchronizer mode")
+	}
+	origins := append([]string{}, cfg.CSRF.TrustedOrigins...)
+	if u, err := url.Parse(cfg.Domain); err == nil && u.Host != "" {
+		origins = append(origins, u.Scheme+"://"+u.Host)
+	}
+	// auth subrequests carry the method of the protected request
+	exempt := append([]string{"/oauth/auth", forwardauth.ExtAuthzPrefix + "/*"}, cfg.CSRF.Exempt...)
+	return csrf.New(csrf.Config{
+		Mode:    cfg.CSRF.Mode,
+		Origins: origins,
+		Exempt:  exempt,
+	}, uc, sessCookie, l)
+}
+
+func buildCookieSigner(sessCfg config.SessionConfig, l log.Logger) (*keyring.Signer, error) {
+	cfg := sessCfg.Signing
+	if len(cfg.Keys) == 0 {
+		switch {
+		case !cfg.AllowRandomKey:
+			return nil, errors.Error("session cookie signing keys are not configured, set Session.Signing.Keys or AllowRandomKey for development")
+		case sessCfg.Store != "memory" && sessCfg.Store != "sqlite":
+			return nil, errors.Errorf("session cookie signing keys are required by shared session store \"%s\"", sessCfg.Store)
+		case sessCfg.Transactions.Store == "sealed":
+			return nil, errors.Error("session cookie signing keys are required by sealed login transactions")
+		}
+		l.Warn("session cookie signing keys are not configured, random key is used, sessions don't survive restart")
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate signing key")
+		}
+		return keyring.NewSigner("random", keyring.Key{Id: "random", Secret: secret})
+	}
+
+	active, keys, err := parseKeys(cfg.ActiveKey, cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.NewSigner(active, keys...)
+}
+
+// parseKeys uses the first key as active unless active key id is set.
+func parseKeys(active string, cfg []config.KeyConfig) (string, []keyring.Key, error) {
+	if len(cfg) == 0 {
+		return "", nil, errors.Error("no keys configured")
+	}
+	if active == "" {
+		active = cfg[0].Id
+	}
+	keys := make([]keyring.Key, 0, len(cfg))
+	for _, keyCfg := range cfg {
+		secret := keyCfg.Secret
+		if secret == "" && keyCfg.File != "" {
+			b, err := os.ReadFile(keyCfg.File)
+			if err != nil {
+				return "", nil, errors.Wrapf(err, "failed to read key %s", keyCfg.Id)
+			}
+			secret = strings.TrimSpace(string(b))
+		}
+		key, err := keyring.ParseKey(keyCfg.Id, secret)
+		if err != nil {
+			return "", nil, err
+		}
+		keys = append(keys, key)
+	}
+	return active, keys, nil
+}
+
+func buildMemorySessionManager(cfg config.SessionConfig, lifetime session.Lifetime, l log.Logger) (session.Manager, io.Closer, error) {
+	opts := []session.Option{
+		session.WithLifetime(lifetime),
+		session.WithCleanupInterval(cfg.CleanupInterval),
+		session.WithLogger(l),
+	}
+	if cfg.Snapshot.File != "" {
+		keys, err := buildKeyRing(cfg.Snapshot.ActiveKey, cfg.Snapshot.Keys)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "invalid session snapshot keys")
+		}
+		opts = append(opts, inmemory.WithSnapshot(cfg.Snapshot.File, cfg.Snapshot.Interval, keys))
+	}
+
+	sm := inmemory.NewManager(opts...)
+	if cfg.Snapshot.File != "" {
+		count, err := sm.RestoreSnapshot()
+		if err != nil {
+			// not closed, Close would overwrite the snapshot with empty store
+			return nil, nil, err
+		}
+		l.Infof("restored %d sessions from snapshot", count)
+	}
+	return sm, sm, nil
+}
+
+func buildSQLSessionManager(cfg config.SessionConfig, lifetime session.Lifetime, l log.Logger) (session.Manager, limit.Tombstones, io.Closer, error) {
+	dialect, err := sqldb.NewDialect(cfg.Store)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	driver := "pgx"
+	if cfg.Store == sqldb.SQLite {
+		driver = "sqlite"
+	}
+	db, err := sql.Open(driver, cfg.SQL.DSN)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to open session database")
+	}
+	if cfg.SQL.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.SQL.MaxOpenConns)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err = sqldb.Migrate(ctx, db, dialect); err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+
+	sm := sqldb.NewManager(db, dialect,
+		session.WithLifetime(lifetime),
+		session.WithCleanupInterval(cfg.CleanupInterval),
+		session.WithLogger(l),
+	)
+	return sm, sqldb.NewTombstones(db, dialect), closerFunc(func() error {
+		sm.Close()
+		return db.Close()
+	}), nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
 }
 
 func buildOidcClientRegistry(cfg *config.Config) (oidccli.ClientRegistry, error) {
 	oidcClientConfigs := make(map[string]oidccli.ClientConfig)
 	for i, conf := range cfg.OidcClients {
+		if conf.Preset != "" && conf.UserInfoUnmarshaler == "" {
+			conf.UserInfoUnmarshaler = conf.Preset
+		}
 		cli := oidccli.ClientConfig{
+			Preset:              conf.Preset,
 			ClientId:            conf.ClientId,
 			AuthUrl:             conf.AuthUrl,
 			TokenUrl:            conf.TokenUrl,
@@ -97,10 +675,26 @@ func buildOidcClientRegistry(cfg *config.Config) (oidccli.ClientRegistry, error)
 			UsePKCE:             conf.UsePKCE,
 			UseState:            conf.UseState,
 			RedirectUrl:         cfg.Domain + "/oauth/callback?providerName=" + conf.ProviderName,
-			DisableSslVerify:    cfg.DisableTLSVerify,
 			UserInfoUnmarshaler: conf.UserInfoUnmarshaler,
+			Scopes:              conf.Scopes,
+			BaseUrl:             conf.BaseUrl,
+			Tenant:              conf.Tenant,
+			AllowedTenants:      conf.AllowedTenants,
+			Realm:               conf.Realm,
+			HostedDomain:        conf.HostedDomain,
+			UserInfoRequest: oidccli.UserInfoRequestConfig{
+				Method:         conf.UserInfoRequest.Method,
+				TokenPlacement: conf.UserInfoRequest.TokenPlacement,
+				Headers:        conf.UserInfoRequest.Headers,
+				Accept:         conf.UserInfoRequest.Accept,
+			},
 		}
 		var err error
+		cli.HttpClient, err = buildHttpClient(conf.Http, cfg.DisableTLSVerify)
+		if err != nil {
+			err = errors.Wrapf(err, "invalid http config for oidc provider [%d] \"%s\"", i, conf.ProviderName)
+			return nil, err
+		}
 		cli.PKCEGenerator, err = pkce.NewPKCEGenerator(
 			conf.PKCEMethod,
 			conf.StateLength,
@@ -110,6 +704,20 @@ func buildOidcClientRegistry(cfg *config.Config) (oidccli.ClientRegistry, error)
 			err = errors.Wrapf(err, "invalid pkce config for oidc provider [%d] \"%s\"", i, conf.ProviderName)
 			return nil, err
 		}
+		if conf.UserInfoUnmarshaler == mapping.Name {
+			cli.Unmarshaler, err = mapping.NewMappingUnmarshaler(buildClaimMapping(conf.ClaimMapping))
+			if err != nil {
+				err = errors.Wrapf(err, "invalid claim mapping for oidc provider [%d] \"%s\"", i, conf.ProviderName)
+				return nil, err
+			}
+		}
+		if len(conf.Permissions.Rules) > 0 {
+			cli.Unmarshaler, err = buildPermissionsUnmarshaler(cli, conf.Permissions)
+			if err != nil {
+				err = errors.Wrapf(err, "invalid permissions mapping for oidc provider [%d] \"%s\"", i, conf.ProviderName)
+				return nil, err
+			}
+		}
 		oidcClientConfigs[conf.ProviderName] = cli
 	}
 
@@ -119,3 +727,77 @@ func buildOidcClientRegistry(cfg *config.Config) (oidccli.ClientRegistry, error)
 
 	return oidccli.NewGenericClientRegistry(oidcClientConfigs)
 }
+
+func buildHttpClient(cfg config.HttpClientConfig, disableTLSVerify bool) (*nethttp.Client, error) {
+	return httpclient.New(httpclient.Config{
+		Timeout:             cfg.Timeout,
+		ConnectTimeout:      cfg.ConnectTimeout,
+		Proxy:               cfg.Proxy,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		CABundles:           cfg.CABundles,
+		InsecureSkipVerify:  cfg.InsecureSkipVerify || disableTLSVerify,
+		Retry: httpclient.RetryConfig{
+			MaxAttempts:    cfg.Retry.MaxAttempts,
+			InitialBackoff: cfg.Retry.InitialBackoff,
+			MaxBackoff:     cfg.Retry.MaxBackoff,
+		},
+		CircuitBreaker: httpclient.CircuitBreakerConfig{
+			Disabled:         cfg.CircuitBreaker.Disabled,
+			FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+			OpenTimeout:      cfg.CircuitBreaker.OpenTimeout,
+		},
+	})
+}
+
+func buildClaimMapping(cfg config.ClaimMappingConfig) mapping.Config {
+	rule := func(r config.ClaimRuleConfig) mapping.RuleConfig {
+		return mapping.RuleConfig{
+			Claims:     r.Claims,
+			Transforms: r.Transforms,
+			Join:       r.Join,
+		}
+	}
+	return mapping.Config{
+		Id:        rule(cfg.Id),
+		Login:     rule(cfg.Login),
+		Email:     rule(cfg.Email),
+		FullName:  rule(cfg.FullName),
+		FirstName: rule(cfg.FirstName),
+		LastName:  rule(cfg.LastName),
+	}
+}
+
+func buildPermissionsUnmarshaler(cli oidccli.ClientConfig, cfg config.PermissionsConfig) (oidccli.UserInfoUnmarshaler, error) {
+	base := cli.Unmarshaler
+	if base == nil {
+		var err error
+		base, err = oidccli.GetUnmarshaler(cli.UserInfoUnmarshaler)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mapperCfg := mapping.PermissionsConfig{OnlyMapped: cfg.OnlyMapped}
+	for _, r := range cfg.Rules {
+		mapperCfg.Rules = append(mapperCfg.Rules, mapping.PermissionRuleConfig{
+			Claim:     r.Claim,
+			Separator: r.Separator,
+			Format:    r.Format,
+		})
+	}
+	for _, r := range cfg.Roles {
+		mapperCfg.Roles = append(mapperCfg.Roles, mapping.RoleConfig{
+			Role:        r.Role,
+			Permissions: r.Permissions,
+		})
+	}
+	mapper, err := mapping.NewPermissionMapper(mapperCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mapping.PermissionsUnmarshaler{Base: base, Mapper: mapper}, nil
+}
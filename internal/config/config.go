@@ -3,6 +3,7 @@ package config
 import (
 	"github.com/spf13/viper"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -10,6 +11,20 @@ func init() {
 	viper.AddConfigPath(".")
 	viper.SetConfigFile("default.toml")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	viper.SetDefault("Cookie.Name", "sessId")
+	viper.SetDefault("Cookie.Secure", "auto")
+	viper.SetDefault("Cookie.SameSite", "Lax")
+	viper.SetDefault("CSRF.Mode", "double_submit")
+	viper.SetDefault("Proxy.HeaderPrefix", "X-Auth-Request-")
+	viper.SetDefault("Proxy.IdentityToken.TTL", "5m")
+	viper.SetDefault("Session.Store", "memory")
+	viper.SetDefault("Session.TempTTL", "10m")
+	viper.SetDefault("Session.IdleTimeout", "30m")
+	viper.SetDefault("Session.AbsoluteTTL", "24h")
+	viper.SetDefault("Session.CleanupInterval", "1m")
+	viper.SetDefault("Session.UserInfoTTL", "1m")
+	viper.SetDefault("Session.Transactions.Store", "session")
 }
 
 func Load(dist interface{}, opts ...viper.DecoderConfigOption) error {
@@ -25,9 +40,173 @@ func Load(dist interface{}, opts ...viper.DecoderConfigOption) error {
 }
 
 type Config struct {
-	Domain           string
+	Domain string
+	// Deprecated: use OidcClients.Http.InsecureSkipVerify or OidcClients.Http.CABundles.
 	DisableTLSVerify bool
+	Session          SessionConfig
+	Cookie           CookieConfig
+	CSRF             CSRFConfig
+	Admin            AdminConfig
+	Authorization    AuthorizationConfig
+	Proxy            ProxyConfig
+	ForwardAuth      ForwardAuthConfig
 	OidcClients      []OIDCClientConfig
+	// LoginProvider is used for browsers redirected to login by protected routes, the first
+	// OidcClients entry if empty.
+	LoginProvider string
+}
+
+// CookieConfig sets attributes of the session cookie, the login transaction cookie takes Secure from it.
+type CookieConfig struct {
+	Name     string // "__Host-" prefix requires Secure and no Domain, "__Secure-" requires Secure
+	Domain   string // parent domain shares the session with subdomains, host-only cookie if empty
+	Secure   string // "auto" (by Domain scheme), "always" or "never"
+	SameSite string // "Lax", "Strict" or "None" (requires Secure)
+	// Persistent cookie lives Session.AbsoluteTTL, otherwise the cookie is removed when the browser
+	// is closed. Only "cookie" session store, reissuing the cookie on access, may use
+	// Session.IdleTimeout without absolute limit.
+	Persistent bool
+}
+
+// CSRFConfig protects cookie authenticated POST, PUT, PATCH and DELETE requests, clients get
+// the token from GET /oauth/csrf and send it in X-CSRF-Token header.
+type CSRFConfig struct {
+	Mode           string   // "double_submit" (token in cookie, not with "cookie" session store), "synchronizer" (token in session) or "off"
+	TrustedOrigins []string // allowed in Origin and Referer besides Domain, e.g. "https://app.example.com"
+	Exempt         []string // paths, e.g. "/oauth/backchannel-logout", "/hooks/*" matches subpaths
+}
+
+// AuthorizationConfig protects routes behind login by user permissions. The first rule matching
+// request path, method and provider of the user is checked. Requests matching no rule path are
+// allowed, requests matching a rule path but excluded by methods or provider of all such rules are
+// denied, so a path-only rule must follow limited ones to let other methods or providers through.
+type AuthorizationConfig struct {
+	Rules []AuthorizationRuleConfig
+}
+
+type AuthorizationRuleConfig struct {
+	Path       string   // "/billing/*" matches subpaths, case-sensitive
+	IgnoreCase bool     // match Path case-insensitively, e.g. for upstreams serving /Admin as /admin
+	Methods    []string // all methods if empty, other methods are denied without a following rule
+	Provider   string   // users of all providers if empty, others are denied without a following rule
+	AllOf      []string // permissions required together
+	AnyOf      []string // at least one of permissions is required
+}
+
+// ProxyConfig forwards routes to upstreams without own auth after session validation, requests
+// are authorized by Authorization.Rules. Routes must not overlap /oauth/ and /admin ones.
+type ProxyConfig struct {
+	HeaderPrefix  string // identity headers prefix, e.g. "X-Auth-Request-" for "X-Auth-Request-User"
+	IdentityToken IdentityTokenConfig
+	Routes        []ProxyRouteConfig
+}
+
+type ProxyRouteConfig struct {
+	Path              string // "/app/*" matches subpaths
+	Upstream          string // e.g. "http://legacy:8080"
+	StripPrefix       bool   // "/app/page" is passed as "/page"
+	PassAccessToken   bool   // provider access token in Access-Token header
+	PassIdentityToken bool   // signed identity token in Identity header
+}
+
+// ForwardAuthConfig sets /oauth/auth for nginx auth_request and Traefik forwardAuth and
+// /oauth/ext_authz/* for Envoy ext_authz, identity headers and token are set as by Proxy.
+// Protected apps must receive the session cookie, e.g. by Cookie.Domain set to the parent domain.
+// The proxy must pass Set-Cookie of the auth reply to the client, as the "cookie" session store
+// reissues the session on access, e.g. nginx by auth_request_set and add_header Set-Cookie.
+type ForwardAuthConfig struct {
+	RedirectHosts     []string // hosts of protected apps login returns to, e.g. "app.example.com"
+	PassAccessToken   bool
+	PassIdentityToken bool
+}
+
+// IdentityTokenConfig signs HS256 JWT asserting the user to upstreams, keys must be at least 32 bytes.
+type IdentityTokenConfig struct {
+	ActiveKey string
+	Keys      []KeyConfig
+	TTL       time.Duration
+}
+
+// AdminConfig enables admin api under /admin when token is set.
+type AdminConfig struct {
+	Token string // static bearer token
+}
+
+// SessionConfig selects session store and sets session expiration, zero duration disables the limit.
+type SessionConfig struct {
+	Store           string        // "memory", "redis", "postgres", "sqlite" or "cookie"
+	TempTTL         time.Duration // login transaction lifetime
+	IdleTimeout     time.Duration
+	AbsoluteTTL     time.Duration
+	CleanupInterval time.Duration // memory and sql stores only
+	UserInfoTTL     time.Duration // user fetched from provider is kept in session for the duration, 0 fetches it on every request
+	Snapshot        SnapshotConfig
+	Redis           RedisConfig
+	SQL             SQLConfig
+	Cookie          CookieSessionConfig
+	Signing         SigningConfig
+	Encryption      EncryptionConfig
+	Transactions    TransactionConfig
+}
+
+// SnapshotConfig persists memory store to the file, restored on start, disabled without File.
+type SnapshotConfig struct {
+	File      string
+	Interval  time.Duration // the snapshot is always saved on shutdown
+	ActiveKey string        // first key by default
+	Keys      []KeyConfig   // AES keys encrypting provider tokens
+}
+
+type RedisConfig struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	Prefix   string
+	TLS      bool
+}
+
+// SQLConfig is used by "postgres" and "sqlite" session stores, schema is migrated on start.
+type SQLConfig struct {
+	DSN          string
+	MaxOpenConns int
+}
+
+// CookieSessionConfig is used by "cookie" session store keeping the whole session encrypted in the browser.
+type CookieSessionConfig struct {
+	ActiveKey  string // first key by default
+	Keys       []KeyConfig
+	Revocation string // "" disables server-side logout, "memory" or "redis" (uses Session.Redis)
+}
+
+// KeyConfig is an encryption or signing key, old keys are kept to read data until it expires.
+type KeyConfig struct {
+	Id     string
+	Secret string // base64 encoded, 16, 24 or 32 bytes for AES and at least 32 bytes for HMAC
+	File   string // file with base64 encoded secret, used when Secret is empty
+}
+
+// SigningConfig sets HMAC keys signing session cookie, keys are required unless a random key is allowed.
+type SigningConfig struct {
+	ActiveKey string // first key by default
+	Keys      []KeyConfig
+	// AllowRandomKey generates a key when Keys are empty, for development only: sessions don't
+	// survive restart. Not allowed with shared session stores and sealed login transactions.
+	AllowRandomKey bool
+}
+
+// EncryptionConfig enables encryption of provider tokens in memory, redis and sql stores,
+// disabled without keys. Sessions stored before it was enabled stay readable.
+type EncryptionConfig struct {
+	ActiveKey string // first key by default
+	Keys      []KeyConfig
+}
+
+// TransactionConfig selects where login transactions are kept between the login and the callback.
+type TransactionConfig struct {
+	Store     string // "session" (temp sessions of the session store) or "sealed" (encrypted state parameter)
+	ActiveKey string // first key by default, "sealed" only
+	Keys      []KeyConfig
 }
 
 func NewConfig() *Config {
@@ -37,6 +216,9 @@ func NewConfig() *Config {
 }
 
 type OIDCClientConfig struct {
+	// Preset is one of "github", "gitlab", "google", "entra", "keycloak" or empty for generic provider.
+	// Presets fill endpoints, scopes and unmarshaler unless they are set explicitly.
+	Preset              string
 	ProviderName        string
 	ClientId            string
 	AuthUrl             string
@@ -49,4 +231,94 @@ type OIDCClientConfig struct {
 	PKCEMethod          string
 	PKCEChallengeLength int `default:"32"`
 	UserInfoUnmarshaler string
+	ClaimMapping        ClaimMappingConfig
+	Permissions         PermissionsConfig
+	Scopes              []string
+	UserInfoRequest     UserInfoRequestConfig
+	Http                HttpClientConfig
+	SessionLimit        SessionLimitConfig
+
+	// Preset specific settings.
+	BaseUrl        string   // github (enterprise server), gitlab (self-managed), keycloak
+	Tenant         string   // entra, "common" by default
+	AllowedTenants []string // entra
+	Realm          string   // keycloak
+	HostedDomain   string   // google
+}
+
+// SessionLimitConfig limits active sessions of a user logged in with the provider, zero Max disables it.
+type SessionLimitConfig struct {
+	Max    int
+	Policy string // "reject" (default) or "evict_oldest"
+}
+
+// HttpClientConfig configures outbound calls to the provider, zero values mean defaults.
+type HttpClientConfig struct {
+	Timeout             time.Duration
+	ConnectTimeout      time.Duration
+	Proxy               string // proxy url, "direct" to ignore HTTP_PROXY environment
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	CABundles           []string
+	InsecureSkipVerify  bool
+	Retry               RetryConfig
+	CircuitBreaker      CircuitBreakerConfig
+}
+
+// RetryConfig retries idempotent provider calls failed by network errors, 429, 502, 503 and 504 responses.
+type RetryConfig struct {
+	MaxAttempts    int // 1 disables retries
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// CircuitBreakerConfig stops calling the provider for OpenTimeout after FailureThreshold consecutive failures.
+type CircuitBreakerConfig struct {
+	Disabled         bool
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+// UserInfoRequestConfig controls how userinfo endpoint is called.
+type UserInfoRequestConfig struct {
+	Method         string // GET (default) or POST
+	TokenPlacement string // "header" (default) or "form", form requires POST
+	Headers        map[string]string
+	Accept         string // "application/json" by default
+}
+
+// ClaimMappingConfig is used by UserInfoUnmarshaler = "mapping" to map userinfo claims to user fields.
+type ClaimMappingConfig struct {
+	Id        ClaimRuleConfig
+	Login     ClaimRuleConfig
+	Email     ClaimRuleConfig
+	FullName  ClaimRuleConfig
+	FirstName ClaimRuleConfig
+	LastName  ClaimRuleConfig
+}
+
+type ClaimRuleConfig struct {
+	Claims     []string
+	Transforms []string
+	Join       string
+}
+
+// PermissionsConfig maps role and group claims to user permissions.
+type PermissionsConfig struct {
+	Rules      []PermissionRuleConfig
+	Roles      []RoleConfig
+	OnlyMapped bool
+}
+
+type PermissionRuleConfig struct {
+	Claim     string
+	Separator string
+	Format    string
+}
+
+type RoleConfig struct {
+	Role        string
+	Permissions []string
 }
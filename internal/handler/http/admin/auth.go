@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NewBearerAuth protects admin api with a static bearer token compared in constant time.
+func NewBearerAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		auth := c.Get(fiber.HeaderAuthorization)
+		given, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnauthorized)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"myoidc/internal/handler/http"
+	"myoidc/internal/usecase"
+	"myoidc/internal/usecase/admin/sessions"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionsHandler struct {
+	uc *sessions.UseCase
+	l  log.Logger
+}
+
+func NewSessionsHandler(uc *sessions.UseCase, l log.Logger) *SessionsHandler {
+	return &SessionsHandler{
+		uc: uc,
+		l:  l,
+	}
+}
+
+// Register mounts session routes to the admin router:
+//
+//	GET    /users/:userId/sessions             list user sessions
+//	DELETE /users/:userId/sessions             revoke all user sessions
+//	DELETE /users/:userId/sessions/:ref        revoke one user session
+//	DELETE /providers/:provider/sessions/:sid  revoke sessions of identity provider session
+func (h *SessionsHandler) Register(r fiber.Router) {
+	r.Get("/users/:userId/sessions", h.List())
+	r.Delete("/users/:userId/sessions", h.RevokeAll())
+	r.Delete("/users/:userId/sessions/:ref", h.Revoke())
+	r.Delete("/providers/:provider/sessions/:sid", h.RevokeByProviderSession())
+}
+
+func (h *SessionsHandler) List() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := h.uc.List(c.Context(), c.Params("userId"))
+		if err != nil {
+			return h.error(c, err)
+		}
+		return c.JSON(list)
+	}
+}
+
+func (h *SessionsHandler) Revoke() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := h.uc.Revoke(c.Context(), c.Params("userId"), c.Params("ref"))
+		if err != nil {
+			return h.error(c, err)
+		}
+		h.l.Infof("admin revoked session %s of user %s", c.Params("ref"), c.Params("userId"))
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func (h *SessionsHandler) RevokeAll() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		count, err := h.uc.RevokeAll(c.Context(), c.Params("userId"))
+		if err != nil {
+			return h.error(c, err)
+		}
+		h.l.Infof("admin revoked %d sessions of user %s", count, c.Params("userId"))
+		return c.JSON(&fiber.Map{"revoked": count})
+	}
+}
+
+func (h *SessionsHandler) RevokeByProviderSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		count, err := h.uc.RevokeByProviderSession(c.Context(), c.Params("provider"), c.Params("sid"))
+		if err != nil {
+			return h.error(c, err)
+		}
+		h.l.Infof("admin revoked %d sessions of provider %s session", count, c.Params("provider"))
+		return c.JSON(&fiber.Map{"revoked": count})
+	}
+}
+
+func (h *SessionsHandler) error(c *fiber.Ctx, err error) error {
+	switch errors.GetErrCode(err) {
+	case usecase.ErrCodeEntityNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.ErrNotFound)
+	case usecase.ErrCodeNotSupported:
+		h.l.WithError(err).Warn("admin session api is not supported by session store")
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.ErrNotImplemented)
+	default:
+		h.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
+	}
+}
@@ -0,0 +1,214 @@
+// Package auth authenticates requests by the session cookie and exposes the current user to handlers.
+package auth
+
+import (
+	"context"
+	"myoidc/internal/domain"
+	"myoidc/internal/handler/http"
+	"myoidc/internal/service/session"
+	"myoidc/internal/usecase"
+	"myoidc/internal/usecase/oidc/userinfo"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/log"
+	nethttp "net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultLoginPath is the login handler browsers are redirected to.
+const DefaultLoginPath = "/oauth/login"
+
+// localsKey holds *Identity in fiber locals.
+const localsKey = "myoidc.identity"
+
+type identityKey struct{}
+
+// Identity is the authenticated user of the request.
+type Identity struct {
+	User    *domain.User
+	Session SessionInfo
+	// AccessToken is passed to upstreams configured to receive it, handlers should not expose it.
+	AccessToken string
+}
+
+// SessionInfo is session metadata safe to pass to handlers, tokens are not exposed.
+type SessionInfo struct {
+	Id           string
+	UserId       string
+	ProviderName string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// FromCtx returns identity set by RequireAuth.
+func FromCtx(c *fiber.Ctx) (*Identity, bool) {
+	id, ok := c.Locals(localsKey).(*Identity)
+	return id, ok
+}
+
+// SetIdentity exposes identity to following handlers by FromCtx and FromContext.
+func SetIdentity(c *fiber.Ctx, id *Identity) {
+	c.Locals(localsKey, id)
+	c.SetUserContext(WithIdentity(c.UserContext(), id))
+}
+
+// WithIdentity returns context exposing identity by FromContext.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns identity set by RequireAuth to fiber user context, e.g. c.UserContext().
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+type Config struct {
+	// ProviderName is used by login started for unauthenticated browsers.
+	ProviderName string
+	LoginPath    string
+}
+
+// RequireAuth loads and validates the session, tokens are refreshed by userinfo use case when
+// the provider rejects them. Unauthenticated browsers are redirected to login and get back to
+// the requested url after it, other callers get 401.
+type RequireAuth struct {
+	cfg    Config
+	uc     *userinfo.UseCase
+	cookie *http.SessionCookie
+	l      log.Logger
+}
+
+func NewRequireAuth(cfg Config, uc *userinfo.UseCase, cookie *http.SessionCookie, l log.Logger) *RequireAuth {
+	if cfg.LoginPath == "" {
+		cfg.LoginPath = DefaultLoginPath
+	}
+	return &RequireAuth{
+		cfg:    cfg,
+		uc:     uc,
+		cookie: cookie,
+		l:      l,
+	}
+}
+
+func (m *RequireAuth) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, fail := m.Identify(c)
+		if fail != nil {
+			if fail.Status == fiber.StatusUnauthorized && c.Method() == fiber.MethodGet &&
+				c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML {
+				return c.Redirect(m.LoginURL(c.OriginalURL()), fiber.StatusFound)
+			}
+			return c.Status(fail.Status).JSON(fail.Body)
+		}
+		SetIdentity(c, id)
+		return c.Next()
+	}
+}
+
+// Identify authenticates the request as Handler does, but leaves the failure response to the caller.
+// The session cookie is reissued or dropped in any case.
+func (m *RequireAuth) Identify(c *fiber.Ctx) (*Identity, *Failure) {
+	sessId := m.cookie.Get(c)
+	id, sess, fail := m.authenticate(c.Context(), sessId, c.Path())
+	if fail != nil {
+		if fail.clear {
+			m.cookie.Del(c)
+		}
+		return nil, fail
+	}
+
+	if sess.Id != sessId {
+		err := m.cookie.Set(c, sess.Id)
+		if err != nil {
+			m.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+			return nil, &Failure{Status: fiber.StatusInternalServerError, Body: fiber.ErrInternalServerError}
+		}
+	}
+	return id, nil
+}
+
+// Authenticate is Handler for net/http handlers, the failure response is written when false is returned.
+func (m *RequireAuth) Authenticate(w nethttp.ResponseWriter, r *nethttp.Request) (*Identity, bool) {
+	sessId := m.cookie.GetHTTP(r)
+	id, sess, fail := m.authenticate(r.Context(), sessId, r.URL.Path)
+	if fail != nil {
+		if fail.clear {
+			m.cookie.DelHTTP(w, r)
+		}
+		if fail.Status == nethttp.StatusUnauthorized && r.Method == nethttp.MethodGet &&
+			strings.Contains(r.Header.Get("Accept"), fiber.MIMETextHTML) {
+			nethttp.Redirect(w, r, m.LoginURL(r.URL.RequestURI()), nethttp.StatusFound)
+			return nil, false
+		}
+		http.WriteJSON(w, fail.Status, fail.Body)
+		return nil, false
+	}
+
+	if sess.Id != sessId {
+		err := m.cookie.SetHTTP(w, r, sess.Id)
+		if err != nil {
+			m.l.WithError(err).Errorf(http.UnexpectedPathErrorMessage(r.URL.Path))
+			http.WriteJSON(w, nethttp.StatusInternalServerError, fiber.ErrInternalServerError)
+			return nil, false
+		}
+	}
+	return id, true
+}
+
+// Failure is the response to a request failed authentication, Status is 401 or 500.
+type Failure struct {
+	Status int
+	Body   interface{}
+	// clear drops the cookie of a missing or invalid session
+	clear bool
+}
+
+func (m *RequireAuth) authenticate(ctx context.Context, sessId string, path string) (*Identity, *session.Session, *Failure) {
+	if sessId == "" {
+		return nil, nil, &Failure{Status: fiber.StatusUnauthorized, Body: fiber.ErrUnauthorized}
+	}
+
+	res, err := m.uc.Execute(ctx, sessId)
+	if err != nil {
+		switch errors.GetErrCode(err) {
+		case usecase.ErrCodeUserUnauthorized, usecase.ErrCodeSessionInterrupt, usecase.ErrCodeEntityNotFound:
+			m.l.WithError(err).Warnf("request to %s is not authenticated", path)
+			return nil, nil, &Failure{Status: fiber.StatusUnauthorized, Body: fiber.ErrUnauthorized, clear: true}
+		case usecase.ErrCodeSessionTerminated:
+			terminated := errors.Unwrap[*session.TerminatedError](err)
+			return nil, nil, &Failure{Status: fiber.StatusUnauthorized, Body: &fiber.Map{
+				"code":    fiber.StatusUnauthorized,
+				"message": "session is terminated",
+				"reason":  terminated.Reason,
+			}, clear: true}
+		default:
+			m.l.WithError(err).Errorf(http.UnexpectedPathErrorMessage(path))
+			return nil, nil, &Failure{Status: fiber.StatusInternalServerError, Body: fiber.ErrInternalServerError}
+		}
+	}
+
+	auth, _ := session.GetAuth(res.Session.Data)
+	return &Identity{
+		User:        res.User,
+		AccessToken: auth.AccessToken,
+		Session: SessionInfo{
+			Id:           res.Session.Id,
+			UserId:       res.Session.UserId,
+			ProviderName: auth.ProviderName,
+			CreatedAt:    res.Session.CreatedAt,
+			ExpiresAt:    res.Session.ExpiresAt,
+		},
+	}, res.Session, nil
+}
+
+// LoginURL returns login path returning the browser to backUrl.
+func (m *RequireAuth) LoginURL(backUrl string) string {
+	query := url.Values{}
+	query.Set("providerName", m.cfg.ProviderName)
+	query.Set("backUrl", backUrl)
+	return m.cfg.LoginPath + "?" + query.Encode()
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"myoidc/internal/domain"
+	"myoidc/internal/handler/http"
+	oidccli "myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/event"
+	"myoidc/internal/service/session/inmemory"
+	"myoidc/internal/usecase/oidc/userinfo"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/log"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// testClient accepts only "FRESH_TOKEN" and refreshes any token to it.
+type testClient struct {
+	oidccli.Client
+}
+
+func (testClient) FetchUserByToken(ctx context.Context, token *oidccli.Token) (*domain.User, error) {
+	if token.Access != "FRESH_TOKEN" {
+		return nil, errors.Wrap(oidccli.ErrTokenRejected, "expired")
+	}
+	return &domain.User{Id: "123", Login: "user"}, nil
+}
+
+func (testClient) RefreshToken(ctx context.Context, token *oidccli.Token) (*oidccli.Token, error) {
+	return &oidccli.Token{Access: "FRESH_TOKEN"}, nil
+}
+
+func TestRequireAuth(t *testing.T) {
+	sm := inmemory.NewManager()
+	reg := oidccli.MapClientRegistry{"myoidc": testClient{}}
+	cookie := http.NewSessionCookie("sessId", http.DefaultCookiePolicy(), nil)
+	m := NewRequireAuth(Config{ProviderName: "myoidc"}, userinfo.NewUseCase(reg, sm, event.Discard, 0), cookie, log.GetDefault())
+
+	app := fiber.New()
+	app.Get("/*", m.Handler(), func(c *fiber.Ctx) error {
+		id, ok := FromCtx(c)
+		if !ok {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if ctxId, _ := FromContext(c.UserContext()); ctxId != id {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.SendString(id.User.Login + "@" + id.Session.ProviderName)
+	})
+
+	sess, _ := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{
+		ProviderName: "myoidc",
+		AccessToken:  "EXPIRED_TOKEN",
+		RefreshToken: "REFRESH_TOKEN",
+	}))
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		expected int
+		location string
+	}{
+		{name: "api without session", expected: fiber.StatusUnauthorized},
+		{name: "browser without session", header: map[string]string{"Accept": "text/html"}, expected: fiber.StatusFound,
+			location: "/oauth/login?" + url.Values{"providerName": {"myoidc"}, "backUrl": {"/app/page?tab=1"}}.Encode()},
+		{name: "unknown session", header: map[string]string{"Cookie": "sessId=unknown"}, expected: fiber.StatusUnauthorized},
+		{name: "expired token is refreshed", header: map[string]string{"Cookie": "sessId=" + sess.Id}, expected: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/app/page?tab=1", nil)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		res, err := app.Test(req)
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expected, res.StatusCode, tt.name)
+			assert.Equal(t, tt.location, res.Header.Get("Location"), tt.name)
+		}
+	}
+
+	stored, err := sm.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err) {
+		auth, _ := session.GetAuth(stored.Data)
+		assert.Equal(t, "FRESH_TOKEN", auth.AccessToken, "refreshed token is not stored")
+		assert.Equal(t, "REFRESH_TOKEN", auth.RefreshToken, "kept refresh token is lost")
+	}
+}
+
+// countingClient counts provider calls, onReject runs before the token is rejected.
+type countingClient struct {
+	testClient
+	fetched   atomic.Int32
+	refreshed atomic.Int32
+	onReject  func()
+}
+
+func (cli *countingClient) FetchUserByToken(ctx context.Context, token *oidccli.Token) (*domain.User, error) {
+	cli.fetched.Add(1)
+	user, err := cli.testClient.FetchUserByToken(ctx, token)
+	if err != nil && cli.onReject != nil {
+		cli.onReject()
+	}
+	return user, err
+}
+
+func (cli *countingClient) RefreshToken(ctx context.Context, token *oidccli.Token) (*oidccli.Token, error) {
+	cli.refreshed.Add(1)
+	return cli.testClient.RefreshToken(ctx, token)
+}
+
+func TestRequireAuth_StoredUser(t *testing.T) {
+	sm := inmemory.NewManager()
+	cli := &countingClient{}
+	cookie := http.NewSessionCookie("sessId", http.DefaultCookiePolicy(), nil)
+	uc := userinfo.NewUseCase(oidccli.MapClientRegistry{"myoidc": cli}, sm, event.Discard, time.Minute)
+	app := fiber.New()
+	app.Get("/*", NewRequireAuth(Config{ProviderName: "myoidc"}, uc, cookie, log.GetDefault()).Handler(), func(c *fiber.Ctx) error {
+		id, _ := FromCtx(c)
+		return c.SendString(id.User.Login)
+	})
+	request := func(sessId string) int {
+		req := httptest.NewRequest("GET", "/app", nil)
+		req.Header.Set("Cookie", "sessId="+sessId)
+		res, err := app.Test(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		return res.StatusCode
+	}
+
+	fresh, _ := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{
+		ProviderName:  "myoidc",
+		AccessToken:   "FRESH_TOKEN",
+		Expiry:        time.Now().Add(time.Hour),
+		User:          &domain.User{Id: "123", Login: "user"},
+		UserCheckedAt: time.Now(),
+	}))
+	assert.Equal(t, fiber.StatusOK, request(fresh.Id))
+	assert.Equal(t, fiber.StatusOK, request(fresh.Id))
+	assert.Equal(t, int32(0), cli.fetched.Load(), "stored user is fetched from provider")
+
+	unchecked, _ := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{
+		ProviderName: "myoidc",
+		AccessToken:  "FRESH_TOKEN",
+	}))
+	assert.Equal(t, fiber.StatusOK, request(unchecked.Id))
+	assert.Equal(t, fiber.StatusOK, request(unchecked.Id))
+	assert.Equal(t, int32(1), cli.fetched.Load(), "fetched user is not stored")
+
+	expired, _ := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{
+		ProviderName:  "myoidc",
+		AccessToken:   "EXPIRED_TOKEN",
+		RefreshToken:  "REFRESH_TOKEN",
+		Expiry:        time.Now().Add(-time.Minute),
+		User:          &domain.User{Id: "123", Login: "user"},
+		UserCheckedAt: time.Now(),
+	}))
+	assert.Equal(t, fiber.StatusOK, request(expired.Id))
+	assert.Equal(t, int32(1), cli.refreshed.Load(), "expired token is not refreshed")
+	assert.Equal(t, int32(2), cli.fetched.Load(), "expired token is sent to provider")
+}
+
+func TestRequireAuth_ConcurrentRefresh(t *testing.T) {
+	sm := inmemory.NewManager()
+	sess, _ := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{
+		ProviderName: "myoidc",
+		AccessToken:  "EXPIRED_TOKEN",
+		RefreshToken: "REFRESH_TOKEN",
+	}))
+	// a concurrent request refreshes the token while the provider rejects the old one
+	cli := &countingClient{onReject: func() {
+		_, _ = session.Modify(context.TODO(), sm, sess.Id, func(sess *session.Session) error {
+			auth, _ := session.GetAuth(sess.Data)
+			auth.AccessToken = "FRESH_TOKEN"
+			auth.RefreshToken = "ROTATED_TOKEN"
+			session.SetAuth(sess.Data, auth)
+			return nil
+		})
+	}}
+	uc := userinfo.NewUseCase(oidccli.MapClientRegistry{"myoidc": cli}, sm, event.Discard, 0)
+
+	res, err := uc.Execute(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, "user", res.User.Login)
+		auth, _ := session.GetAuth(res.Session.Data)
+		assert.Equal(t, "ROTATED_TOKEN", auth.RefreshToken, "concurrently refreshed tokens are overwritten")
+	}
+	assert.Equal(t, int32(0), cli.refreshed.Load(), "refresh token is spent twice")
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// DefaultHeaderPrefix prefixes identity headers passed to upstreams, e.g. "X-Auth-Request-User".
+const DefaultHeaderPrefix = "X-Auth-Request-"
+
+// Identity header names following the prefix.
+const (
+	HeaderUser        = "User"
+	HeaderEmail       = "Email"
+	HeaderLogin       = "Login"
+	HeaderName        = "Name"
+	HeaderPermissions = "Permissions" // comma separated
+	HeaderProvider    = "Provider"
+	HeaderAccessToken = "Access-Token"
+	HeaderIdentity    = "Identity" // signed identity token
+)
+
+// Headers returns identity headers without tokens, values are stripped of control characters.
+func (id *Identity) Headers(prefix string) map[string]string {
+	headers := map[string]string{
+		prefix + HeaderUser:     id.Session.UserId,
+		prefix + HeaderProvider: id.Session.ProviderName,
+	}
+	if id.User != nil {
+		headers[prefix+HeaderEmail] = id.User.Email
+		headers[prefix+HeaderLogin] = id.User.Login
+		headers[prefix+HeaderName] = id.User.FullName
+		headers[prefix+HeaderPermissions] = strings.Join(id.User.Permissions, ",")
+	}
+	for key, value := range headers {
+		headers[key] = sanitizeHeader(value)
+	}
+	return headers
+}
+
+// IsIdentityHeader reports whether the header is set by Headers, such headers sent by
+// clients must be dropped before forwarding. Underscores are treated as dashes, since
+// CGI-like upstreams read both X_Auth_Request_User and X-Auth-Request-User as one variable.
+func IsIdentityHeader(prefix string, name string) bool {
+	return strings.HasPrefix(normalizeHeader(name), normalizeHeader(prefix))
+}
+
+func normalizeHeader(name string) string {
+	return textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(name, "_", "-"))
+}
+
+func sanitizeHeader(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+}
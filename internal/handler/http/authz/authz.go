@@ -0,0 +1,233 @@
+// Package authz authorizes requests authenticated by auth.RequireAuth by user permissions.
+package authz
+
+import (
+	"myoidc/internal/domain"
+	"myoidc/internal/handler/http/auth"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/log"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Reasons of 403 responses.
+const (
+	ReasonMissingPermission = "missing_permission"
+	// ReasonInvalidPath rejects paths upstreams may resolve differently from the rules.
+	ReasonInvalidPath = "invalid_path"
+)
+
+// Requirement is satisfied by a user having all AllOf permissions and at least one
+// of AnyOf permissions, empty lists are ignored.
+type Requirement struct {
+	AllOf []string
+	AnyOf []string
+}
+
+// IsSatisfied reports whether user permissions meet the requirement.
+func (r Requirement) IsSatisfied(user *domain.User) bool {
+	if user == nil {
+		return false
+	}
+	granted := make(map[string]bool, len(user.Permissions))
+	for _, perm := range user.Permissions {
+		granted[perm] = true
+	}
+	for _, perm := range r.AllOf {
+		if !granted[perm] {
+			return false
+		}
+	}
+	if len(r.AnyOf) == 0 {
+		return true
+	}
+	for _, perm := range r.AnyOf {
+		if granted[perm] {
+			return true
+		}
+	}
+	return false
+}
+
+// Require rejects requests of users not meeting the requirement, it must follow auth.RequireAuth.
+func Require(req Requirement) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := auth.FromCtx(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnauthorized)
+		}
+		if !req.IsSatisfied(id.User) {
+			return forbidden(c, ReasonMissingPermission)
+		}
+		return c.Next()
+	}
+}
+
+// RequirePermission rejects requests of users without the permission, e.g. "billing:read".
+func RequirePermission(perm string) fiber.Handler {
+	return Require(Requirement{AllOf: []string{perm}})
+}
+
+// RequireAll rejects requests of users missing any of permissions.
+func RequireAll(perms ...string) fiber.Handler {
+	return Require(Requirement{AllOf: perms})
+}
+
+// RequireAny rejects requests of users having none of permissions.
+func RequireAny(perms ...string) fiber.Handler {
+	return Require(Requirement{AnyOf: perms})
+}
+
+// Rule applies the requirement to matching requests.
+type Rule struct {
+	// Path matches request path cleaned by CleanPath, "/prefix/*" matches the prefix and all
+	// its subpaths. Paths are case-sensitive unless IgnoreCase is set.
+	Path string
+	// IgnoreCase matches paths case-insensitively, e.g. for upstreams serving /Admin as /admin.
+	IgnoreCase bool
+	// Methods limit the rule to http methods, all methods if empty. Requests of other methods
+	// are denied unless a following rule of the path applies to them.
+	Methods []string
+	// Provider limits the rule to users logged in with the provider, all users if empty. Users
+	// of other providers are denied unless a following rule of the path applies to them.
+	Provider string
+	Requirement
+}
+
+func (r Rule) matchesPath(path string) bool {
+	rulePath := r.Path
+	if r.IgnoreCase {
+		rulePath, path = strings.ToLower(rulePath), strings.ToLower(path)
+	}
+	if prefix, ok := strings.CutSuffix(rulePath, "*"); ok {
+		return strings.HasPrefix(path, prefix) || path == strings.TrimSuffix(prefix, "/")
+	}
+	return path == rulePath
+}
+
+func (r Rule) appliesTo(method string, providerName string) bool {
+	if r.Provider != "" && r.Provider != providerName {
+		return false
+	}
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxUnescapes limits decoding of nested percent-encoding, e.g. "%252e".
+const maxUnescapes = 3
+
+// CleanPath returns the canonical form of the request path, so "/app/x/../admin", "/app//admin"
+// and "/app/%2e%2e/admin" can't bypass rules of "/admin". Percent-encoding is decoded, dot
+// segments are resolved and repeated slashes are collapsed, the trailing slash is kept.
+func CleanPath(p string) string {
+	p = unescapePath(p)
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// HasDotSegments reports whether the path has "." or ".." segments, percent-encoded ones included.
+func HasDotSegments(p string) bool {
+	for _, segment := range strings.Split(unescapePath(p), "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func unescapePath(p string) string {
+	for i := 0; i < maxUnescapes && strings.Contains(p, "%"); i++ {
+		unescaped, err := url.PathUnescape(p)
+		if err != nil {
+			break
+		}
+		p = unescaped
+	}
+	return p
+}
+
+// Rules checks the first matching rule. Requests matching no rule path are allowed, requests
+// matching a rule path but excluded by methods or provider of all such rules are denied.
+type Rules struct {
+	rules []Rule
+	l     log.Logger
+}
+
+func NewRules(rules []Rule, l log.Logger) (*Rules, error) {
+	for i, r := range rules {
+		if !strings.HasPrefix(r.Path, "/") {
+			return nil, errors.Errorf("authorization rule [%d] path \"%s\" must start with /", i, r.Path)
+		}
+	}
+	return &Rules{
+		rules: rules,
+		l:     l,
+	}, nil
+}
+
+// Handler must follow auth.RequireAuth.
+func (rs *Rules) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, ok := auth.FromCtx(c)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnauthorized)
+		}
+		if !rs.Allowed(c.Method(), c.Path(), id) {
+			return forbidden(c, ReasonMissingPermission)
+		}
+		return c.Next()
+	}
+}
+
+// Allowed checks the first rule matching the request, e.g. for net/http handlers.
+// The path is cleaned by CleanPath before matching.
+func (rs *Rules) Allowed(method string, path string, id *auth.Identity) bool {
+	path = CleanPath(path)
+	protected := false
+	for _, r := range rs.rules {
+		if !r.matchesPath(path) {
+			continue
+		}
+		protected = true
+		if !r.appliesTo(method, id.Session.ProviderName) {
+			continue
+		}
+		if !r.IsSatisfied(id.User) {
+			rs.l.Warnf("user %s is not allowed to %s %s", id.Session.UserId, method, path)
+			return false
+		}
+		return true
+	}
+	if protected {
+		rs.l.Warnf("no rule applies to %s %s of user %s logged in with %s",
+			method, path, id.Session.UserId, id.Session.ProviderName)
+		return false
+	}
+	return true
+}
+
+// ForbiddenBody is the 403 response body with a machine-readable reason.
+func ForbiddenBody(reason string) *fiber.Map {
+	return &fiber.Map{
+		"code":    fiber.StatusForbidden,
+		"message": "access is forbidden",
+		"reason":  reason,
+	}
+}
+
+func forbidden(c *fiber.Ctx, reason string) error {
+	return c.Status(fiber.StatusForbidden).JSON(ForbiddenBody(reason))
+}
@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"myoidc/internal/domain"
+	"myoidc/internal/handler/http/auth"
+	"myoidc/pkg/log"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequirement_IsSatisfied(t *testing.T) {
+	user := &domain.User{Permissions: []string{"billing:read", "reports:read"}}
+	tests := []struct {
+		name     string
+		req      Requirement
+		expected bool
+	}{
+		{name: "empty", req: Requirement{}, expected: true},
+		{name: "all granted", req: Requirement{AllOf: []string{"billing:read", "reports:read"}}, expected: true},
+		{name: "one of all missing", req: Requirement{AllOf: []string{"billing:read", "billing:write"}}, expected: false},
+		{name: "any granted", req: Requirement{AnyOf: []string{"billing:write", "reports:read"}}, expected: true},
+		{name: "none of any", req: Requirement{AnyOf: []string{"billing:write"}}, expected: false},
+		{name: "all and any", req: Requirement{AllOf: []string{"billing:read"}, AnyOf: []string{"admin"}}, expected: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.req.IsSatisfied(user), tt.name)
+	}
+	assert.False(t, Requirement{}.IsSatisfied(nil), "anonymous user is allowed")
+}
+
+func TestRules(t *testing.T) {
+	rules, err := NewRules([]Rule{
+		{Path: "/billing/*", Provider: "github", Requirement: Requirement{AllOf: []string{"org:member"}}},
+		{Path: "/billing/*", Methods: []string{"POST"}, Requirement: Requirement{AllOf: []string{"billing:write"}}},
+		{Path: "/billing/*", Requirement: Requirement{AnyOf: []string{"billing:read", "billing:write"}}},
+	}, log.GetDefault())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		auth.SetIdentity(c, &auth.Identity{
+			User:    &domain.User{Permissions: []string{"billing:read"}},
+			Session: auth.SessionInfo{ProviderName: c.Get("X-Provider")},
+		})
+		return c.Next()
+	}, rules.Handler())
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		provider string
+		expected int
+	}{
+		{name: "no rule", method: "GET", path: "/home", expected: fiber.StatusNoContent},
+		{name: "any of granted", method: "GET", path: "/billing/invoices", expected: fiber.StatusNoContent},
+		{name: "method rule", method: "POST", path: "/billing/invoices", expected: fiber.StatusForbidden},
+		{name: "provider rule", method: "GET", path: "/billing/invoices", provider: "github", expected: fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-Provider", tt.provider)
+		res, err := app.Test(req)
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expected, res.StatusCode, tt.name)
+		}
+	}
+
+	// path rules limited by provider or method don't let other requests through
+	rules, err = NewRules([]Rule{
+		{Path: "/billing/*", Methods: []string{"GET"}, Provider: "github", Requirement: Requirement{AllOf: []string{"billing:read"}}},
+	}, log.GetDefault())
+	if !assert.NoError(t, err) {
+		return
+	}
+	id := func(provider string) *auth.Identity {
+		return &auth.Identity{
+			User:    &domain.User{Permissions: []string{"billing:read"}},
+			Session: auth.SessionInfo{ProviderName: provider},
+		}
+	}
+	assert.True(t, rules.Allowed("GET", "/billing/invoices", id("github")), "permitted user is denied")
+	assert.False(t, rules.Allowed("GET", "/billing/invoices", id("gitlab")), "user of another provider is allowed")
+	assert.False(t, rules.Allowed("POST", "/billing/invoices", id("github")), "another method is allowed")
+	assert.True(t, rules.Allowed("POST", "/home", id("gitlab")), "request matching no rule is denied")
+
+	_, err = NewRules([]Rule{{Path: "billing"}}, log.GetDefault())
+	assert.Error(t, err, "relative path is accepted")
+}
+
+func TestRules_Allowed(t *testing.T) {
+	rules, err := NewRules([]Rule{
+		{Path: "/admin/*", Requirement: Requirement{AllOf: []string{"admin"}}},
+		{Path: "/Reports/*", IgnoreCase: true, Requirement: Requirement{AllOf: []string{"reports:read"}}},
+	}, log.GetDefault())
+	if !assert.NoError(t, err) {
+		return
+	}
+	id := &auth.Identity{User: &domain.User{}}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "/home", expected: true},
+		{path: "/admin", expected: false},
+		{path: "/admin/", expected: false},
+		{path: "/admin/users", expected: false},
+		{path: "/app/../admin/users", expected: false},
+		{path: "/admin/./users", expected: false},
+		{path: "//admin/users", expected: false},
+		{path: "/admin//users", expected: false},
+		{path: "/%2e%2e/admin/users", expected: false},
+		{path: "/app/%2E%2E/admin/users", expected: false},
+		{path: "/app/%252e%252e/admin/users", expected: false},
+		{path: "/%61dmin/users", expected: false},
+		{path: "/administrator", expected: true},
+		{path: "/reports/daily", expected: false},
+		{path: "/REPORTS/daily", expected: false},
+		// rules are case-sensitive by default
+		{path: "/ADMIN/users", expected: true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rules.Allowed("GET", tt.path, id), tt.path)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := map[string]string{
+		"":                 "/",
+		"/":                "/",
+		"/app/page":        "/app/page",
+		"/app/page/":       "/app/page/",
+		"/app//page":       "/app/page",
+		"/app/./page":      "/app/page",
+		"/app/x/../page":   "/app/page",
+		"/../../page":      "/page",
+		"/app/%2e%2e/page": "/page",
+		"/app%2Fpage":      "/app/page",
+		"/app/%zz":         "/app/%zz",
+	}
+	for p, expected := range tests {
+		assert.Equal(t, expected, CleanPath(p), p)
+	}
+}
+
+func TestHasDotSegments(t *testing.T) {
+	tests := map[string]bool{
+		"/app/page":            false,
+		"/app/.well-known":     false,
+		"/app/page..":          false,
+		"/app/../page":         true,
+		"/app/./page":          true,
+		"/app/..":              true,
+		"/app/%2e%2e/page":     true,
+		"/app/%252E%252E/page": true,
+	}
+	for p, expected := range tests {
+		assert.Equal(t, expected, HasDotSegments(p), p)
+	}
+}
@@ -2,29 +2,323 @@ package http
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+	nethttp "net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// CookieSessionId is the default session cookie name.
 const CookieSessionId = "sessId"
 
 func GetCookie(c *fiber.Ctx, key string) string {
 	return string(c.Request().Header.Cookie(key))
 }
 
-func SetCookie(c *fiber.Ctx, key string, value string) {
+const (
+	// CookiePrefixHost requires Secure, Path "/" and no Domain, so the cookie can't be set by subdomains.
+	CookiePrefixHost = "__Host-"
+	// CookiePrefixSecure requires Secure.
+	CookiePrefixSecure = "__Secure-"
+)
+
+// CookiePolicy sets attributes of cookies issued by handlers.
+type CookiePolicy struct {
+	Domain   string // empty issues a host-only cookie
+	Path     string
+	Secure   bool
+	SameSite string // fiber.CookieSameSite*Mode
+	// MaxAge makes the cookie persistent, zero issues a cookie removed when the browser is closed.
+	MaxAge time.Duration
+}
+
+func DefaultCookiePolicy() CookiePolicy {
+	return CookiePolicy{
+		Path:     "/",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+}
+
+// Validate checks the policy against requirements of browsers for the cookie name.
+func (p CookiePolicy) Validate(name string) error {
+	switch {
+	case strings.HasPrefix(name, CookiePrefixHost) && (!p.Secure || p.Domain != "" || p.Path != "/"):
+		return errors.Errorf("cookie %s requires Secure, Path \"/\" and no Domain", name)
+	case strings.HasPrefix(name, CookiePrefixSecure) && !p.Secure:
+		return errors.Errorf("cookie %s requires Secure", name)
+	case strings.EqualFold(p.SameSite, fiber.CookieSameSiteNoneMode) && !p.Secure:
+		return errors.Error("SameSite=None cookie requires Secure")
+	}
+	switch strings.ToLower(p.SameSite) {
+	case fiber.CookieSameSiteLaxMode, fiber.CookieSameSiteStrictMode, fiber.CookieSameSiteNoneMode:
+		return nil
+	default:
+		return errors.Errorf("unknown cookie SameSite \"%s\"", p.SameSite)
+	}
+}
+
+func SetCookie(c *fiber.Ctx, key string, value string, policy CookiePolicy) {
 	c.Cookie(&fiber.Cookie{
 		Name:     key,
 		Value:    value,
-		Path:     "/",
+		Domain:   policy.Domain,
+		Path:     policy.Path,
+		MaxAge:   int(policy.MaxAge.Seconds()),
+		Secure:   policy.Secure,
 		HTTPOnly: true,
+		SameSite: policy.SameSite,
 	})
 }
 
-func DelCookie(c *fiber.Ctx, key string) {
+func DelCookie(c *fiber.Ctx, key string, policy CookiePolicy) {
 	c.Cookie(&fiber.Cookie{
 		Name:     key,
 		Expires:  time.Now(),
-		Path:     "/",
+		Domain:   policy.Domain,
+		Path:     policy.Path,
+		Secure:   policy.Secure,
 		HTTPOnly: true,
+		SameSite: policy.SameSite,
+	})
+}
+
+// cookieJar reads request cookies and writes response cookies of fiber or net/http handlers.
+type cookieJar interface {
+	get(name string) string
+	set(name string, value string, policy CookiePolicy)
+	del(name string, policy CookiePolicy)
+}
+
+type fiberJar struct {
+	c *fiber.Ctx
+}
+
+func (j fiberJar) get(name string) string {
+	return GetCookie(j.c, name)
+}
+
+func (j fiberJar) set(name string, value string, policy CookiePolicy) {
+	SetCookie(j.c, name, value, policy)
+}
+
+func (j fiberJar) del(name string, policy CookiePolicy) {
+	DelCookie(j.c, name, policy)
+}
+
+type stdJar struct {
+	w nethttp.ResponseWriter
+	r *nethttp.Request
+}
+
+func (j stdJar) get(name string) string {
+	cookie, err := j.r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (j stdJar) set(name string, value string, policy CookiePolicy) {
+	nethttp.SetCookie(j.w, &nethttp.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   policy.Domain,
+		Path:     policy.Path,
+		MaxAge:   int(policy.MaxAge.Seconds()),
+		Secure:   policy.Secure,
+		HttpOnly: true,
+		SameSite: stdSameSite(policy.SameSite),
 	})
 }
+
+func (j stdJar) del(name string, policy CookiePolicy) {
+	nethttp.SetCookie(j.w, &nethttp.Cookie{
+		Name:     name,
+		Domain:   policy.Domain,
+		Path:     policy.Path,
+		MaxAge:   -1,
+		Secure:   policy.Secure,
+		HttpOnly: true,
+		SameSite: stdSameSite(policy.SameSite),
+	})
+}
+
+func stdSameSite(sameSite string) nethttp.SameSite {
+	switch strings.ToLower(sameSite) {
+	case fiber.CookieSameSiteStrictMode:
+		return nethttp.SameSiteStrictMode
+	case fiber.CookieSameSiteNoneMode:
+		return nethttp.SameSiteNoneMode
+	default:
+		return nethttp.SameSiteLaxMode
+	}
+}
+
+const (
+	// DefaultCookieChunkSize keeps every chunk with its attributes under 4096 bytes browser limit.
+	DefaultCookieChunkSize = 3800
+	maxCookieChunks        = 10
+)
+
+// SessionCookie transfers session id between a session manager and the browser.
+// The value is signed when Signer is set, cookies with invalid signature are ignored.
+// Long ids, e.g. sealed stateless sessions, are split into chunks "{name}", "{name}_1", ...
+type SessionCookie struct {
+	Name      string
+	Policy    CookiePolicy
+	ChunkSize int
+	Signer    *keyring.Signer
+}
+
+func NewSessionCookie(name string, policy CookiePolicy, signer *keyring.Signer) *SessionCookie {
+	return &SessionCookie{
+		Name:      name,
+		Policy:    policy,
+		ChunkSize: DefaultCookieChunkSize,
+		Signer:    signer,
+	}
+}
+
+// Get returns verified session id or empty string.
+func (sc *SessionCookie) Get(c *fiber.Ctx) string {
+	return sc.get(fiberJar{c})
+}
+
+func (sc *SessionCookie) Set(c *fiber.Ctx, sessId string) error {
+	return sc.set(fiberJar{c}, sessId)
+}
+
+func (sc *SessionCookie) Del(c *fiber.Ctx) {
+	sc.del(fiberJar{c})
+}
+
+// GetHTTP is Get for net/http handlers.
+func (sc *SessionCookie) GetHTTP(r *nethttp.Request) string {
+	return sc.get(stdJar{r: r})
+}
+
+// SetHTTP is Set for net/http handlers.
+func (sc *SessionCookie) SetHTTP(w nethttp.ResponseWriter, r *nethttp.Request, sessId string) error {
+	return sc.set(stdJar{w: w, r: r}, sessId)
+}
+
+// DelHTTP is Del for net/http handlers.
+func (sc *SessionCookie) DelHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	sc.del(stdJar{w: w, r: r})
+}
+
+// IsChunk reports whether the cookie holds a part of the session id.
+func (sc *SessionCookie) IsChunk(name string) bool {
+	return name == sc.Name || strings.HasPrefix(name, sc.Name+"_")
+}
+
+func (sc *SessionCookie) get(jar cookieJar) string {
+	value := sc.read(jar)
+	if value == "" || sc.Signer == nil {
+		return value
+	}
+	sessId, err := sc.Signer.Verify(value)
+	if err != nil {
+		return ""
+	}
+	return sessId
+}
+
+func (sc *SessionCookie) read(jar cookieJar) string {
+	var sb strings.Builder
+	for i := 0; i < maxCookieChunks; i++ {
+		chunk := jar.get(sc.chunkName(i))
+		if chunk == "" {
+			break
+		}
+		sb.WriteString(chunk)
+	}
+	return sb.String()
+}
+
+func (sc *SessionCookie) set(jar cookieJar, sessId string) error {
+	if sc.Signer != nil {
+		sessId = sc.Signer.Sign(sessId)
+	}
+	count := (len(sessId) + sc.ChunkSize - 1) / sc.ChunkSize
+	if count > maxCookieChunks {
+		return errors.Errorf("session id is too long for %d cookies: %d bytes", maxCookieChunks, len(sessId))
+	}
+	for i := 0; i < count; i++ {
+		end := min((i+1)*sc.ChunkSize, len(sessId))
+		jar.set(sc.chunkName(i), sessId[i*sc.ChunkSize:end], sc.Policy)
+	}
+	// drop chunks left from a longer previous value
+	for i := count; i < maxCookieChunks && jar.get(sc.chunkName(i)) != ""; i++ {
+		jar.del(sc.chunkName(i), sc.Policy)
+	}
+	return nil
+}
+
+func (sc *SessionCookie) del(jar cookieJar) {
+	jar.del(sc.chunkName(0), sc.Policy)
+	for i := 1; i < maxCookieChunks && jar.get(sc.chunkName(i)) != ""; i++ {
+		jar.del(sc.chunkName(i), sc.Policy)
+	}
+}
+
+func (sc *SessionCookie) chunkName(i int) string {
+	if i == 0 {
+		return sc.Name
+	}
+	return sc.Name + "_" + strconv.Itoa(i)
+}
+
+const (
+	CookieLoginTransaction = "oidcTx"
+	// DefaultTransactionCookiePath limits the transaction cookie to login and callback routes.
+	DefaultTransactionCookiePath = "/oauth"
+)
+
+// TransactionCookie binds a login transaction to the browser which started the login.
+// SameSite=Lax lets the cookie through the top-level redirect back from the identity provider.
+type TransactionCookie struct {
+	Name   string
+	Policy CookiePolicy
+	Signer *keyring.Signer
+}
+
+// NewTransactionCookie issues host-only cookie living ttl, Secure is taken from session cookie policy.
+func NewTransactionCookie(policy CookiePolicy, signer *keyring.Signer, ttl time.Duration) *TransactionCookie {
+	return &TransactionCookie{
+		Name: CookieLoginTransaction,
+		Policy: CookiePolicy{
+			Path:     DefaultTransactionCookiePath,
+			Secure:   policy.Secure,
+			SameSite: fiber.CookieSameSiteLaxMode,
+			MaxAge:   ttl,
+		},
+		Signer: signer,
+	}
+}
+
+// Get returns verified transaction id or empty string.
+func (tc *TransactionCookie) Get(c *fiber.Ctx) string {
+	value := GetCookie(c, tc.Name)
+	if value == "" || tc.Signer == nil {
+		return value
+	}
+	txId, err := tc.Signer.Verify(value)
+	if err != nil {
+		return ""
+	}
+	return txId
+}
+
+func (tc *TransactionCookie) Set(c *fiber.Ctx, txId string) {
+	if tc.Signer != nil {
+		txId = tc.Signer.Sign(txId)
+	}
+	SetCookie(c, tc.Name, txId, tc.Policy)
+}
+
+func (tc *TransactionCookie) Del(c *fiber.Ctx) {
+	DelCookie(c, tc.Name, tc.Policy)
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"myoidc/pkg/keyring"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionCookie(t *testing.T) {
+	sc := &SessionCookie{Name: "sessId", Policy: DefaultCookiePolicy(), ChunkSize: 10}
+	app := fiber.New()
+	app.Get("/get", func(c *fiber.Ctx) error {
+		return c.SendString(sc.Get(c))
+	})
+	app.Get("/set", func(c *fiber.Ctx) error {
+		return sc.Set(c, c.Query("v"))
+	})
+
+	res, err := app.Test(httptest.NewRequest("GET", "/set?v="+strings.Repeat("a", 25), nil))
+	if assert.NoError(t, err) {
+		cookies := res.Cookies()
+		if assert.Len(t, cookies, 3) {
+			assert.Equal(t, "sessId", cookies[0].Name)
+			assert.Equal(t, "sessId_1", cookies[1].Name)
+			assert.Equal(t, "aaaaa", cookies[2].Value)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/set?v=short", nil)
+	req.Header.Set("Cookie", "sessId=aaaaaaaaaa; sessId_1=aaaaaaaaaa; sessId_2=aaaaa")
+	res, err = app.Test(req)
+	if assert.NoError(t, err) {
+		cookies := res.Cookies()
+		if assert.Len(t, cookies, 3, "stale chunks are not deleted") {
+			assert.Equal(t, "short", cookies[0].Value)
+			assert.Equal(t, "", cookies[2].Value)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/get", nil)
+	req.Header.Set("Cookie", "sessId=aaaaaaaaaa; sessId_1=bbbbbbbbbb; sessId_3=ccc")
+	res, err = app.Test(req)
+	if assert.NoError(t, err) {
+		body := make([]byte, 32)
+		n, _ := res.Body.Read(body)
+		assert.Equal(t, "aaaaaaaaaabbbbbbbbbb", string(body[:n]), "chunks are not joined")
+	}
+
+	res, err = app.Test(httptest.NewRequest("GET", "/set?v="+strings.Repeat("a", 101), nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, fiber.StatusInternalServerError, res.StatusCode, "too many chunks")
+	}
+}
+
+func TestSessionCookie_Signed(t *testing.T) {
+	signer, err := keyring.NewSigner("k1", keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sc := NewSessionCookie("sessId", DefaultCookiePolicy(), signer)
+	app := fiber.New()
+	app.Get("/get", func(c *fiber.Ctx) error {
+		return c.SendString(sc.Get(c))
+	})
+	app.Get("/set", func(c *fiber.Ctx) error {
+		return sc.Set(c, "SESSION_ID")
+	})
+
+	res, err := app.Test(httptest.NewRequest("GET", "/set", nil))
+	if !assert.NoError(t, err) || !assert.Len(t, res.Cookies(), 1) {
+		return
+	}
+	signed := res.Cookies()[0].Value
+	assert.Equal(t, signer.Sign("SESSION_ID"), signed)
+
+	tests := []struct {
+		cookie   string
+		expected string
+	}{
+		{cookie: signed, expected: "SESSION_ID"},
+		{cookie: "SESSION_ID", expected: ""},
+		{cookie: "OTHER_ID" + signed[len("SESSION_ID"):], expected: ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/get", nil)
+		req.Header.Set("Cookie", "sessId="+tt.cookie)
+		res, err = app.Test(req)
+		if assert.NoError(t, err) {
+			body := make([]byte, 64)
+			n, _ := res.Body.Read(body)
+			assert.Equal(t, tt.expected, string(body[:n]), tt.cookie)
+		}
+	}
+}
+
+func TestTransactionCookie(t *testing.T) {
+	signer, err := keyring.NewSigner("k1", keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	tc := NewTransactionCookie(DefaultCookiePolicy(), signer, 10*time.Minute)
+	app := fiber.New()
+	app.Get("/oauth/set", func(c *fiber.Ctx) error {
+		tc.Set(c, "TX_ID")
+		return nil
+	})
+	app.Get("/oauth/get", func(c *fiber.Ctx) error {
+		return c.SendString(tc.Get(c))
+	})
+
+	res, err := app.Test(httptest.NewRequest("GET", "/oauth/set", nil))
+	if !assert.NoError(t, err) || !assert.Len(t, res.Cookies(), 1) {
+		return
+	}
+	cookie := res.Cookies()[0]
+	assert.Equal(t, CookieLoginTransaction, cookie.Name)
+	assert.Equal(t, "/oauth", cookie.Path)
+	assert.Equal(t, 600, cookie.MaxAge)
+	assert.True(t, cookie.HttpOnly, "cookie is readable by scripts")
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	for value, expected := range map[string]string{cookie.Value: "TX_ID", "TX_ID": ""} {
+		req := httptest.NewRequest("GET", "/oauth/get", nil)
+		req.Header.Set("Cookie", CookieLoginTransaction+"="+value)
+		res, err = app.Test(req)
+		if assert.NoError(t, err) {
+			body, _ := io.ReadAll(res.Body)
+			assert.Equal(t, expected, string(body), value)
+		}
+	}
+}
+
+func TestCookiePolicy_Validate(t *testing.T) {
+	secure := DefaultCookiePolicy()
+	secure.Secure = true
+	withDomain := secure
+	withDomain.Domain = "example.com"
+	none := DefaultCookiePolicy()
+	none.SameSite = fiber.CookieSameSiteNoneMode
+
+	tests := []struct {
+		name          string
+		cookie        string
+		policy        CookiePolicy
+		expectedError bool
+	}{
+		{name: "default", cookie: "sessId", policy: DefaultCookiePolicy()},
+		{name: "host prefix", cookie: "__Host-sessId", policy: secure},
+		{name: "host prefix without secure", cookie: "__Host-sessId", policy: DefaultCookiePolicy(), expectedError: true},
+		{name: "host prefix with domain", cookie: "__Host-sessId", policy: withDomain, expectedError: true},
+		{name: "secure prefix with domain", cookie: "__Secure-sessId", policy: withDomain},
+		{name: "secure prefix without secure", cookie: "__Secure-sessId", policy: DefaultCookiePolicy(), expectedError: true},
+		{name: "same site none without secure", cookie: "sessId", policy: none, expectedError: true},
+		{name: "unknown same site", cookie: "sessId", policy: CookiePolicy{Path: "/", SameSite: "any"}, expectedError: true},
+	}
+	for _, tt := range tests {
+		err := tt.policy.Validate(tt.cookie)
+		if tt.expectedError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+		}
+	}
+}
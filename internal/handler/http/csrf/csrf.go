@@ -0,0 +1,287 @@
+// Package csrf protects cookie authenticated state-changing requests from cross-site request forgery.
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"myoidc/internal/handler/http"
+	csrf_uc "myoidc/internal/usecase/csrf"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/log"
+	nethttp "net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// ModeSynchronizer keeps the token in the session, the client sends it back in the header.
+	ModeSynchronizer = "synchronizer"
+	// ModeDoubleSubmit keeps the token in a cookie, the client sends the same value in the header.
+	// The token is bound to the session id, so a cookie planted by a sibling domain doesn't
+	// match the victim session. Stores reissuing session ids should use ModeSynchronizer.
+	ModeDoubleSubmit = "double_submit"
+
+	// ReasonOrigin and ReasonToken are reasons of 403 responses.
+	ReasonOrigin = "origin"
+	ReasonToken  = "token"
+
+	HeaderName = "X-CSRF-Token"
+	// FormField is checked when the header is missing, e.g. for html forms.
+	FormField  = "_csrf"
+	CookieName = "csrfToken"
+)
+
+type Config struct {
+	Mode string
+	// Origins are allowed in Origin or Referer header of unsafe requests, e.g. "https://example.com".
+	Origins []string
+	// Exempt paths are not checked, "/prefix/*" matches all subpaths.
+	Exempt []string
+}
+
+// Protection checks unsafe requests. Requests with Bearer authorization and without
+// the session cookie are not checked, as browsers never attach the header on their own.
+// Other schemes, e.g. Basic, are cached and attached by browsers, so they are checked.
+type Protection struct {
+	cfg        Config
+	origins    map[string]bool
+	uc         *csrf_uc.UseCase
+	sessCookie *http.SessionCookie
+	cookieName string
+	policy     http.CookiePolicy
+	l          log.Logger
+}
+
+// New creates protection, double submit cookie takes attributes from the session cookie policy.
+func New(cfg Config, uc *csrf_uc.UseCase, sessCookie *http.SessionCookie, l log.Logger) (*Protection, error) {
+	if cfg.Mode != ModeSynchronizer && cfg.Mode != ModeDoubleSubmit {
+		return nil, errors.Errorf("unknown csrf mode \"%s\"", cfg.Mode)
+	}
+	origins := make(map[string]bool, len(cfg.Origins))
+	for _, origin := range cfg.Origins {
+		origins[normalizeOrigin(origin)] = true
+	}
+
+	cookieName := CookieName
+	if sessCookie.Policy.Secure && sessCookie.Policy.Domain == "" {
+		cookieName = http.CookiePrefixHost + CookieName
+	} else if sessCookie.Policy.Secure {
+		cookieName = http.CookiePrefixSecure + CookieName
+	}
+	policy := sessCookie.Policy
+	policy.Path = "/"
+	policy.MaxAge = 0
+
+	return &Protection{
+		cfg:        cfg,
+		origins:    origins,
+		uc:         uc,
+		sessCookie: sessCookie,
+		cookieName: cookieName,
+		policy:     policy,
+		l:          l,
+	}, nil
+}
+
+func (p *Protection) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		reason := p.check(fiberRequest{c: c, sessCookie: p.sessCookie})
+		if reason != "" {
+			return reject(c, reason)
+		}
+		return c.Next()
+	}
+}
+
+// CheckHTTP is Middleware for net/http handlers, the failure response is written when false
+// is returned. Only url-encoded form bodies are read for the form token, the body is restored
+// for the following handler.
+func (p *Protection) CheckHTTP(w nethttp.ResponseWriter, r *nethttp.Request) bool {
+	reason := p.check(&stdRequest{r: r, sessCookie: p.sessCookie})
+	if reason != "" {
+		http.WriteJSON(w, nethttp.StatusForbidden, ForbiddenBody(reason))
+		return false
+	}
+	return true
+}
+
+// check returns the reason the request is rejected for or empty string.
+func (p *Protection) check(req request) string {
+	path := req.path()
+	if isSafeMethod(req.method()) || p.isExempt(path) || p.isBearerOnly(req) {
+		return ""
+	}
+	if origin := req.origin(); !p.isOriginAllowed(origin) {
+		p.l.Warnf("csrf check failed on %s: origin %s is not allowed", path, origin)
+		return ReasonOrigin
+	}
+
+	token := req.header(HeaderName)
+	if token == "" {
+		token = req.formValue(FormField)
+	}
+	switch p.cfg.Mode {
+	case ModeSynchronizer:
+		err := p.uc.Verify(req.context(), req.sessionId(), token)
+		if err != nil {
+			p.l.WithError(err).Warnf("csrf check failed on %s", path)
+			return ReasonToken
+		}
+	default:
+		cookie := req.cookie(p.cookieName)
+		if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(token)) != 1 {
+			p.l.Warnf("csrf check failed on %s: token doesn't match cookie", path)
+			return ReasonToken
+		}
+		if !isBound(token, req.sessionId()) {
+			p.l.Warnf("csrf check failed on %s: token is not bound to the session", path)
+			return ReasonToken
+		}
+	}
+	return ""
+}
+
+func (p *Protection) isBearerOnly(req request) bool {
+	scheme, _, _ := strings.Cut(req.header(fiber.HeaderAuthorization), " ")
+	return strings.EqualFold(scheme, "Bearer") && req.sessionId() == ""
+}
+
+// TokenHandler returns the token to send in X-CSRF-Token header.
+func (p *Protection) TokenHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if p.cfg.Mode == ModeDoubleSubmit {
+			sessId := p.sessCookie.Get(c)
+			if sessId == "" {
+				p.l.Warnf("csrf token is not issued: session cookie is missing")
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnauthorized)
+			}
+			token := http.GetCookie(c, p.cookieName)
+			if !isBound(token, sessId) {
+				var err error
+				token, err = newBoundToken(sessId)
+				if err != nil {
+					p.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
+				}
+				http.SetCookie(c, p.cookieName, token, p.policy)
+			}
+			return c.JSON(&fiber.Map{"token": token, "header": HeaderName})
+		}
+
+		sessId := p.sessCookie.Get(c)
+		token, sess, err := p.uc.Token(c.Context(), sessId)
+		if err != nil {
+			p.l.WithError(err).Warnf("csrf token is not issued")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnauthorized)
+		}
+		if sess.Id != sessId {
+			err = p.sessCookie.Set(c, sess.Id)
+			if err != nil {
+				p.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
+			}
+		}
+		return c.JSON(&fiber.Map{"token": token, "header": HeaderName})
+	}
+}
+
+// newBoundToken returns "<nonce>.<mac>", mac is HMAC of the nonce keyed by the session id,
+// which is unknown to other sites.
+func newBoundToken(sessId string) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate csrf token")
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	return nonce + "." + bindingMac(nonce, sessId), nil
+}
+
+func isBound(token string, sessId string) bool {
+	nonce, mac, ok := strings.Cut(token, ".")
+	if !ok || sessId == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(mac), []byte(bindingMac(nonce, sessId))) == 1
+}
+
+func bindingMac(nonce string, sessId string) string {
+	h := hmac.New(sha256.New, []byte(sessId))
+	h.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (p *Protection) isExempt(path string) bool {
+	for _, exempt := range p.cfg.Exempt {
+		if prefix, ok := strings.CutSuffix(exempt, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == exempt {
+			return true
+		}
+	}
+	return false
+}
+
+// isOriginAllowed checks Origin or Referer, requests without both are left to the token check.
+func (p *Protection) isOriginAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	return p.origins[normalizeOrigin(origin)]
+}
+
+// requestOrigin returns Origin header or origin of Referer header.
+func requestOrigin(header func(name string) string) string {
+	if origin := header(fiber.HeaderOrigin); origin != "" {
+		return origin
+	}
+	referer := header(fiber.HeaderReferer)
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return "null"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(origin), "/")
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// reject responds with html page to browser navigation, e.g. form submit, and with json otherwise.
+func reject(c *fiber.Ctx, reason string) error {
+	c.Status(fiber.StatusForbidden)
+	if c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML {
+		c.Type("html")
+		return c.SendString("<!DOCTYPE html><html><head><title>Forbidden</title></head>" +
+			"<body><h1>Forbidden</h1><p>The request can't be verified, reload the page and try again.</p></body></html>")
+	}
+	return c.JSON(ForbiddenBody(reason))
+}
+
+// ForbiddenBody is the 403 response body of a rejected request.
+func ForbiddenBody(reason string) *fiber.Map {
+	return &fiber.Map{
+		"code":    fiber.StatusForbidden,
+		"message": "csrf check failed",
+		"reason":  reason,
+	}
+}
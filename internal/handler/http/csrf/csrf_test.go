@@ -0,0 +1,137 @@
+package csrf
+
+import (
+	"context"
+	"encoding/json"
+	"myoidc/internal/handler/http"
+	"myoidc/internal/service/session/inmemory"
+	csrf_uc "myoidc/internal/usecase/csrf"
+	"myoidc/pkg/log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestApp(t *testing.T, mode string) (*fiber.App, *inmemory.Manager) {
+	sm := inmemory.NewManager()
+	sessCookie := http.NewSessionCookie("sessId", http.DefaultCookiePolicy(), nil)
+	p, err := New(Config{
+		Mode:    mode,
+		Origins: []string{"https://myoidc.test"},
+		Exempt:  []string{"/hooks/*"},
+	}, csrf_uc.NewUseCase(sm), sessCookie, log.GetDefault())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(p.Middleware())
+	app.Get("/csrf", p.TokenHandler())
+	app.Post("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	return app, sm
+}
+
+func fetchToken(t *testing.T, app *fiber.App, cookie string) string {
+	req := httptest.NewRequest("GET", "/csrf", nil)
+	req.Header.Set("Cookie", cookie)
+	res, err := app.Test(req)
+	if !assert.NoError(t, err) || !assert.Equal(t, fiber.StatusOK, res.StatusCode) {
+		return ""
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	return body.Token
+}
+
+func TestProtection(t *testing.T) {
+	app, sm := newTestApp(t, ModeSynchronizer)
+	sess, _ := sm.Create(context.TODO(), "123", nil)
+	cookie := "sessId=" + sess.Id
+	token := fetchToken(t, app, cookie)
+	assert.NotEmpty(t, token, "token is not issued")
+	assert.Equal(t, token, fetchToken(t, app, cookie), "token is not kept in session")
+
+	tests := []struct {
+		name     string
+		path     string
+		header   map[string]string
+		expected int
+	}{
+		{name: "valid token", path: "/logout", header: map[string]string{"Cookie": cookie, HeaderName: token}, expected: fiber.StatusNoContent},
+		{name: "missing token", path: "/logout", header: map[string]string{"Cookie": cookie}, expected: fiber.StatusForbidden},
+		{name: "invalid token", path: "/logout", header: map[string]string{"Cookie": cookie, HeaderName: "other"}, expected: fiber.StatusForbidden},
+		{name: "another session", path: "/logout", header: map[string]string{HeaderName: token}, expected: fiber.StatusForbidden},
+		{name: "trusted origin", path: "/logout", header: map[string]string{"Cookie": cookie, HeaderName: token, "Origin": "https://myoidc.test"}, expected: fiber.StatusNoContent},
+		{name: "foreign origin", path: "/logout", header: map[string]string{"Cookie": cookie, HeaderName: token, "Origin": "https://evil.test"}, expected: fiber.StatusForbidden},
+		{name: "foreign referer", path: "/logout", header: map[string]string{"Cookie": cookie, HeaderName: token, "Referer": "https://evil.test/page"}, expected: fiber.StatusForbidden},
+		{name: "exempt route", path: "/hooks/logout", expected: fiber.StatusNoContent},
+		{name: "bearer auth", path: "/logout", header: map[string]string{"Authorization": "Bearer token"}, expected: fiber.StatusNoContent},
+		{name: "bearer auth with session cookie", path: "/logout", header: map[string]string{"Cookie": cookie, "Authorization": "Bearer token"}, expected: fiber.StatusForbidden},
+		{name: "basic auth", path: "/logout", header: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, expected: fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, nil)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		res, err := app.Test(req)
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expected, res.StatusCode, tt.name)
+		}
+	}
+}
+
+func TestProtection_DoubleSubmit(t *testing.T) {
+	app, sm := newTestApp(t, ModeDoubleSubmit)
+	sess, _ := sm.Create(context.TODO(), "123", nil)
+	sessCookie := "sessId=" + sess.Id
+
+	res, err := app.Test(httptest.NewRequest("GET", "/csrf", nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, fiber.StatusUnauthorized, res.StatusCode, "token is issued without session")
+	}
+	req := httptest.NewRequest("GET", "/csrf", nil)
+	req.Header.Set("Cookie", sessCookie)
+	res, err = app.Test(req)
+	if !assert.NoError(t, err) || !assert.Len(t, res.Cookies(), 1) {
+		return
+	}
+	token := res.Cookies()[0].Value
+	cookie := sessCookie + "; " + CookieName + "=" + token
+	assert.Equal(t, token, fetchToken(t, app, cookie), "cookie token is not reused")
+
+	post := func(cookie string, token string) int {
+		req := httptest.NewRequest("POST", "/logout", nil)
+		req.Header.Set("Cookie", cookie)
+		req.Header.Set(HeaderName, token)
+		res, err := app.Test(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		return res.StatusCode
+	}
+	assert.Equal(t, fiber.StatusNoContent, post(cookie, token), "valid token is rejected")
+
+	// a sibling domain plants the token of the attacker session next to the victim session
+	attacker, _ := sm.Create(context.TODO(), "666", nil)
+	tossed := fetchToken(t, app, "sessId="+attacker.Id)
+	assert.Equal(t, fiber.StatusForbidden, post(sessCookie+"; "+CookieName+"="+tossed, tossed), "token of another session is accepted")
+	assert.Equal(t, fiber.StatusForbidden, post(sessCookie+"; "+CookieName+"=forged", "forged"), "unbound token is accepted")
+
+	req = httptest.NewRequest("POST", "/logout", strings.NewReader(FormField+"=other"))
+	req.Header.Set("Cookie", cookie)
+	req.Header.Set("Content-Type", fiber.MIMEApplicationForm)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	res, err = app.Test(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, fiber.StatusForbidden, res.StatusCode, "invalid form token is accepted")
+		assert.Contains(t, res.Header.Get("Content-Type"), "text/html", "browser gets json error")
+	}
+}
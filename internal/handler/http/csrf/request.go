@@ -0,0 +1,93 @@
+package csrf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"myoidc/internal/handler/http"
+	"myoidc/internal/handler/http/authz"
+	nethttp "net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxFormSize limits url-encoded bodies read by net/http check, larger forms must send the header.
+const maxFormSize = 1 << 20
+
+// request is a request being checked, implemented for fiber and net/http handlers.
+type request interface {
+	method() string
+	path() string
+	header(name string) string
+	cookie(name string) string
+	formValue(name string) string
+	origin() string
+	sessionId() string
+	context() context.Context
+}
+
+type fiberRequest struct {
+	c          *fiber.Ctx
+	sessCookie *http.SessionCookie
+}
+
+func (req fiberRequest) method() string { return req.c.Method() }
+
+func (req fiberRequest) path() string { return authz.CleanPath(req.c.Path()) }
+
+func (req fiberRequest) header(name string) string { return req.c.Get(name) }
+
+func (req fiberRequest) cookie(name string) string { return http.GetCookie(req.c, name) }
+
+func (req fiberRequest) formValue(name string) string { return req.c.FormValue(name) }
+
+func (req fiberRequest) origin() string { return requestOrigin(req.header) }
+
+func (req fiberRequest) sessionId() string { return req.sessCookie.Get(req.c) }
+
+func (req fiberRequest) context() context.Context { return req.c.Context() }
+
+type stdRequest struct {
+	r          *nethttp.Request
+	sessCookie *http.SessionCookie
+}
+
+func (req *stdRequest) method() string { return req.r.Method }
+
+func (req *stdRequest) path() string { return authz.CleanPath(req.r.URL.Path) }
+
+func (req *stdRequest) header(name string) string { return req.r.Header.Get(name) }
+
+func (req *stdRequest) cookie(name string) string {
+	cookie, err := req.r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// formValue reads url-encoded body and puts it back, so it is still passed to upstream.
+func (req *stdRequest) formValue(name string) string {
+	mediaType, _, _ := mime.ParseMediaType(req.r.Header.Get("Content-Type"))
+	if mediaType != fiber.MIMEApplicationForm || req.r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(req.r.Body, maxFormSize+1))
+	req.r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.r.Body))
+	if err != nil || len(body) > maxFormSize {
+		return ""
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return form.Get(name)
+}
+
+func (req *stdRequest) origin() string { return requestOrigin(req.header) }
+
+func (req *stdRequest) sessionId() string { return req.sessCookie.GetHTTP(req.r) }
+
+func (req *stdRequest) context() context.Context { return req.r.Context() }
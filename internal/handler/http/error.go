@@ -7,5 +7,10 @@ import (
 )
 
 func UnexpectedErrorMessage(c *fiber.Ctx) string {
-	return fmt.Sprintf("Unexpected error while performing action %s", c.Path())
+	return UnexpectedPathErrorMessage(c.Path())
+}
+
+// UnexpectedPathErrorMessage is UnexpectedErrorMessage for handlers without fiber context.
+func UnexpectedPathErrorMessage(path string) string {
+	return fmt.Sprintf("Unexpected error while performing action %s", path)
 }
@@ -0,0 +1,169 @@
+// Package forwardauth answers auth subrequests of ingress proxies, e.g. nginx auth_request,
+// Traefik forwardAuth and Envoy ext_authz, the proxy forwards allowed requests itself.
+package forwardauth
+
+import (
+	"myoidc/internal/handler/http"
+	"myoidc/internal/handler/http/auth"
+	"myoidc/internal/handler/http/authz"
+	"myoidc/internal/service/identity"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/log"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExtAuthzPrefix is the path prefix of Envoy ext_authz requests, it must be set as path_prefix
+// of the http service, so the original path follows it.
+const ExtAuthzPrefix = "/oauth/ext_authz"
+
+// Headers describing the original request, set by nginx config and by Traefik.
+const (
+	HeaderOriginalURL     = "X-Original-URL"
+	HeaderOriginalMethod  = "X-Original-Method"
+	HeaderForwardedUri    = "X-Forwarded-Uri"
+	HeaderForwardedHost   = "X-Forwarded-Host"
+	HeaderForwardedProto  = "X-Forwarded-Proto"
+	HeaderForwardedMethod = "X-Forwarded-Method"
+)
+
+type Config struct {
+	// BaseURL of myoidc, login url is built from it, as the browser is on the protected app host.
+	BaseURL string
+	// HeaderPrefix of identity headers, auth.DefaultHeaderPrefix if empty.
+	HeaderPrefix      string
+	PassAccessToken   bool
+	PassIdentityToken bool
+}
+
+// Handler replies 200 with identity headers to allowed requests, the proxy copies them to the
+// upstream request. Unauthenticated requests get 401 with the login url in Location header,
+// which returns the browser to the original url. Requests with dot segments in the original
+// path get 403, as the upstream may resolve them differently from the rules.
+//
+// The session cookie may be reissued in Set-Cookie of the 200 reply, e.g. by the "cookie"
+// session store on access, and the proxy must pass it to the client: nginx by
+// "auth_request_set $auth_cookie $upstream_http_set_cookie; add_header Set-Cookie $auth_cookie;",
+// Traefik by addAuthCookiesToResponse and Envoy by allowed_client_headers_on_success.
+type Handler struct {
+	cfg         Config
+	requireAuth *auth.RequireAuth
+	rules       *authz.Rules
+	issuer      *identity.TokenIssuer
+	l           log.Logger
+}
+
+// New creates handler, issuer is required when identity token is passed only.
+func New(cfg Config, requireAuth *auth.RequireAuth, rules *authz.Rules, issuer *identity.TokenIssuer, l log.Logger) (*Handler, error) {
+	if cfg.HeaderPrefix == "" {
+		cfg.HeaderPrefix = auth.DefaultHeaderPrefix
+	}
+	if cfg.PassIdentityToken && issuer == nil {
+		return nil, errors.Error("forward auth passes identity token, but identity token keys are not configured")
+	}
+	return &Handler{
+		cfg:         cfg,
+		requireAuth: requireAuth,
+		rules:       rules,
+		issuer:      issuer,
+		l:           l,
+	}, nil
+}
+
+// Handler serves nginx auth_request and Traefik forwardAuth, the original request is taken from
+// X-Original-URL or X-Forwarded-Uri and X-Forwarded-Host headers. Unauthenticated requests get
+// 401 rather than a redirect, as nginx treats statuses other than 2xx, 401 and 403 as errors.
+func (h *Handler) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return h.check(c, originalMethod(c), originalURL(c), false)
+	}
+}
+
+// ExtAuthzHandler serves Envoy ext_authz http service, the original request is the request
+// itself under ExtAuthzPrefix. Envoy sends denied responses to the client, so browsers are
+// redirected to login right away.
+func (h *Handler) ExtAuthzHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		uri := strings.TrimPrefix(c.OriginalURL(), ExtAuthzPrefix)
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/" + uri
+		}
+		proto := c.Get(HeaderForwardedProto, c.Protocol())
+		original, err := url.Parse(proto + "://" + string(c.Request().Host()) + uri)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.ErrBadRequest)
+		}
+		return h.check(c, c.Method(), original, true)
+	}
+}
+
+func (h *Handler) check(c *fiber.Ctx, method string, original *url.URL, redirect bool) error {
+	id, fail := h.requireAuth.Identify(c)
+	if fail != nil {
+		if fail.Status != fiber.StatusUnauthorized {
+			return c.Status(fail.Status).JSON(fail.Body)
+		}
+		loginUrl := h.cfg.BaseURL + h.requireAuth.LoginURL(original.String())
+		if redirect && c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML {
+			return c.Redirect(loginUrl, fiber.StatusFound)
+		}
+		c.Set(fiber.HeaderLocation, loginUrl)
+		return c.Status(fiber.StatusUnauthorized).JSON(fail.Body)
+	}
+
+	if authz.HasDotSegments(original.Path) {
+		h.l.Warnf("forward auth request to %q is rejected: path has dot segments", original.Path)
+		return c.Status(fiber.StatusForbidden).JSON(authz.ForbiddenBody(authz.ReasonInvalidPath))
+	}
+	if !h.rules.Allowed(method, authz.CleanPath(original.Path), id) {
+		return c.Status(fiber.StatusForbidden).JSON(authz.ForbiddenBody(authz.ReasonMissingPermission))
+	}
+
+	for name, value := range id.Headers(h.cfg.HeaderPrefix) {
+		c.Set(name, value)
+	}
+	if h.cfg.PassAccessToken {
+		c.Set(h.cfg.HeaderPrefix+auth.HeaderAccessToken, id.AccessToken)
+	}
+	if h.cfg.PassIdentityToken {
+		audience := original.Scheme + "://" + original.Host
+		token, err := h.issuer.Issue(id.Session.UserId, id.User, id.Session.ProviderName, audience)
+		if err != nil {
+			h.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
+		}
+		c.Set(h.cfg.HeaderPrefix+auth.HeaderIdentity, token)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func originalMethod(c *fiber.Ctx) string {
+	if method := c.Get(HeaderForwardedMethod); method != "" {
+		return method
+	}
+	return c.Get(HeaderOriginalMethod, fiber.MethodGet)
+}
+
+// originalURL returns url of the protected request, host of this request is used when
+// the proxy doesn't pass one.
+func originalURL(c *fiber.Ctx) *url.URL {
+	proto := c.Get(HeaderForwardedProto, c.Protocol())
+	host := c.Get(HeaderForwardedHost, string(c.Request().Host()))
+	if raw := c.Get(HeaderOriginalURL); raw != "" {
+		u, err := url.Parse(raw)
+		if err == nil {
+			if u.Host == "" {
+				u.Scheme, u.Host = proto, host
+			}
+			return u
+		}
+	}
+	uri := c.Get(HeaderForwardedUri, "/")
+	u, err := url.Parse(proto + "://" + host + uri)
+	if err != nil {
+		return &url.URL{Scheme: proto, Host: host, Path: "/"}
+	}
+	return u
+}
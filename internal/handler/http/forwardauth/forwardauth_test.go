@@ -0,0 +1,143 @@
+package forwardauth
+
+import (
+	"bytes"
+	"context"
+	"myoidc/internal/domain"
+	"myoidc/internal/handler/http"
+	"myoidc/internal/handler/http/auth"
+	"myoidc/internal/handler/http/authz"
+	oidccli "myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/event"
+	"myoidc/internal/service/session/inmemory"
+	"myoidc/internal/service/session/stateless"
+	"myoidc/internal/usecase/oidc/userinfo"
+	"myoidc/pkg/keyring"
+	"myoidc/pkg/log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type testClient struct {
+	oidccli.Client
+}
+
+func (testClient) FetchUserByToken(ctx context.Context, token *oidccli.Token) (*domain.User, error) {
+	return &domain.User{Id: "123", Login: "user", Permissions: []string{"billing:read"}}, nil
+}
+
+func TestHandler(t *testing.T) {
+	sm := inmemory.NewManager()
+	reg := oidccli.MapClientRegistry{"myoidc": testClient{}}
+	cookie := http.NewSessionCookie("sessId", http.DefaultCookiePolicy(), nil)
+	requireAuth := auth.NewRequireAuth(auth.Config{ProviderName: "myoidc"}, userinfo.NewUseCase(reg, sm, event.Discard, 0), cookie, log.GetDefault())
+	rules, _ := authz.NewRules([]authz.Rule{
+		{Path: "/admin/*", Requirement: authz.Requirement{AllOf: []string{"admin"}}},
+	}, log.GetDefault())
+	h, err := New(Config{BaseURL: "https://auth.myoidc.test"}, requireAuth, rules, nil, log.GetDefault())
+	if !assert.NoError(t, err) {
+		return
+	}
+	app := fiber.New()
+	app.All("/oauth/auth", h.Handler())
+	app.All(ExtAuthzPrefix+"/*", h.ExtAuthzHandler())
+
+	sess, _ := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{ProviderName: "myoidc", AccessToken: "ACCESS_TOKEN"}))
+	loginUrl := func(backUrl string) string {
+		return "https://auth.myoidc.test/oauth/login?" + url.Values{"providerName": {"myoidc"}, "backUrl": {backUrl}}.Encode()
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   map[string]string
+		expected int
+		location string
+		user     string
+	}{
+		{name: "traefik without session", method: "GET", path: "/oauth/auth",
+			header:   map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.myoidc.test", "X-Forwarded-Uri": "/page?tab=1", "Accept": "text/html"},
+			expected: fiber.StatusUnauthorized, location: loginUrl("https://app.myoidc.test/page?tab=1")},
+		{name: "nginx without session", method: "GET", path: "/oauth/auth",
+			header:   map[string]string{"X-Original-URL": "https://app.myoidc.test/page"},
+			expected: fiber.StatusUnauthorized, location: loginUrl("https://app.myoidc.test/page")},
+		{name: "with session", method: "GET", path: "/oauth/auth",
+			header:   map[string]string{"Cookie": "sessId=" + sess.Id, "X-Original-URL": "https://app.myoidc.test/page"},
+			expected: fiber.StatusOK, user: "123"},
+		{name: "missing permission", method: "GET", path: "/oauth/auth",
+			header:   map[string]string{"Cookie": "sessId=" + sess.Id, "X-Forwarded-Uri": "/admin/users"},
+			expected: fiber.StatusForbidden},
+		{name: "envoy browser without session", method: "GET", path: ExtAuthzPrefix + "/page",
+			header:   map[string]string{"Accept": "text/html"},
+			expected: fiber.StatusFound, location: loginUrl("http://example.com/page")},
+		{name: "envoy api without session", method: "POST", path: ExtAuthzPrefix + "/api/items",
+			expected: fiber.StatusUnauthorized, location: loginUrl("http://example.com/api/items")},
+		{name: "envoy with session", method: "POST", path: ExtAuthzPrefix + "/api/items",
+			header:   map[string]string{"Cookie": "sessId=" + sess.Id},
+			expected: fiber.StatusOK, user: "123"},
+		{name: "envoy missing permission", method: "GET", path: ExtAuthzPrefix + "/admin/users",
+			header:   map[string]string{"Cookie": "sessId=" + sess.Id},
+			expected: fiber.StatusForbidden},
+		{name: "dot segments", method: "GET", path: "/oauth/auth",
+			header:   map[string]string{"Cookie": "sessId=" + sess.Id, "X-Forwarded-Uri": "/page/../admin/users"},
+			expected: fiber.StatusForbidden},
+		{name: "encoded dot segments", method: "GET", path: "/oauth/auth",
+			header:   map[string]string{"Cookie": "sessId=" + sess.Id, "X-Original-URL": "https://app.myoidc.test/page/%2e%2e/admin/users"},
+			expected: fiber.StatusForbidden},
+		{name: "repeated slashes", method: "GET", path: "/oauth/auth",
+			header:   map[string]string{"Cookie": "sessId=" + sess.Id, "X-Forwarded-Uri": "//admin//users"},
+			expected: fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		res, err := app.Test(req)
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expected, res.StatusCode, tt.name)
+			assert.Equal(t, tt.location, res.Header.Get("Location"), tt.name)
+			assert.Equal(t, tt.user, res.Header.Get("X-Auth-Request-User"), tt.name)
+		}
+	}
+}
+
+func TestHandler_ReissuedCookie(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys, _ := keyring.New("k1", keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	sm := stateless.NewManager(keys, session.WithClock(func() time.Time { return now }))
+	reg := oidccli.MapClientRegistry{"myoidc": testClient{}}
+	cookie := http.NewSessionCookie("sessId", http.DefaultCookiePolicy(), nil)
+	requireAuth := auth.NewRequireAuth(auth.Config{ProviderName: "myoidc"}, userinfo.NewUseCase(reg, sm, event.Discard, 0), cookie, log.GetDefault())
+	rules, _ := authz.NewRules(nil, log.GetDefault())
+	h, err := New(Config{BaseURL: "https://auth.myoidc.test"}, requireAuth, rules, nil, log.GetDefault())
+	if !assert.NoError(t, err) {
+		return
+	}
+	app := fiber.New()
+	app.All("/oauth/auth", h.Handler())
+
+	sess, err := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{ProviderName: "myoidc", AccessToken: "ACCESS_TOKEN"}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the cookie store reissues the session on access after a while
+	now = now.Add(10 * time.Minute)
+	req := httptest.NewRequest("GET", "/oauth/auth", nil)
+	req.Header.Set("Cookie", "sessId="+sess.Id)
+	req.Header.Set("X-Original-URL", "https://app.myoidc.test/page")
+	res, err := app.Test(req)
+	if assert.NoError(t, err) && assert.Equal(t, fiber.StatusOK, res.StatusCode) {
+		if assert.Len(t, res.Cookies(), 1, "reissued session is not in the auth reply") {
+			assert.Equal(t, "sessId", res.Cookies()[0].Name)
+			assert.NotEqual(t, sess.Id, res.Cookies()[0].Value, "session is not reissued")
+		}
+	}
+}
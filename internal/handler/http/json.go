@@ -0,0 +1,13 @@
+package http
+
+import (
+	"encoding/json"
+	nethttp "net/http"
+)
+
+// WriteJSON responds from net/http handlers with the same json bodies as fiber ones.
+func WriteJSON(w nethttp.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -2,6 +2,7 @@ package oidc
 
 import (
 	"myoidc/internal/handler/http"
+	"myoidc/internal/service/session"
 	"myoidc/internal/usecase"
 	"myoidc/internal/usecase/oidc/callback"
 	"myoidc/pkg/errors"
@@ -11,17 +12,30 @@ import (
 )
 
 type CallbackHandler struct {
-	uc *callback.UseCase
-	l  log.Logger
+	uc       *callback.UseCase
+	cookie   *http.SessionCookie
+	txCookie *http.TransactionCookie
+	l        log.Logger
 }
 
-func NewCallbackHandler(uc *callback.UseCase, l log.Logger) *CallbackHandler {
+func NewCallbackHandler(uc *callback.UseCase, cookie *http.SessionCookie, txCookie *http.TransactionCookie, l log.Logger) *CallbackHandler {
 	return &CallbackHandler{
-		uc: uc,
-		l:  l,
+		uc:       uc,
+		cookie:   cookie,
+		txCookie: txCookie,
+		l:        l,
 	}
 }
 
+// loginExpired asks the user to start login again, the callback can't be completed
+// without the transaction started by this browser.
+func loginExpired(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(&fiber.Map{
+		"code":    fiber.StatusUnauthorized,
+		"message": "login transaction is missing or expired, start login again",
+	})
+}
+
 func (h *CallbackHandler) Handler() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		providerName := c.Query("providerName")
@@ -36,11 +50,12 @@ func (h *CallbackHandler) Handler() fiber.Handler {
 				"message": "code is missing",
 			})
 		}
-		sessId := c.Query("token")
-		if sessId == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
-				"message": "token is missing",
-			})
+		binding := h.txCookie.Get(c)
+		// transaction is single use, the cookie is dropped whatever the result is
+		h.txCookie.Del(c)
+		if binding == "" {
+			h.l.Warnf("oidc login transaction cookie is missing")
+			return loginExpired(c)
 		}
 		state := c.Query("state")
 		if state == "" {
@@ -49,7 +64,10 @@ func (h *CallbackHandler) Handler() fiber.Handler {
 			})
 		}
 
-		res, err := h.uc.Execute(c.Context(), providerName, code, state, sessId)
+		res, err := h.uc.Execute(c.Context(), providerName, code, state, binding, session.ClientInfo{
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+		})
 		if err != nil {
 			switch errors.GetErrCode(err) {
 			case usecase.ErrCodeEntityNotFound:
@@ -58,16 +76,30 @@ func (h *CallbackHandler) Handler() fiber.Handler {
 			case usecase.ErrCodeInvalidCredentials:
 				h.l.WithError(err).Warnf("oidc login failed with invalid credentials error")
 				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.ErrUnprocessableEntity)
+			case usecase.ErrCodeLoginExpired:
+				h.l.WithError(err).Warnf("oidc login transaction is expired")
+				return loginExpired(c)
 			case usecase.ErrCodeUserUnauthorized:
 				h.l.WithError(err).Warnf("oidc login error")
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnauthorized)
+			case usecase.ErrCodeForbidden:
+				h.l.WithError(err).Warnf("oidc login is rejected")
+				return c.Status(fiber.StatusForbidden).JSON(&fiber.Map{
+					"code":    fiber.StatusForbidden,
+					"message": "too many active sessions, log out on another device",
+					"reason":  session.ReasonSessionLimit,
+				})
 			default:
 				h.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
 			}
 		}
 
-		http.SetCookie(c, http.CookieSessionId, res.Session.Id)
+		err = h.cookie.Set(c, res.Session.Id)
+		if err != nil {
+			h.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
+		}
 		return c.Redirect(res.RedirectURL, 302)
 	}
 }
@@ -2,25 +2,36 @@ package oidc
 
 import (
 	"myoidc/internal/handler/http"
+	"myoidc/internal/service/session"
 	"myoidc/internal/usecase"
 	"myoidc/internal/usecase/oidc/login"
 	"myoidc/pkg/errors"
 	"myoidc/pkg/log"
+	"net/url"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-var defaultScopes = []string{"openid", "profile", "email", "phone", "address"}
-
 type LoginHandler struct {
-	useCase *login.UseCase
-	logger  log.Logger
+	useCase       *login.UseCase
+	txCookie      *http.TransactionCookie
+	redirectHosts map[string]bool
+	logger        log.Logger
 }
 
-func NewLoginHandler(useCase *login.UseCase, logger log.Logger) *LoginHandler {
+// NewLoginHandler creates handler returning the browser to local paths or to urls of redirectHosts,
+// e.g. apps protected by forward auth.
+func NewLoginHandler(useCase *login.UseCase, txCookie *http.TransactionCookie, redirectHosts []string, logger log.Logger) *LoginHandler {
+	hosts := make(map[string]bool, len(redirectHosts))
+	for _, host := range redirectHosts {
+		hosts[strings.ToLower(host)] = true
+	}
 	return &LoginHandler{
-		useCase: useCase,
-		logger:  logger,
+		useCase:       useCase,
+		txCookie:      txCookie,
+		redirectHosts: hosts,
+		logger:        logger,
 	}
 }
 
@@ -33,9 +44,8 @@ func (h *LoginHandler) Handler() fiber.Handler {
 			})
 		}
 
-		authUrl, err := h.useCase.Execute(c.Context(), providerName, defaultScopes, map[string]interface{}{
-			//"backUrl": c.Get("Referer"),
-			"backUrl": "/",
+		res, err := h.useCase.Execute(c.Context(), providerName, nil, session.LoginTransaction{
+			BackUrl: h.backUrl(c.Query("backUrl")),
 		})
 		if err != nil {
 			switch errors.GetErrCode(err) {
@@ -50,6 +60,24 @@ func (h *LoginHandler) Handler() fiber.Handler {
 			}
 		}
 
-		return c.Redirect(authUrl.String(), 302)
+		h.txCookie.Set(c, res.Binding)
+		return c.Redirect(res.AuthURL.String(), 302)
+	}
+}
+
+// backUrl returns backUrl if it is a path of this site or an url of redirect hosts, so login
+// can't redirect to a foreign site, and "/" otherwise.
+func (h *LoginHandler) backUrl(backUrl string) string {
+	u, err := url.Parse(backUrl)
+	if err != nil {
+		return "/"
+	}
+	if u.Scheme == "" && u.Host == "" && strings.HasPrefix(backUrl, "/") &&
+		!strings.HasPrefix(backUrl, "//") && !strings.HasPrefix(backUrl, "/\\") {
+		return backUrl
+	}
+	if (u.Scheme == "https" || u.Scheme == "http") && h.redirectHosts[strings.ToLower(u.Hostname())] {
+		return backUrl
 	}
+	return "/"
 }
@@ -0,0 +1,30 @@
+package oidc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginHandler_BackUrl(t *testing.T) {
+	h := NewLoginHandler(nil, nil, []string{"App.myoidc.test"}, nil)
+	tests := []struct {
+		backUrl  string
+		expected string
+	}{
+		{backUrl: "", expected: "/"},
+		{backUrl: "/app/page?tab=1", expected: "/app/page?tab=1"},
+		{backUrl: "https://evil.test/", expected: "/"},
+		{backUrl: "//evil.test/", expected: "/"},
+		{backUrl: "/\\evil.test/", expected: "/"},
+		{backUrl: "/\t/evil.test/", expected: "/"},
+		{backUrl: "app/page", expected: "/"},
+		{backUrl: "https://app.myoidc.test/page", expected: "https://app.myoidc.test/page"},
+		{backUrl: "https://app.myoidc.test:8443/page", expected: "https://app.myoidc.test:8443/page"},
+		{backUrl: "javascript://app.myoidc.test/%0aalert(1)", expected: "/"},
+		{backUrl: "https://app.myoidc.test.evil.test/", expected: "/"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, h.backUrl(tt.backUrl), tt.backUrl)
+	}
+}
@@ -0,0 +1,39 @@
+package oidc
+
+import (
+	"myoidc/internal/handler/http"
+	"myoidc/internal/usecase/oidc/logout"
+	"myoidc/pkg/log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LogoutHandler struct {
+	uc     *logout.UseCase
+	cookie *http.SessionCookie
+	l      log.Logger
+}
+
+func NewLogoutHandler(uc *logout.UseCase, cookie *http.SessionCookie, l log.Logger) *LogoutHandler {
+	return &LogoutHandler{
+		uc:     uc,
+		cookie: cookie,
+		l:      l,
+	}
+}
+
+func (h *LogoutHandler) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sessId := h.cookie.Get(c)
+		// cookie is cleared even if session can't be destroyed
+		h.cookie.Del(c)
+
+		err := h.uc.Execute(c.Context(), sessId)
+		if err != nil {
+			h.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -2,6 +2,7 @@ package oidc
 
 import (
 	"myoidc/internal/handler/http"
+	"myoidc/internal/service/session"
 	"myoidc/internal/usecase"
 	"myoidc/internal/usecase/oidc/userinfo"
 	"myoidc/pkg/errors"
@@ -11,25 +12,27 @@ import (
 )
 
 type UserInfoHandler struct {
-	uc *userinfo.UseCase
-	l  log.Logger
+	uc     *userinfo.UseCase
+	cookie *http.SessionCookie
+	l      log.Logger
 }
 
-func NewUserInfoHandler(uc *userinfo.UseCase, l log.Logger) *UserInfoHandler {
+func NewUserInfoHandler(uc *userinfo.UseCase, cookie *http.SessionCookie, l log.Logger) *UserInfoHandler {
 	return &UserInfoHandler{
-		uc: uc,
-		l:  l,
+		uc:     uc,
+		cookie: cookie,
+		l:      l,
 	}
 }
 
 func (h *UserInfoHandler) Handler() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		sessId := http.GetCookie(c, http.CookieSessionId)
+		sessId := h.cookie.Get(c)
 
-		user, err := h.uc.Execute(c.Context(), sessId)
+		res, err := h.uc.Execute(c.Context(), sessId)
 		if err != nil {
 			// clear session cookie on any error
-			http.DelCookie(c, http.CookieSessionId)
+			h.cookie.Del(c)
 
 			switch errors.GetErrCode(err) {
 			case usecase.ErrCodeEntityNotFound:
@@ -40,12 +43,27 @@ func (h *UserInfoHandler) Handler() fiber.Handler {
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnprocessableEntity)
 			case usecase.ErrCodeUserUnauthorized:
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.ErrUnauthorized)
+			case usecase.ErrCodeSessionTerminated:
+				terminated := errors.Unwrap[*session.TerminatedError](err)
+				return c.Status(fiber.StatusUnauthorized).JSON(&fiber.Map{
+					"code":    fiber.StatusUnauthorized,
+					"message": "session is terminated",
+					"reason":  terminated.Reason,
+				})
 			default:
 				h.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
 				return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
 			}
 		}
 
-		return c.JSON(user)
+		if res.Session.Id != sessId {
+			err = h.cookie.Set(c, res.Session.Id)
+			if err != nil {
+				h.l.WithError(err).Errorf(http.UnexpectedErrorMessage(c))
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.ErrInternalServerError)
+			}
+		}
+
+		return c.JSON(res.User)
 	}
 }
@@ -0,0 +1,206 @@
+// Package proxy forwards authenticated requests to upstream applications without own auth.
+package proxy
+
+import (
+	"context"
+	"myoidc/internal/handler/http"
+	"myoidc/internal/handler/http/auth"
+	"myoidc/internal/handler/http/authz"
+	"myoidc/internal/handler/http/csrf"
+	"myoidc/internal/service/identity"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/log"
+	nethttp "net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Route forwards matching requests to the upstream.
+type Route struct {
+	// Path matches request path, "/prefix/*" matches all subpaths.
+	Path     string
+	Upstream *url.URL
+	// StripPrefix removes the path prefix, so "/app/*" route passes "/app/page" as "/page".
+	StripPrefix bool
+	// PassAccessToken sets the provider access token in Access-Token identity header.
+	PassAccessToken bool
+	// PassIdentityToken sets the token signed by TokenIssuer in Identity header.
+	PassIdentityToken bool
+}
+
+func (r Route) matches(path string) bool {
+	if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == r.Path
+}
+
+type Config struct {
+	Routes []Route
+	// HeaderPrefix of identity headers, auth.DefaultHeaderPrefix if empty.
+	HeaderPrefix string
+}
+
+type identityTokenKey struct{}
+
+// Proxy is a net/http handler, so bodies are streamed and WebSocket upgrades are passed
+// through. Requests matching no route are served by next handler. Paths not in the form
+// returned by authz.CleanPath are rejected, so the upstream gets the path the rules checked.
+//
+// Hop-by-hop headers are dropped by httputil.ReverseProxy, X-Forwarded-* headers are set
+// from the connection and identity headers sent by the client are removed, as well as the
+// session cookie.
+type Proxy struct {
+	routes      []Route
+	proxies     []*httputil.ReverseProxy
+	prefix      string
+	requireAuth *auth.RequireAuth
+	csrf        *csrf.Protection
+	rules       *authz.Rules
+	cookie      *http.SessionCookie
+	issuer      *identity.TokenIssuer
+	next        nethttp.Handler
+	l           log.Logger
+}
+
+// New creates proxy, issuer is required by routes passing identity token only.
+// Unsafe requests are not checked against CSRF when protection is nil.
+func New(
+	cfg Config,
+	requireAuth *auth.RequireAuth,
+	protection *csrf.Protection,
+	rules *authz.Rules,
+	cookie *http.SessionCookie,
+	issuer *identity.TokenIssuer,
+	next nethttp.Handler,
+	l log.Logger,
+) (*Proxy, error) {
+	if cfg.HeaderPrefix == "" {
+		cfg.HeaderPrefix = auth.DefaultHeaderPrefix
+	}
+	p := &Proxy{
+		routes:      cfg.Routes,
+		prefix:      cfg.HeaderPrefix,
+		requireAuth: requireAuth,
+		csrf:        protection,
+		rules:       rules,
+		cookie:      cookie,
+		issuer:      issuer,
+		next:        next,
+		l:           l,
+	}
+	for i, route := range cfg.Routes {
+		switch {
+		case !strings.HasPrefix(route.Path, "/"):
+			return nil, errors.Errorf("proxy route [%d] path \"%s\" must start with /", i, route.Path)
+		case route.Upstream == nil || (route.Upstream.Scheme != "http" && route.Upstream.Scheme != "https") || route.Upstream.Host == "":
+			return nil, errors.Errorf("proxy route [%d] upstream must be an absolute http url", i)
+		case route.PassIdentityToken && issuer == nil:
+			return nil, errors.Errorf("proxy route [%d] passes identity token, but identity token keys are not configured", i)
+		}
+		p.proxies = append(p.proxies, &httputil.ReverseProxy{
+			Rewrite:       p.rewrite(route),
+			FlushInterval: -1, // stream responses, e.g. server-sent events
+			ErrorHandler:  p.handleError,
+		})
+	}
+	return p, nil
+}
+
+func (p *Proxy) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	path := authz.CleanPath(r.URL.Path)
+	i := p.match(path)
+	if i < 0 {
+		p.next.ServeHTTP(w, r)
+		return
+	}
+	if path != r.URL.Path {
+		p.l.Warnf("proxy request to %q is rejected: path is not canonical", r.URL.Path)
+		http.WriteJSON(w, nethttp.StatusBadRequest, fiber.ErrBadRequest)
+		return
+	}
+
+	id, ok := p.requireAuth.Authenticate(w, r)
+	if !ok {
+		return
+	}
+	if p.csrf != nil && !p.csrf.CheckHTTP(w, r) {
+		return
+	}
+	if !p.rules.Allowed(r.Method, path, id) {
+		http.WriteJSON(w, nethttp.StatusForbidden, authz.ForbiddenBody(authz.ReasonMissingPermission))
+		return
+	}
+
+	ctx := auth.WithIdentity(r.Context(), id)
+	if route := p.routes[i]; route.PassIdentityToken {
+		token, err := p.issuer.Issue(id.Session.UserId, id.User, id.Session.ProviderName, route.Upstream.String())
+		if err != nil {
+			p.l.WithError(err).Errorf(http.UnexpectedPathErrorMessage(r.URL.Path))
+			http.WriteJSON(w, nethttp.StatusInternalServerError, fiber.ErrInternalServerError)
+			return
+		}
+		ctx = context.WithValue(ctx, identityTokenKey{}, token)
+	}
+	p.proxies[i].ServeHTTP(w, r.WithContext(ctx))
+}
+
+// match returns index of the first matching route or -1.
+func (p *Proxy) match(path string) int {
+	for i, route := range p.routes {
+		if route.matches(path) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *Proxy) rewrite(route Route) func(pr *httputil.ProxyRequest) {
+	return func(pr *httputil.ProxyRequest) {
+		if prefix, ok := strings.CutSuffix(route.Path, "/*"); ok && route.StripPrefix {
+			pr.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(pr.Out.URL.Path, prefix), "/")
+			pr.Out.URL.RawPath = ""
+		}
+		pr.SetURL(route.Upstream)
+		pr.SetXForwarded()
+
+		for name := range pr.Out.Header {
+			if auth.IsIdentityHeader(p.prefix, name) {
+				// names with underscores aren't canonical, Del would miss them
+				delete(pr.Out.Header, name)
+			}
+		}
+		cookies := pr.Out.Cookies()
+		pr.Out.Header.Del("Cookie")
+		for _, cookie := range cookies {
+			if !p.cookie.IsChunk(cookie.Name) {
+				pr.Out.AddCookie(cookie)
+			}
+		}
+
+		id, ok := auth.FromContext(pr.In.Context())
+		if !ok {
+			return
+		}
+		for name, value := range id.Headers(p.prefix) {
+			pr.Out.Header.Set(name, value)
+		}
+		if route.PassAccessToken {
+			pr.Out.Header.Set(p.prefix+auth.HeaderAccessToken, id.AccessToken)
+		}
+		if token, ok := pr.In.Context().Value(identityTokenKey{}).(string); ok {
+			pr.Out.Header.Set(p.prefix+auth.HeaderIdentity, token)
+		}
+	}
+}
+
+func (p *Proxy) handleError(w nethttp.ResponseWriter, r *nethttp.Request, err error) {
+	if r.Context().Err() != nil {
+		return // client has gone
+	}
+	p.l.WithError(err).Errorf("upstream request %s failed", r.URL.Path)
+	http.WriteJSON(w, nethttp.StatusBadGateway, fiber.ErrBadGateway)
+}
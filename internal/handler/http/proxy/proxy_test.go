@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"myoidc/internal/domain"
+	"myoidc/internal/handler/http"
+	"myoidc/internal/handler/http/auth"
+	"myoidc/internal/handler/http/authz"
+	"myoidc/internal/handler/http/csrf"
+	oidccli "myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/event"
+	"myoidc/internal/service/session/inmemory"
+	csrf_uc "myoidc/internal/usecase/csrf"
+	"myoidc/internal/usecase/oidc/userinfo"
+	"myoidc/pkg/log"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testClient struct {
+	oidccli.Client
+}
+
+func (testClient) FetchUserByToken(ctx context.Context, token *oidccli.Token) (*domain.User, error) {
+	return &domain.User{Id: "123", Login: "user", Email: "user@myoidc.test", Permissions: []string{"billing:read"}}, nil
+}
+
+// newTestProxy returns proxy, the session id and its csrf token.
+func newTestProxy(t *testing.T, upstream string) (*Proxy, string, string) {
+	sm := inmemory.NewManager()
+	reg := oidccli.MapClientRegistry{"myoidc": testClient{}}
+	cookie := http.NewSessionCookie("sessId", http.DefaultCookiePolicy(), nil)
+	requireAuth := auth.NewRequireAuth(auth.Config{ProviderName: "myoidc"}, userinfo.NewUseCase(reg, sm, event.Discard, 0), cookie, log.GetDefault())
+	// the upstream serves paths case-insensitively
+	rules, _ := authz.NewRules([]authz.Rule{
+		{Path: "/app/admin/*", IgnoreCase: true, Requirement: authz.Requirement{AllOf: []string{"admin"}}},
+	}, log.GetDefault())
+	csrfUseCase := csrf_uc.NewUseCase(sm)
+	protection, err := csrf.New(csrf.Config{
+		Mode:    csrf.ModeSynchronizer,
+		Origins: []string{"https://myoidc.test"},
+	}, csrfUseCase, cookie, log.GetDefault())
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamUrl, _ := url.Parse(upstream)
+	next := nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.WriteHeader(nethttp.StatusTeapot)
+	})
+
+	p, err := New(Config{
+		Routes: []Route{{Path: "/app/*", Upstream: upstreamUrl, StripPrefix: true, PassAccessToken: true}},
+	}, requireAuth, protection, rules, cookie, nil, next, log.GetDefault())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := sm.Create(context.TODO(), "123", session.NewAuthData(session.Auth{
+		ProviderName: "myoidc",
+		AccessToken:  "ACCESS_TOKEN",
+	}))
+	token, _, err := csrfUseCase.Token(context.TODO(), sess.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, sess.Id, token
+}
+
+func TestProxy(t *testing.T) {
+	var received *nethttp.Request
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		received = r
+		w.WriteHeader(nethttp.StatusOK)
+	}))
+	defer upstream.Close()
+	p, sessId, _ := newTestProxy(t, upstream.URL)
+
+	req := httptest.NewRequest("GET", "/app/page?tab=1", nil)
+	req.Header.Set("Cookie", "sessId="+sessId+"; theme=dark")
+	req.Header.Set("X-Auth-Request-User", "admin")
+	req.Header.Set("X-Auth-Request-Groups", "admins")
+	req.Header["X_Auth_Request_User"] = []string{"admin"}
+	req.Header.Set("Connection", "X-Custom")
+	req.Header.Set("X-Custom", "hop-by-hop")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	assert.Equal(t, nethttp.StatusOK, w.Code)
+	if assert.NotNil(t, received, "request is not forwarded") {
+		assert.Equal(t, "/page", received.URL.Path, "prefix is not stripped")
+		assert.Equal(t, "tab=1", received.URL.RawQuery)
+		assert.Equal(t, "123", received.Header.Get("X-Auth-Request-User"), "identity is not set")
+		assert.Equal(t, "user@myoidc.test", received.Header.Get("X-Auth-Request-Email"))
+		assert.Equal(t, "billing:read", received.Header.Get("X-Auth-Request-Permissions"))
+		assert.Equal(t, "ACCESS_TOKEN", received.Header.Get("X-Auth-Request-Access-Token"))
+		assert.Empty(t, received.Header.Get("X-Auth-Request-Groups"), "client identity header is passed")
+		for name := range received.Header {
+			assert.NotContains(t, name, "_", "client identity header with underscores is passed")
+		}
+		assert.Empty(t, received.Header.Get("X-Custom"), "hop-by-hop header is passed")
+		assert.Equal(t, "theme=dark", received.Header.Get("Cookie"), "session cookie is passed")
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		cookie   string
+		expected int
+	}{
+		{name: "without session", path: "/app/page", expected: nethttp.StatusUnauthorized},
+		{name: "missing permission", path: "/app/admin/users", cookie: "sessId=" + sessId, expected: nethttp.StatusForbidden},
+		{name: "dot segments", path: "/app/x/../admin/users", cookie: "sessId=" + sessId, expected: nethttp.StatusBadRequest},
+		{name: "encoded dot segments", path: "/app/x/%2e%2e/admin/users", cookie: "sessId=" + sessId, expected: nethttp.StatusBadRequest},
+		{name: "repeated slashes", path: "/app//admin/users", cookie: "sessId=" + sessId, expected: nethttp.StatusBadRequest},
+		{name: "case variant", path: "/app/ADMIN/users", cookie: "sessId=" + sessId, expected: nethttp.StatusForbidden},
+		{name: "other route", path: "/oauth/userinfo", expected: nethttp.StatusTeapot},
+	}
+	for _, tt := range tests {
+		received = nil
+		req = httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Cookie", tt.cookie)
+		w = httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		assert.Equal(t, tt.expected, w.Code, tt.name)
+		assert.Nil(t, received, tt.name+": request is forwarded")
+	}
+}
+
+func TestProxy_Stream(t *testing.T) {
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("echo: " + string(body) + "\n"))
+		w.(nethttp.Flusher).Flush()
+		<-r.Context().Done() // keep the stream open
+	}))
+	defer upstream.Close()
+	p, sessId, token := newTestProxy(t, upstream.URL)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	req, _ := nethttp.NewRequest("POST", srv.URL+"/app/events", strings.NewReader("hello"))
+	req.Header.Set("Cookie", "sessId="+sessId)
+	req.Header.Set(csrf.HeaderName, token)
+	res, err := nethttp.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", line, "response is not flushed before upstream completes")
+}
+
+func TestProxy_CSRF(t *testing.T) {
+	var received *nethttp.Request
+	upstream := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		received = r
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer upstream.Close()
+	p, sessId, token := newTestProxy(t, upstream.URL)
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		body     string
+		expected int
+	}{
+		{name: "valid token", header: map[string]string{csrf.HeaderName: token}, expected: nethttp.StatusOK},
+		{name: "missing token", expected: nethttp.StatusForbidden},
+		{name: "cross-origin", header: map[string]string{csrf.HeaderName: token, "Origin": "https://evil.test"}, expected: nethttp.StatusForbidden},
+		{name: "form token", header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body: "a=1&" + csrf.FormField + "=" + token, expected: nethttp.StatusOK},
+	}
+	for _, tt := range tests {
+		received = nil
+		req := httptest.NewRequest("POST", "/app/orders", strings.NewReader(tt.body))
+		req.Header.Set("Cookie", "sessId="+sessId)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		assert.Equal(t, tt.expected, w.Code, tt.name)
+		if tt.expected == nethttp.StatusOK {
+			assert.Equal(t, tt.body, w.Body.String(), tt.name+": body is not passed to upstream")
+		} else {
+			assert.Nil(t, received, tt.name+": request is forwarded")
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package identity issues tokens asserting the authenticated user to upstream applications.
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+	"time"
+)
+
+// DefaultTokenTTL is used when TokenIssuer is created without ttl. Tokens are issued per
+// request, so they only need to outlive the upstream call.
+const DefaultTokenTTL = 5 * time.Minute
+
+// minKeySize is a minimal HMAC-SHA256 key size.
+const minKeySize = 32
+
+// Claims of the identity token, standard JWT names are used where they exist.
+type Claims struct {
+	Issuer      string   `json:"iss,omitempty"`
+	Subject     string   `json:"sub"`
+	Audience    string   `json:"aud,omitempty"`
+	IssuedAt    int64    `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
+	Email       string   `json:"email,omitempty"`
+	Login       string   `json:"preferred_username,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Provider    string   `json:"provider,omitempty"`
+}
+
+// TokenIssuer signs identity tokens as HS256 JWT, the key id is set in "kid" header,
+// so upstreams can pick the key while keys are rotated.
+type TokenIssuer struct {
+	key    keyring.Key
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokenIssuer creates issuer, only session.WithClock of opts is used.
+func NewTokenIssuer(key keyring.Key, issuer string, ttl time.Duration, opts ...session.Option) (*TokenIssuer, error) {
+	if len(key.Secret) < minKeySize {
+		return nil, errors.Errorf("key \"%s\" must be at least %d bytes long", key.Id, minKeySize)
+	}
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	ti := &TokenIssuer{
+		key:    key,
+		issuer: issuer,
+		ttl:    ttl,
+	}
+	ti.now = session.ApplyOptions(ti, opts).Now
+	return ti, nil
+}
+
+// Issue returns token of the user for the audience, e.g. upstream url.
+func (ti *TokenIssuer) Issue(userId string, user *domain.User, providerName string, audience string) (string, error) {
+	now := ti.now()
+	claims := Claims{
+		Issuer:    ti.issuer,
+		Subject:   userId,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ti.ttl).Unix(),
+		Provider:  providerName,
+	}
+	if user != nil {
+		claims.Email = user.Email
+		claims.Login = user.Login
+		claims.Name = user.FullName
+		claims.Permissions = user.Permissions
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT", "kid": ti.key.Id})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode identity token header")
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode identity token claims")
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	h := hmac.New(sha256.New, ti.key.Secret)
+	h.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,58 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/keyring"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenIssuer_Issue(t *testing.T) {
+	key := keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)}
+	now := time.Unix(1700000000, 0)
+	ti, err := NewTokenIssuer(key, "https://myoidc.test", time.Minute, session.WithClock(func() time.Time { return now }))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	token, err := ti.Issue("123", &domain.User{Login: "user", Permissions: []string{"billing:read"}}, "myoidc", "http://legacy")
+	if !assert.NoError(t, err) {
+		return
+	}
+	parts := strings.Split(token, ".")
+	if !assert.Len(t, parts, 3) {
+		return
+	}
+
+	h := hmac.New(sha256.New, key.Secret)
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(h.Sum(nil)), parts[2], "invalid signature")
+
+	header, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	assert.JSONEq(t, `{"alg":"HS256","typ":"JWT","kid":"k1"}`, string(header))
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims Claims
+	assert.NoError(t, json.Unmarshal(payload, &claims))
+	assert.Equal(t, Claims{
+		Issuer:      "https://myoidc.test",
+		Subject:     "123",
+		Audience:    "http://legacy",
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(time.Minute).Unix(),
+		Login:       "user",
+		Permissions: []string{"billing:read"},
+		Provider:    "myoidc",
+	}, claims)
+
+	_, err = NewTokenIssuer(keyring.Key{Id: "short", Secret: []byte("short")}, "", 0)
+	assert.Error(t, err, "short key is accepted")
+}
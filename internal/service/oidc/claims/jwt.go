@@ -0,0 +1,38 @@
+package claims
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"myoidc/pkg/errors"
+	"strings"
+)
+
+// DecodeJWT returns payload claims of a compact serialized JWT WITHOUT signature verification.
+// It may be used only for tokens received directly from the provider over TLS,
+// e.g. id_token from the token endpoint (OpenID Connect Core 1.0, section 3.1.3.7).
+func DecodeJWT(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Error("malformed jwt: expected 3 parts")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed jwt payload")
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(payload, &m)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed jwt payload")
+	}
+	return m, nil
+}
+
+// HasAudience checks "aud" claim which may be a string or an array of strings.
+func HasAudience(m map[string]interface{}, aud string) bool {
+	for _, v := range Strings(m["aud"]) {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package claims
+
+import (
+	"myoidc/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Segment is a single step of a claim Path: an object key, an array index or a wildcard.
+type Segment struct {
+	Key      string
+	Index    int
+	IsKey    bool
+	Wildcard bool
+}
+
+// Path is a parsed JSON-path-style claim reference.
+//
+// Supported syntax:
+//
+//	sub                       top level claim
+//	address.country           nested object
+//	emails[0]                 array element
+//	["https://app/roles"]     quoted key, for namespaced claims containing dots
+//	resource_access.*.roles   any object key or array element, see Path.LookupAll
+type Path []Segment
+
+func ParsePath(s string) (Path, error) {
+	if s == "" {
+		return nil, errors.Error("claim path is empty")
+	}
+
+	path := make(Path, 0)
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '.':
+			if i == 0 || i == len(s)-1 {
+				return nil, errors.Errorf("invalid claim path \"%s\": unexpected '.' at %d", s, i)
+			}
+			i++
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, errors.Errorf("invalid claim path \"%s\": unclosed '[' at %d", s, i)
+			}
+			inner := s[i+1 : i+end]
+			if inner == "*" {
+				path = append(path, Segment{Wildcard: true})
+			} else if len(inner) >= 2 && inner[0] == '"' && inner[len(inner)-1] == '"' {
+				path = append(path, Segment{Key: inner[1 : len(inner)-1], IsKey: true})
+			} else {
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, errors.Errorf("invalid claim path \"%s\": bad index \"%s\"", s, inner)
+				}
+				path = append(path, Segment{Index: idx})
+			}
+			i += end + 1
+		default:
+			end := strings.IndexAny(s[i:], ".[")
+			if end < 0 {
+				end = len(s) - i
+			}
+			if key := s[i : i+end]; key == "*" {
+				path = append(path, Segment{Wildcard: true})
+			} else {
+				path = append(path, Segment{Key: key, IsKey: true})
+			}
+			i += end
+		}
+	}
+	return path, nil
+}
+
+func (p Path) HasWildcard() bool {
+	for _, seg := range p {
+		if seg.Wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+func MustParsePath(s string) Path {
+	p, err := ParsePath(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Lookup resolves the path against decoded JSON claims.
+// Wildcard segments resolve to the first matching element, use LookupAll to get every match.
+func (p Path) Lookup(claims interface{}) (interface{}, bool) {
+	if p.HasWildcard() {
+		matches := p.LookupAll(claims)
+		if len(matches) == 0 {
+			return nil, false
+		}
+		return matches[0].Value, true
+	}
+
+	cur := claims
+	for _, seg := range p {
+		if seg.IsKey {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			cur, ok = m[seg.Key]
+			if !ok {
+				return nil, false
+			}
+		} else {
+			arr, ok := cur.([]interface{})
+			if !ok || seg.Index >= len(arr) {
+				return nil, false
+			}
+			cur = arr[seg.Index]
+		}
+	}
+	return cur, cur != nil
+}
+
+// Match is a value found by Path.LookupAll. Wildcards contains object keys
+// (or array indexes) matched by wildcard segments in order of appearance.
+type Match struct {
+	Value     interface{}
+	Wildcards []string
+}
+
+// LookupAll resolves the path against decoded JSON claims expanding wildcard segments.
+// Object keys are visited in sorted order so results are stable.
+func (p Path) LookupAll(claims interface{}) []Match {
+	matches := []Match{{Value: claims}}
+	for _, seg := range p {
+		next := make([]Match, 0, len(matches))
+		for _, m := range matches {
+			switch {
+			case seg.Wildcard:
+				switch t := m.Value.(type) {
+				case map[string]interface{}:
+					keys := make([]string, 0, len(t))
+					for k := range t {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, m.with(t[k], k))
+					}
+				case []interface{}:
+					for i, v := range t {
+						next = append(next, m.with(v, strconv.Itoa(i)))
+					}
+				}
+			case seg.IsKey:
+				if t, ok := m.Value.(map[string]interface{}); ok {
+					if v, ok := t[seg.Key]; ok {
+						next = append(next, Match{Value: v, Wildcards: m.Wildcards})
+					}
+				}
+			default:
+				if t, ok := m.Value.([]interface{}); ok && seg.Index < len(t) {
+					next = append(next, Match{Value: t[seg.Index], Wildcards: m.Wildcards})
+				}
+			}
+		}
+		matches = next
+	}
+
+	res := matches[:0]
+	for _, m := range matches {
+		if m.Value != nil {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func (m Match) with(value interface{}, wildcard string) Match {
+	wildcards := make([]string, len(m.Wildcards), len(m.Wildcards)+1)
+	copy(wildcards, m.Wildcards)
+	return Match{Value: value, Wildcards: append(wildcards, wildcard)}
+}
+
+// Strings converts a claim value to a list of strings. Scalars produce a single
+// element, arrays are flattened one level, everything else is dropped.
+func Strings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		res := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := scalar(item); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	default:
+		if s, ok := scalar(v); ok {
+			return []string{s}
+		}
+		return nil
+	}
+}
+
+func scalar(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	default:
+		return "", false
+	}
+}
@@ -6,11 +6,20 @@ import (
 	"myoidc/internal/service/oidc/pkce"
 	"myoidc/pkg/errors"
 	"net/url"
+	"time"
 )
 
+// ErrTokenRejected is returned when the provider rejects the access token, e.g. expired one,
+// so the caller can refresh it and retry.
+var ErrTokenRejected = errors.Error("access token is rejected by oidc server")
+
 type Token struct {
 	Access  string
 	Refresh *string
+	// ID is the raw OIDC id_token if provider returned one.
+	ID string
+	// Expiry of the access token, zero if provider didn't tell it.
+	Expiry time.Time
 }
 
 func (t Token) Valid() bool {
@@ -29,10 +38,11 @@ func NewUrlParam(key, value string) UrlParam {
 	}
 }
 
-// Client for Authorization Code Flow.
+// Client for Authorization Code Flow. The redirect uri is fixed by client config,
+// so it matches the one registered with the identity provider.
 type Client interface {
-	BuildAuthURL(ctx context.Context, state string, scopes []string, tempSessId string, params ...UrlParam) (*url.URL, error)
-	FetchTokenByCode(ctx context.Context, code string, tempSessId string, params ...UrlParam) (*Token, error)
+	BuildAuthURL(ctx context.Context, state string, scopes []string, params ...UrlParam) (*url.URL, error)
+	FetchTokenByCode(ctx context.Context, code string, params ...UrlParam) (*Token, error)
 	FetchUserByToken(ctx context.Context, token *Token) (*domain.User, error)
 	RefreshToken(ctx context.Context, token *Token) (*Token, error)
 }
@@ -2,7 +2,6 @@ package client
 
 import (
 	"context"
-	"crypto/tls"
 	"golang.org/x/oauth2"
 	"io"
 	"myoidc/internal/domain"
@@ -13,25 +12,25 @@ import (
 )
 
 type GenericClient struct {
-	cfg           *oauth2.Config
-	userInfoUrl   *url.URL
-	useState      bool
-	usePKCE       bool
-	pkceGenerator pkce.PKCEGenerator
-	um            UserInfoUnmarshaler
+	cfg             *oauth2.Config
+	userInfoUrl     *url.URL
+	userInfoRequest UserInfoRequestConfig
+	useState        bool
+	usePKCE         bool
+	pkceGenerator   pkce.PKCEGenerator
+	um              UserInfoUnmarshaler
 
 	HttpClient *http.Client
 }
 
-func (cli GenericClient) BuildAuthURL(ctx context.Context, state string, scopes []string, tempSessId string, params ...UrlParam) (*url.URL, error) {
-	_, config := cli.prepareOAuth2Client(ctx)
-	config.Scopes = scopes
+// DefaultScopes are requested when neither the caller nor the client config specify scopes.
+var DefaultScopes = []string{"openid", "profile", "email", "phone", "address"}
 
-	redirectUrl, err := cli.buildRedirectUrl(config.RedirectURL, tempSessId)
-	if err != nil {
-		return nil, err
+func (cli GenericClient) BuildAuthURL(ctx context.Context, state string, scopes []string, params ...UrlParam) (*url.URL, error) {
+	_, config := cli.prepareOAuth2Client(ctx)
+	if len(scopes) > 0 {
+		config.Scopes = scopes
 	}
-	config.RedirectURL = redirectUrl
 
 	options := make([]oauth2.AuthCodeOption, 0)
 	for _, param := range params {
@@ -41,15 +40,9 @@ func (cli GenericClient) BuildAuthURL(ctx context.Context, state string, scopes
 	return url.Parse(loginUrlStr)
 }
 
-func (cli GenericClient) FetchTokenByCode(ctx context.Context, code string, tempSessId string, params ...UrlParam) (*Token, error) {
+func (cli GenericClient) FetchTokenByCode(ctx context.Context, code string, params ...UrlParam) (*Token, error) {
 	ctx, config := cli.prepareOAuth2Client(ctx)
 
-	redirectUrl, err := cli.buildRedirectUrl(config.RedirectURL, tempSessId)
-	if err != nil {
-		return nil, err
-	}
-	config.RedirectURL = redirectUrl
-
 	options := make([]oauth2.AuthCodeOption, 0)
 	for _, param := range params {
 		options = append(options, oauth2.SetAuthURLParam(param.Key, param.Value))
@@ -58,37 +51,49 @@ func (cli GenericClient) FetchTokenByCode(ctx context.Context, code string, temp
 }
 
 func (cli GenericClient) FetchUserByToken(ctx context.Context, token *Token) (*domain.User, error) {
+	body, err := cli.FetchUserInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return cli.UnmarshalUserInfo(body)
+}
+
+// FetchUserInfo returns raw userinfo response body.
+func (cli GenericClient) FetchUserInfo(ctx context.Context, token *Token) ([]byte, error) {
 	if token == nil || !token.Valid() {
 		return nil, errors.Error("token is invalid")
 	}
 
-	req, err := http.NewRequest("POST", cli.userInfoUrl.String(), nil)
+	req, err := cli.userInfoRequest.newRequest(ctx, cli.userInfoUrl.String(), token)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", "Bearer "+token.Access)
 	res, err := cli.HttpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
-
-	if res.StatusCode != 200 {
-		body, _ := io.ReadAll(res.Body)
-		return nil, errors.Errorf("invalid response from oidc server: %s", body)
-	}
+	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, errors.Wrapf(ErrTokenRejected, "invalid response from oidc server: %s", body)
+	} else if res.StatusCode != 200 {
+		return nil, errors.Errorf("invalid response from oidc server: %s", body)
+	}
+
+	return decodeUserInfoResponse(res, body)
+}
 
+// UnmarshalUserInfo converts userinfo response body to user with the configured unmarshaler.
+func (cli GenericClient) UnmarshalUserInfo(body []byte) (*domain.User, error) {
 	var user domain.User
-	err = cli.um.UnmarshalUserInfo(body, &user)
-	//err = json.Unmarshal(body, &user)
+	err := cli.um.UnmarshalUserInfo(body, &user)
 	if err != nil {
 		return nil, err
 	}
-
 	return &user, nil
 }
 
@@ -132,9 +137,13 @@ func (cli GenericClient) parseToken(tokenData *oauth2.Token, err error) (*Token,
 	}
 	var token Token
 	token.Access = tokenData.AccessToken
+	token.Expiry = tokenData.Expiry
 	if tokenData.RefreshToken != "" {
 		token.Refresh = &tokenData.RefreshToken
 	}
+	if idToken, ok := tokenData.Extra("id_token").(string); ok {
+		token.ID = idToken
+	}
 	if !token.Valid() {
 		return nil, errors.Error("token data is invalid")
 	}
@@ -142,6 +151,8 @@ func (cli GenericClient) parseToken(tokenData *oauth2.Token, err error) (*Token,
 }
 
 type ClientConfig struct {
+	// Preset selects client implementation registered by RegisterPreset, empty value means GenericClient.
+	Preset              string
 	ClientId            string
 	AuthUrl             string
 	TokenUrl            string
@@ -151,8 +162,20 @@ type ClientConfig struct {
 	UseState            bool
 	UsePKCE             bool
 	PKCEGenerator       pkce.PKCEGenerator
-	DisableSslVerify    bool
 	UserInfoUnmarshaler string
+	// Unmarshaler overrides registered unmarshaler selected by UserInfoUnmarshaler name.
+	Unmarshaler     UserInfoUnmarshaler
+	Scopes          []string
+	UserInfoRequest UserInfoRequestConfig
+	// HttpClient is used for all provider calls, http.DefaultClient if nil.
+	HttpClient *http.Client
+
+	// Preset specific settings.
+	BaseUrl        string
+	Tenant         string
+	AllowedTenants []string
+	Realm          string
+	HostedDomain   string
 }
 
 func NewGenericClient(cfg ClientConfig) (*GenericClient, error) {
@@ -168,20 +191,25 @@ func NewGenericClient(cfg ClientConfig) (*GenericClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	um := unmarshalers[cfg.UserInfoUnmarshaler]
+	err = cfg.UserInfoRequest.validate()
+	if err != nil {
+		return nil, err
+	}
+	um := cfg.Unmarshaler
 	if um == nil {
-		return nil, errors.Errorf("unknown user unmarshaler \"%s\". Use generic.RegisterUnmarshaller to register a new unmarshaller type", cfg.UserInfoUnmarshaler)
+		um, err = GetUnmarshaler(cfg.UserInfoUnmarshaler)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	var httpClient *http.Client
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
 
-	if cfg.DisableSslVerify == true {
-		httpClient = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-		}
-	} else {
+	httpClient := cfg.HttpClient
+	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
 
@@ -189,7 +217,7 @@ func NewGenericClient(cfg ClientConfig) (*GenericClient, error) {
 		cfg: &oauth2.Config{
 			ClientID:     cfg.ClientId,
 			ClientSecret: cfg.ClientSecret,
-			Scopes:       []string{},
+			Scopes:       scopes,
 			Endpoint: oauth2.Endpoint{
 				TokenURL:  tokenUrl.String(),
 				AuthURL:   authUrl.String(),
@@ -197,32 +225,27 @@ func NewGenericClient(cfg ClientConfig) (*GenericClient, error) {
 			},
 			RedirectURL: cfg.RedirectUrl,
 		},
-		userInfoUrl:   userInfoUrl,
-		useState:      cfg.UseState,
-		usePKCE:       cfg.UsePKCE,
-		pkceGenerator: cfg.PKCEGenerator,
-		um:            um,
+		userInfoUrl:     userInfoUrl,
+		userInfoRequest: cfg.UserInfoRequest,
+		useState:        cfg.UseState,
+		usePKCE:         cfg.UsePKCE,
+		pkceGenerator:   cfg.PKCEGenerator,
+		um:              um,
 
 		HttpClient: httpClient,
 	}, err
 }
 
-func (cli GenericClient) buildRedirectUrl(baseUrl, tempSessId string) (string, error) {
-	redirectUri, err := url.Parse(baseUrl)
-	if err != nil {
-		return "", err
-	}
-	query := redirectUri.Query()
-	query.Add("token", tempSessId)
-	redirectUri.RawQuery = query.Encode()
-
-	return redirectUri.String(), nil
-}
-
 func NewGenericClientRegistry(configs map[string]ClientConfig) (ClientRegistry, error) {
 	reg := make(map[string]Client)
 	for name, cfg := range configs {
-		cli, err := NewGenericClient(cfg)
+		var cli Client
+		var err error
+		if cfg.Preset != "" {
+			cli, err = newPresetClient(cfg)
+		} else {
+			cli, err = NewGenericClient(cfg)
+		}
 		if err != nil {
 			return nil, errors.Wrapf(err, "oidc client generation error for provider %s", name)
 		}
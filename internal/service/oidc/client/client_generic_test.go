@@ -28,7 +28,7 @@ func TestGenericClient_BuildAuthURL(t *testing.T) {
 			scopes:   []string{},
 			state:    "",
 			params:   nil,
-			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client_id&redirect_uri=callback_url%3Ftoken%3DsessId&response_type=code",
+			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client_id&redirect_uri=callback_url&response_type=code",
 		},
 		{
 			name:     "encoded client id",
@@ -36,7 +36,7 @@ func TestGenericClient_BuildAuthURL(t *testing.T) {
 			scopes:   []string{},
 			state:    "",
 			params:   nil,
-			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client++%26id&redirect_uri=callback_url%3Ftoken%3DsessId&response_type=code",
+			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client++%26id&redirect_uri=callback_url&response_type=code",
 		},
 		{
 			name:     "with scopes",
@@ -44,7 +44,7 @@ func TestGenericClient_BuildAuthURL(t *testing.T) {
 			scopes:   []string{"openid", "profile"},
 			state:    "",
 			params:   nil,
-			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client_id&redirect_uri=callback_url%3Ftoken%3DsessId&response_type=code&scope=openid+profile",
+			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client_id&redirect_uri=callback_url&response_type=code&scope=openid+profile",
 		},
 		{
 			name:     "with scopes and state",
@@ -52,7 +52,7 @@ func TestGenericClient_BuildAuthURL(t *testing.T) {
 			scopes:   []string{"openid", "profile"},
 			state:    "my_state",
 			params:   nil,
-			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client_id&redirect_uri=callback_url%3Ftoken%3DsessId&response_type=code&scope=openid+profile&state=my_state",
+			expected: "https://oauth.server.com/api/oidc/authenticate?client_id=client_id&redirect_uri=callback_url&response_type=code&scope=openid+profile&state=my_state",
 		},
 		{
 			name:     "with scopes, state and url params",
@@ -60,7 +60,7 @@ func TestGenericClient_BuildAuthURL(t *testing.T) {
 			scopes:   []string{"openid", "profile"},
 			state:    "my_state",
 			params:   []UrlParam{{Key: "challenge", Value: "123"}},
-			expected: "https://oauth.server.com/api/oidc/authenticate?challenge=123&client_id=client_id&redirect_uri=callback_url%3Ftoken%3DsessId&response_type=code&scope=openid+profile&state=my_state",
+			expected: "https://oauth.server.com/api/oidc/authenticate?challenge=123&client_id=client_id&redirect_uri=callback_url&response_type=code&scope=openid+profile&state=my_state",
 		},
 	}
 
@@ -78,7 +78,7 @@ func TestGenericClient_BuildAuthURL(t *testing.T) {
 
 	for _, tt := range tests {
 		client.cfg.ClientID = tt.clientId
-		res, err := client.BuildAuthURL(context.TODO(), tt.state, tt.scopes, "sessId", tt.params...)
+		res, err := client.BuildAuthURL(context.TODO(), tt.state, tt.scopes, tt.params...)
 		if tt.expectedError {
 			assert.Error(t, err, tt.name)
 		} else {
@@ -109,7 +109,7 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	res, err := client.FetchTokenByCode(context.TODO(), "code", "")
+	res, err := client.FetchTokenByCode(context.TODO(), "code")
 	if assert.NoError(t, err) {
 		expected := &Token{Access: "ACCESS_TOKEN", Refresh: nil}
 		assert.Equal(t, expected, res, "success without refresh")
@@ -125,7 +125,7 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	res, err = client.FetchTokenByCode(context.TODO(), "code", "")
+	res, err = client.FetchTokenByCode(context.TODO(), "code")
 	if assert.NoError(t, err) {
 		expected := &Token{Access: "ACCESS_TOKEN", Refresh: pointer("REFRESH_TOKEN")}
 		assert.Equal(t, expected, res, "success with refresh")
@@ -141,7 +141,7 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	res, err = client.FetchTokenByCode(context.TODO(), "code", "")
+	res, err = client.FetchTokenByCode(context.TODO(), "code")
 	if assert.NoError(t, err) {
 		expected := &Token{Access: "ACCESS_TOKEN", Refresh: nil}
 		assert.Equal(t, expected, res, "response with empty refresh token")
@@ -157,7 +157,7 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	_, err = client.FetchTokenByCode(context.TODO(), "code", "")
+	_, err = client.FetchTokenByCode(context.TODO(), "code")
 	assert.Error(t, err, "invalid json response")
 
 	// case 5: response with undefined access token
@@ -168,7 +168,7 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	_, err = client.FetchTokenByCode(context.TODO(), "code", "")
+	_, err = client.FetchTokenByCode(context.TODO(), "code")
 	assert.Error(t, err, "response with undefined access token")
 
 	server.Close()
@@ -181,7 +181,7 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	_, err = client.FetchTokenByCode(context.TODO(), "code", "")
+	_, err = client.FetchTokenByCode(context.TODO(), "code")
 	assert.Error(t, err, "response with empty access token")
 
 	server.Close()
@@ -194,7 +194,7 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	_, err = client.FetchTokenByCode(context.TODO(), "code", "")
+	_, err = client.FetchTokenByCode(context.TODO(), "code")
 	assert.Error(t, err, "resource server error")
 
 	server.Close()
@@ -212,12 +212,12 @@ func TestGenericClient_FetchTokenByCode(t *testing.T) {
 	}))
 
 	client.cfg.Endpoint.TokenURL = server.URL
-	res, err = client.FetchTokenByCode(context.TODO(), requestCode, "")
+	res, err = client.FetchTokenByCode(context.TODO(), requestCode)
 	if assert.NoError(t, err) {
 		expected := &Token{Access: "ACCESS_TOKEN", Refresh: pointer("REFRESH_TOKEN")}
 		assert.Equal(t, expected, res, "valid code")
 	}
-	_, err = client.FetchTokenByCode(context.TODO(), "another code", "")
+	_, err = client.FetchTokenByCode(context.TODO(), "another code")
 	assert.Error(t, err, "invalid code")
 
 	server.Close()
@@ -324,6 +324,101 @@ func TestGenericClient_FetchUserByToken(t *testing.T) {
 	server.Close()
 }
 
+func TestGenericClient_FetchUserInfo(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       UserInfoRequestConfig
+		contentType   string
+		response      string
+		check         func(r *http.Request)
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:        "defaults",
+			contentType: "application/json; charset=utf-8",
+			response:    `{"id": "USER_ID"}`,
+			check: func(r *http.Request) {
+				assert.Equal(t, http.MethodGet, r.Method, "defaults")
+				assert.Equal(t, "Bearer ACCESS_TOKEN", r.Header.Get("Authorization"), "defaults")
+				assert.Equal(t, "application/json", r.Header.Get("Accept"), "defaults")
+			},
+			expected: `{"id": "USER_ID"}`,
+		},
+		{
+			name:        "post with form token and extra headers",
+			request:     UserInfoRequestConfig{Method: "post", TokenPlacement: TokenPlacementForm, Headers: map[string]string{"x-api-version": "2"}},
+			contentType: "application/json",
+			response:    `{"id": "USER_ID"}`,
+			check: func(r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method, "form")
+				assert.Empty(t, r.Header.Get("Authorization"), "form")
+				assert.Equal(t, "ACCESS_TOKEN", r.PostFormValue("access_token"), "form")
+				assert.Equal(t, "2", r.Header.Get("X-Api-Version"), "form")
+			},
+			expected: `{"id": "USER_ID"}`,
+		},
+		{
+			name:        "signed userinfo",
+			request:     UserInfoRequestConfig{Accept: "application/jwt"},
+			contentType: "application/jwt",
+			// {"id":"USER_ID"}
+			response: "eyJhbGciOiJSUzI1NiJ9.eyJpZCI6IlVTRVJfSUQifQ.c2ln",
+			check: func(r *http.Request) {
+				assert.Equal(t, "application/jwt", r.Header.Get("Accept"), "signed userinfo")
+			},
+			expected: `{"id":"USER_ID"}`,
+		},
+		{
+			name:          "html response",
+			contentType:   "text/html",
+			response:      `<html></html>`,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.check != nil {
+				tt.check(r)
+			}
+			w.Header().Set("Content-Type", tt.contentType)
+			w.Write([]byte(tt.response))
+		}))
+
+		client := &GenericClient{HttpClient: http.DefaultClient, userInfoRequest: tt.request}
+		client.userInfoUrl, _ = url.Parse(server.URL)
+		res, err := client.FetchUserInfo(context.TODO(), &Token{Access: "ACCESS_TOKEN"})
+		if tt.expectedError {
+			assert.Error(t, err, tt.name)
+		} else if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expected, string(res), tt.name)
+		}
+
+		server.Close()
+	}
+
+	// canceled context is propagated to the request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	client := &GenericClient{HttpClient: http.DefaultClient}
+	client.userInfoUrl, _ = url.Parse(server.URL)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err := client.FetchUserInfo(ctx, &Token{Access: "ACCESS_TOKEN"})
+	assert.ErrorIs(t, err, context.Canceled, "canceled context")
+}
+
+func TestUserInfoRequestConfig_validate(t *testing.T) {
+	assert.NoError(t, UserInfoRequestConfig{}.validate())
+	assert.NoError(t, UserInfoRequestConfig{Method: "POST", TokenPlacement: TokenPlacementForm}.validate())
+	assert.Error(t, UserInfoRequestConfig{Method: "GET", TokenPlacement: TokenPlacementForm}.validate())
+	assert.Error(t, UserInfoRequestConfig{Method: "PUT"}.validate())
+	assert.Error(t, UserInfoRequestConfig{TokenPlacement: "query"}.validate())
+}
+
 func TestGenericClient_RefreshToken(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -0,0 +1,149 @@
+package mapping
+
+import (
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/oidc/claims"
+	"myoidc/internal/service/oidc/client"
+	"myoidc/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// PermissionRuleConfig extracts role values from a claim.
+//
+// Examples:
+//
+//	{Claim: "groups"}                                           flat array
+//	{Claim: "realm_access.roles"}                               Keycloak realm roles
+//	{Claim: "resource_access.*.roles", Format: "{1}:{value}"}   Keycloak client roles as "client:role"
+//	{Claim: `["https://myapp/roles"]`}                          namespaced Auth0 claim
+//	{Claim: "scope", Separator: " "}                            space delimited string
+type PermissionRuleConfig struct {
+	// Claim is a claim path, "*" segments iterate over object keys or array elements.
+	Claim string
+	// Separator splits string claims into several values.
+	Separator string
+	// Format builds the role from "{value}" and "{1}", "{2}"... substituted with wildcard matches.
+	Format string
+}
+
+// RoleConfig is a static role to permissions table entry.
+type RoleConfig struct {
+	Role        string
+	Permissions []string
+}
+
+type PermissionsConfig struct {
+	Rules []PermissionRuleConfig
+	Roles []RoleConfig
+	// OnlyMapped drops roles that are missing in the Roles table instead of using them as permissions.
+	OnlyMapped bool
+}
+
+// PermissionMapper converts role and group claims to domain.User permissions.
+type PermissionMapper struct {
+	rules      []permissionRule
+	roles      map[string][]string
+	onlyMapped bool
+}
+
+type permissionRule struct {
+	path      claims.Path
+	separator string
+	format    string
+}
+
+func NewPermissionMapper(cfg PermissionsConfig) (*PermissionMapper, error) {
+	pm := &PermissionMapper{
+		rules:      make([]permissionRule, 0, len(cfg.Rules)),
+		roles:      make(map[string][]string, len(cfg.Roles)),
+		onlyMapped: cfg.OnlyMapped,
+	}
+	for i, r := range cfg.Rules {
+		p, err := claims.ParsePath(r.Claim)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid permission rule [%d]", i)
+		}
+		format := r.Format
+		if format == "" {
+			format = "{value}"
+		}
+		pm.rules = append(pm.rules, permissionRule{path: p, separator: r.Separator, format: format})
+	}
+	for _, r := range cfg.Roles {
+		if r.Role == "" {
+			return nil, errors.Error("role name is empty in permission roles table")
+		}
+		pm.roles[r.Role] = append(pm.roles[r.Role], r.Permissions...)
+	}
+	return pm, nil
+}
+
+// Map returns unique permissions in order of appearance.
+func (pm PermissionMapper) Map(m map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	add := func(perm string) {
+		if perm != "" && !seen[perm] {
+			seen[perm] = true
+			res = append(res, perm)
+		}
+	}
+
+	for _, r := range pm.rules {
+		for _, match := range r.path.LookupAll(m) {
+			for _, value := range claims.Strings(match.Value) {
+				for _, role := range r.split(value) {
+					role = r.apply(role, match.Wildcards)
+					perms, mapped := pm.roles[role]
+					if mapped {
+						for _, perm := range perms {
+							add(perm)
+						}
+					} else if !pm.onlyMapped {
+						add(role)
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+func (r permissionRule) split(value string) []string {
+	if r.separator == "" {
+		return []string{value}
+	}
+	return strings.Split(value, r.separator)
+}
+
+func (r permissionRule) apply(value string, wildcards []string) string {
+	res := strings.ReplaceAll(r.format, "{value}", value)
+	for i, w := range wildcards {
+		res = strings.ReplaceAll(res, "{"+strconv.Itoa(i+1)+"}", w)
+	}
+	return res
+}
+
+// PermissionsUnmarshaler decorates an unmarshaler filling domain.User.Permissions by PermissionMapper.
+type PermissionsUnmarshaler struct {
+	Base   client.UserInfoUnmarshaler
+	Mapper *PermissionMapper
+}
+
+func (um PermissionsUnmarshaler) UnmarshalUserInfo(body []byte, user *domain.User) error {
+	err := um.Base.UnmarshalUserInfo(body, user)
+	if err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	err = json.Unmarshal(body, &m)
+	if err != nil {
+		return err
+	}
+	user.Permissions = um.Mapper.Map(m)
+
+	return nil
+}
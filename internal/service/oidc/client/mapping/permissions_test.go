@@ -0,0 +1,88 @@
+package mapping
+
+import (
+	"myoidc/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermissionMapper_Map(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      PermissionsConfig
+		body     string
+		expected []string
+	}{
+		{
+			name:     "flat array",
+			cfg:      PermissionsConfig{Rules: []PermissionRuleConfig{{Claim: "groups"}}},
+			body:     `{"sub": "123", "groups": ["admins", "users"]}`,
+			expected: []string{"admins", "users"},
+		},
+		{
+			name: "keycloak realm and client roles",
+			cfg: PermissionsConfig{Rules: []PermissionRuleConfig{
+				{Claim: "realm_access.roles"},
+				{Claim: "resource_access.*.roles", Format: "{1}:{value}"},
+			}},
+			body: `{
+				"sub": "123",
+				"realm_access": {"roles": ["offline_access"]},
+				"resource_access": {
+					"billing": {"roles": ["read", "write"]},
+					"account": {"roles": ["manage-account"]}
+				}
+			}`,
+			expected: []string{"offline_access", "account:manage-account", "billing:read", "billing:write"},
+		},
+		{
+			name: "entra roles and groups with static table",
+			cfg: PermissionsConfig{
+				Rules: []PermissionRuleConfig{{Claim: "roles"}, {Claim: "groups"}},
+				Roles: []RoleConfig{
+					{Role: "Billing.Admin", Permissions: []string{"billing:read", "billing:write"}},
+					{Role: "6f1c2e0a-0000-0000-0000-000000000001", Permissions: []string{"billing:read", "reports:read"}},
+				},
+				OnlyMapped: true,
+			},
+			body:     `{"sub": "123", "roles": ["Billing.Admin", "Unknown"], "groups": ["6f1c2e0a-0000-0000-0000-000000000001"]}`,
+			expected: []string{"billing:read", "billing:write", "reports:read"},
+		},
+		{
+			name:     "namespaced auth0 claim",
+			cfg:      PermissionsConfig{Rules: []PermissionRuleConfig{{Claim: `["https://myoidc/roles"]`, Format: "role:{value}"}}},
+			body:     `{"sub": "123", "https://myoidc/roles": ["editor"]}`,
+			expected: []string{"role:editor"},
+		},
+		{
+			name:     "separated string",
+			cfg:      PermissionsConfig{Rules: []PermissionRuleConfig{{Claim: "scope", Separator: " "}}},
+			body:     `{"sub": "123", "scope": "read write"}`,
+			expected: []string{"read", "write"},
+		},
+		{
+			name:     "missing claim",
+			cfg:      PermissionsConfig{Rules: []PermissionRuleConfig{{Claim: "roles"}}},
+			body:     `{"sub": "123"}`,
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		pm, err := NewPermissionMapper(tt.cfg)
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+		base, err := NewMappingUnmarshaler(Config{Id: RuleConfig{Claims: []string{"sub"}}})
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+		um := PermissionsUnmarshaler{Base: base, Mapper: pm}
+		var user domain.User
+		err = um.UnmarshalUserInfo([]byte(tt.body), &user)
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expected, user.Permissions, tt.name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package mapping
+
+import (
+	"myoidc/pkg/errors"
+	"strings"
+)
+
+// Transform modifies a single claim value after it was resolved.
+type Transform func(string) string
+
+// ParseTransform parses transform spec of form "name" or "name:argument".
+//
+// Supported transforms:
+//
+//	trim_prefix:<prefix>   removes exact prefix (not a cutset like strings.TrimLeft)
+//	trim_suffix:<suffix>   removes exact suffix
+//	trim_space             removes leading and trailing white spaces
+//	lowercase              converts to lower case
+//	uppercase              converts to upper case
+//	before:<sep>           keeps the part before the first separator, e.g. "before:@" for email local part
+//	after:<sep>            keeps the part after the first separator
+func ParseTransform(spec string) (Transform, error) {
+	name, arg, hasArg := strings.Cut(spec, ":")
+	switch name {
+	case "trim_prefix":
+		if !hasArg {
+			return nil, errors.Errorf("transform \"%s\" requires an argument", name)
+		}
+		return func(s string) string { return strings.TrimPrefix(s, arg) }, nil
+	case "trim_suffix":
+		if !hasArg {
+			return nil, errors.Errorf("transform \"%s\" requires an argument", name)
+		}
+		return func(s string) string { return strings.TrimSuffix(s, arg) }, nil
+	case "trim_space":
+		return strings.TrimSpace, nil
+	case "lowercase":
+		return strings.ToLower, nil
+	case "uppercase":
+		return strings.ToUpper, nil
+	case "before":
+		if !hasArg || arg == "" {
+			return nil, errors.Errorf("transform \"%s\" requires an argument", name)
+		}
+		return func(s string) string {
+			before, _, _ := strings.Cut(s, arg)
+			return before
+		}, nil
+	case "after":
+		if !hasArg || arg == "" {
+			return nil, errors.Errorf("transform \"%s\" requires an argument", name)
+		}
+		return func(s string) string {
+			_, after, found := strings.Cut(s, arg)
+			if !found {
+				return s
+			}
+			return after
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown transform \"%s\"", spec)
+	}
+}
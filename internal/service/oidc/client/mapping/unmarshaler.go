@@ -0,0 +1,148 @@
+package mapping
+
+import (
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/oidc/claims"
+	"myoidc/pkg/errors"
+	"strings"
+)
+
+// Name is the UserInfoUnmarshaler value selecting declarative claim mapping.
+const Name = "mapping"
+
+// RuleConfig describes how a single domain.User field is resolved from claims.
+type RuleConfig struct {
+	// Claims are claim paths tried in order, the first non-empty value wins.
+	Claims []string
+	// Transforms are applied to every resolved value in order, see ParseTransform.
+	Transforms []string
+	// Join concatenates array claims with the separator. Without it only the first element is used.
+	Join string
+}
+
+type Config struct {
+	Id        RuleConfig
+	Login     RuleConfig
+	Email     RuleConfig
+	FullName  RuleConfig
+	FirstName RuleConfig
+	LastName  RuleConfig
+}
+
+type rule struct {
+	paths      []claims.Path
+	transforms []Transform
+	join       *string
+}
+
+// MappingUnmarshaler maps userinfo claims to domain.User according to declarative rules,
+// so a new provider doesn't require a hand-written unmarshaler.
+type MappingUnmarshaler struct {
+	id        *rule
+	login     *rule
+	email     *rule
+	fullName  *rule
+	firstName *rule
+	lastName  *rule
+}
+
+func NewMappingUnmarshaler(cfg Config) (*MappingUnmarshaler, error) {
+	var um MappingUnmarshaler
+	var err error
+	fields := []struct {
+		name string
+		cfg  RuleConfig
+		dist **rule
+	}{
+		{"Id", cfg.Id, &um.id},
+		{"Login", cfg.Login, &um.login},
+		{"Email", cfg.Email, &um.email},
+		{"FullName", cfg.FullName, &um.fullName},
+		{"FirstName", cfg.FirstName, &um.firstName},
+		{"LastName", cfg.LastName, &um.lastName},
+	}
+	for _, f := range fields {
+		*f.dist, err = newRule(f.cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid claim mapping for field %s", f.name)
+		}
+	}
+	if um.id == nil {
+		return nil, errors.Error("claim mapping for field Id is required")
+	}
+	return &um, nil
+}
+
+func newRule(cfg RuleConfig) (*rule, error) {
+	if len(cfg.Claims) == 0 {
+		return nil, nil
+	}
+	r := &rule{}
+	for _, c := range cfg.Claims {
+		p, err := claims.ParsePath(c)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, p)
+	}
+	for _, t := range cfg.Transforms {
+		tr, err := ParseTransform(t)
+		if err != nil {
+			return nil, err
+		}
+		r.transforms = append(r.transforms, tr)
+	}
+	if cfg.Join != "" {
+		r.join = &cfg.Join
+	}
+	return r, nil
+}
+
+func (um MappingUnmarshaler) UnmarshalUserInfo(body []byte, user *domain.User) error {
+	var m map[string]interface{}
+	err := json.Unmarshal(body, &m)
+	if err != nil {
+		return err
+	}
+
+	user.Id = um.id.resolve(m)
+	if user.Id == "" {
+		return errors.Error("user id claim is missing or empty")
+	}
+	user.Login = um.login.resolve(m)
+	user.Email = um.email.resolve(m)
+	user.FullName = um.fullName.resolve(m)
+	user.FirstName = um.firstName.resolve(m)
+	user.LastName = um.lastName.resolve(m)
+
+	return nil
+}
+
+func (r *rule) resolve(m map[string]interface{}) string {
+	if r == nil {
+		return ""
+	}
+	for _, p := range r.paths {
+		v, ok := p.Lookup(m)
+		if !ok {
+			continue
+		}
+		values := claims.Strings(v)
+		for i := range values {
+			for _, t := range r.transforms {
+				values[i] = t(values[i])
+			}
+		}
+		var res string
+		if r.join != nil {
+			res = strings.Join(values, *r.join)
+		} else if len(values) > 0 {
+			res = values[0]
+		}
+		if res != "" {
+			return res
+		}
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package mapping
+
+import (
+	"myoidc/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingUnmarshaler_UnmarshalUserInfo(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           Config
+		body          string
+		expected      *domain.User
+		expectedError bool
+	}{
+		{
+			name: "auth0",
+			cfg: Config{
+				Id:        RuleConfig{Claims: []string{"sub"}, Transforms: []string{"trim_prefix:google-oauth2|"}},
+				Login:     RuleConfig{Claims: []string{"nickname"}},
+				Email:     RuleConfig{Claims: []string{"email"}},
+				FullName:  RuleConfig{Claims: []string{"name"}},
+				FirstName: RuleConfig{Claims: []string{"given_name"}},
+				LastName:  RuleConfig{Claims: []string{"family_name"}},
+			},
+			// "google-oauth2|" as a cutset would also strip the leading "go" of the id
+			body: `{"sub": "google-oauth2|good1234", "nickname": "jd", "email": "jd@mail.test",
+				"name": "John Dow", "given_name": "John", "family_name": "Dow"}`,
+			expected: &domain.User{
+				Id:        "good1234",
+				Login:     "jd",
+				Email:     "jd@mail.test",
+				FullName:  "John Dow",
+				FirstName: "John",
+				LastName:  "Dow",
+			},
+		},
+		{
+			name: "fallbacks and transforms",
+			cfg: Config{
+				Id:    RuleConfig{Claims: []string{"eduid", "sub"}},
+				Login: RuleConfig{Claims: []string{"preferred_username", "email"}, Transforms: []string{"before:@", "lowercase"}},
+				Email: RuleConfig{Claims: []string{"emails[1]", "emails[0]"}, Transforms: []string{"trim_space"}},
+			},
+			body: `{"sub": "123", "email": "John.Dow@Mail.test", "emails": [" jd@mail.test "]}`,
+			expected: &domain.User{
+				Id:    "123",
+				Login: "john.dow",
+				Email: "jd@mail.test",
+			},
+		},
+		{
+			name: "nested, namespaced and array claims",
+			cfg: Config{
+				Id:       RuleConfig{Claims: []string{"id"}},
+				Login:    RuleConfig{Claims: []string{`["https://app.test/claims"].login`}},
+				FullName: RuleConfig{Claims: []string{"names"}, Join: " "},
+				Email:    RuleConfig{Claims: []string{"emails"}},
+			},
+			body: `{"id": 42, "https://app.test/claims": {"login": "jd"}, "names": ["John", "Dow"], "emails": ["a@mail.test", "b@mail.test"]}`,
+			expected: &domain.User{
+				Id:       "42",
+				Login:    "jd",
+				FullName: "John Dow",
+				Email:    "a@mail.test",
+			},
+		},
+		{
+			name:          "missing id",
+			cfg:           Config{Id: RuleConfig{Claims: []string{"sub"}}, Login: RuleConfig{Claims: []string{"login"}}},
+			body:          `{"login": "jd"}`,
+			expectedError: true,
+		},
+		{
+			name:          "id emptied by transforms",
+			cfg:           Config{Id: RuleConfig{Claims: []string{"sub"}, Transforms: []string{"trim_prefix:auth0|"}}},
+			body:          `{"sub": "auth0|"}`,
+			expectedError: true,
+		},
+		{
+			name:          "invalid json",
+			cfg:           Config{Id: RuleConfig{Claims: []string{"sub"}}},
+			body:          `invalid json`,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		um, err := NewMappingUnmarshaler(tt.cfg)
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+		var user domain.User
+		err = um.UnmarshalUserInfo([]byte(tt.body), &user)
+		if tt.expectedError {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, tt.expected, &user, tt.name)
+		}
+	}
+}
+
+func TestNewMappingUnmarshaler(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "missing id", cfg: Config{Email: RuleConfig{Claims: []string{"email"}}}},
+		{name: "unknown transform", cfg: Config{Id: RuleConfig{Claims: []string{"sub"}, Transforms: []string{"reverse"}}}},
+		{name: "transform without argument", cfg: Config{Id: RuleConfig{Claims: []string{"sub"}, Transforms: []string{"trim_prefix"}}}},
+		{name: "invalid path", cfg: Config{Id: RuleConfig{Claims: []string{"emails[x]"}}}},
+		{name: "unclosed bracket", cfg: Config{Id: RuleConfig{Claims: []string{`["sub"`}}}},
+	}
+
+	for _, tt := range tests {
+		_, err := NewMappingUnmarshaler(tt.cfg)
+		assert.Error(t, err, tt.name)
+	}
+}
@@ -17,7 +17,7 @@ func (um OAuth0Unmarshaler) UnmarshalUserInfo(body []byte, user *domain.User) er
 	}
 
 	sub, _ := m["sub"].(string)
-	user.Id = strings.TrimLeft(sub, "google-oauth2|")
+	user.Id = strings.TrimPrefix(sub, "google-oauth2|")
 	user.Login, _ = m["nickname"].(string)
 	user.Email, _ = m["email"].(string)
 	user.FirstName, _ = m["given_name"].(string)
@@ -0,0 +1,20 @@
+package client
+
+import "myoidc/pkg/errors"
+
+// PresetFactory builds a client for a well known provider from partially filled config.
+type PresetFactory func(cfg ClientConfig) (Client, error)
+
+var presets = map[string]PresetFactory{}
+
+func RegisterPreset(name string, factory PresetFactory) {
+	presets[name] = factory
+}
+
+func newPresetClient(cfg ClientConfig) (Client, error) {
+	factory := presets[cfg.Preset]
+	if factory == nil {
+		return nil, errors.Errorf("unknown client preset \"%s\". Use client.RegisterPreset to register a new preset", cfg.Preset)
+	}
+	return factory(cfg)
+}
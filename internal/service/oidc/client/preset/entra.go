@@ -0,0 +1,134 @@
+package preset
+
+import (
+	"context"
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/oidc/claims"
+	"myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/client/mapping"
+	"myoidc/pkg/errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const Entra = "entra"
+
+// EntraUnmarshaler prefers "oid" which, unlike "sub", is the same for the user across applications.
+var EntraUnmarshaler = mustMapping(mapping.Config{
+	Id:        mapping.RuleConfig{Claims: []string{"oid", "sub"}},
+	Login:     mapping.RuleConfig{Claims: []string{"preferred_username", "upn", "email"}},
+	Email:     mapping.RuleConfig{Claims: []string{"email", "preferred_username", "upn"}},
+	FullName:  mapping.RuleConfig{Claims: []string{"name"}},
+	FirstName: mapping.RuleConfig{Claims: []string{"given_name"}},
+	LastName:  mapping.RuleConfig{Claims: []string{"family_name"}},
+})
+
+const entraIssuerTemplate = "https://login.microsoftonline.com/{tenantid}/v2.0"
+
+var guidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// EntraClient is a Microsoft Entra ID (Azure AD) v2.0 client.
+//
+// Multi-tenant apps (Tenant "common" or "organizations") publish issuer as a template
+// with "{tenantid}" placeholder, so the issuer of id_token is checked against the template
+// filled with the "tid" claim. AllowedTenants restricts tenants allowed to log in.
+// Roles and groups are present only in id_token, so its claims are merged into userinfo.
+// See https://learn.microsoft.com/en-us/entra/identity-platform/v2-protocols-oidc
+type EntraClient struct {
+	*client.GenericClient
+	clientId       string
+	tenant         string
+	allowedTenants map[string]bool
+}
+
+func NewEntraClient(cfg client.ClientConfig) (client.Client, error) {
+	tenant := cfg.Tenant
+	if tenant == "" {
+		tenant = "common"
+	}
+	baseUrl := "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0"
+	cfg = withDefaults(cfg,
+		baseUrl+"/authorize",
+		baseUrl+"/token",
+		"https://graph.microsoft.com/oidc/userinfo",
+		[]string{"openid", "profile", "email", "offline_access"},
+	)
+	generic, err := client.NewGenericClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool)
+	for _, t := range cfg.AllowedTenants {
+		allowed[strings.ToLower(t)] = true
+	}
+	return &EntraClient{
+		GenericClient:  generic,
+		clientId:       cfg.ClientId,
+		tenant:         strings.ToLower(tenant),
+		allowedTenants: allowed,
+	}, nil
+}
+
+func (cli EntraClient) FetchUserByToken(ctx context.Context, token *client.Token) (*domain.User, error) {
+	if token == nil || token.ID == "" {
+		return nil, errors.Error("id_token is required for entra provider")
+	}
+	idClaims, err := claims.DecodeJWT(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = cli.validateIDClaims(idClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := cli.FetchUserInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(body, &m)
+	if err != nil {
+		return nil, err
+	}
+	if sub, _ := m["sub"].(string); sub != idClaims["sub"] {
+		return nil, errors.New("userinfo subject doesn't match id_token subject")
+	}
+	for k, v := range idClaims {
+		if _, exists := m[k]; !exists {
+			m[k] = v
+		}
+	}
+
+	body, err = json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return cli.UnmarshalUserInfo(body)
+}
+
+func (cli EntraClient) validateIDClaims(m map[string]interface{}) error {
+	tid, _ := m["tid"].(string)
+	if tid == "" {
+		return errors.Error("id_token has no tid claim")
+	}
+	tid = strings.ToLower(tid)
+
+	expectedIssuer := strings.Replace(entraIssuerTemplate, "{tenantid}", tid, 1)
+	if iss, _ := m["iss"].(string); !strings.EqualFold(iss, expectedIssuer) {
+		return errors.Errorf("id_token issuer \"%s\" doesn't match \"%s\"", iss, expectedIssuer)
+	}
+	if !claims.HasAudience(m, cli.clientId) {
+		return errors.Error("id_token audience doesn't match client id")
+	}
+	if guidRegexp.MatchString(cli.tenant) && tid != cli.tenant {
+		return errors.Errorf("tenant \"%s\" doesn't match configured tenant", tid)
+	}
+	if len(cli.allowedTenants) > 0 && !cli.allowedTenants[tid] {
+		return errors.Errorf("tenant \"%s\" is not allowed", tid)
+	}
+	return nil
+}
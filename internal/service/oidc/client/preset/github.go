@@ -0,0 +1,94 @@
+package preset
+
+import (
+	"context"
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/client/mapping"
+	"myoidc/pkg/errors"
+	"strings"
+)
+
+const GitHub = "github"
+
+// GitHubUnmarshaler maps GitHub REST API /user response merged with the primary email.
+var GitHubUnmarshaler = mustMapping(mapping.Config{
+	Id:       mapping.RuleConfig{Claims: []string{"id"}},
+	Login:    mapping.RuleConfig{Claims: []string{"login"}},
+	Email:    mapping.RuleConfig{Claims: []string{"email"}},
+	FullName: mapping.RuleConfig{Claims: []string{"name", "login"}},
+})
+
+// GitHubClient is a plain OAuth2 client: GitHub has no OIDC userinfo endpoint, so user is built
+// from /user and /user/emails REST API calls. BaseUrl switches to GitHub Enterprise Server.
+// See https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/authorizing-oauth-apps
+type GitHubClient struct {
+	*client.GenericClient
+	userUrl   string
+	emailsUrl string
+}
+
+func NewGitHubClient(cfg client.ClientConfig) (client.Client, error) {
+	baseUrl, apiUrl := "https://github.com", "https://api.github.com"
+	if cfg.BaseUrl != "" {
+		baseUrl = strings.TrimRight(cfg.BaseUrl, "/")
+		apiUrl = baseUrl + "/api/v3"
+	}
+	cfg = withDefaults(cfg,
+		baseUrl+"/login/oauth/authorize",
+		baseUrl+"/login/oauth/access_token",
+		apiUrl+"/user",
+		[]string{"read:user", "user:email"},
+	)
+
+	generic, err := client.NewGenericClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubClient{
+		GenericClient: generic,
+		userUrl:       cfg.UserInfoUrl,
+		emailsUrl:     apiUrl + "/user/emails",
+	}, nil
+}
+
+type gitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (cli GitHubClient) FetchUserByToken(ctx context.Context, token *client.Token) (*domain.User, error) {
+	if token == nil || !token.Valid() {
+		return nil, errors.Error("token is invalid")
+	}
+
+	const accept = "application/vnd.github+json"
+	var user map[string]interface{}
+	err := getJSON(ctx, cli.HttpClient, cli.userUrl, token, accept, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	// public email is empty when user hides it, the primary one is available with user:email scope
+	if email, _ := user["email"].(string); email == "" {
+		var emails []gitHubEmail
+		err = getJSON(ctx, cli.HttpClient, cli.emailsUrl, token, accept, &emails)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				user["email"] = e.Email
+				break
+			}
+		}
+	}
+
+	body, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	return cli.UnmarshalUserInfo(body)
+}
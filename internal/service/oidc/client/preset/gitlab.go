@@ -0,0 +1,32 @@
+package preset
+
+import (
+	"myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/client/mapping"
+	"strings"
+)
+
+const GitLab = "gitlab"
+
+var GitLabUnmarshaler = mustMapping(mapping.Config{
+	Id:       mapping.RuleConfig{Claims: []string{"sub"}},
+	Login:    mapping.RuleConfig{Claims: []string{"nickname", "preferred_username"}},
+	Email:    mapping.RuleConfig{Claims: []string{"email"}},
+	FullName: mapping.RuleConfig{Claims: []string{"name"}},
+})
+
+// NewGitLabClient builds client for gitlab.com or self-managed instance set by BaseUrl.
+// See https://docs.gitlab.com/ee/integration/openid_connect_provider.html
+func NewGitLabClient(cfg client.ClientConfig) (client.Client, error) {
+	baseUrl := "https://gitlab.com"
+	if cfg.BaseUrl != "" {
+		baseUrl = strings.TrimRight(cfg.BaseUrl, "/")
+	}
+	cfg = withDefaults(cfg,
+		baseUrl+"/oauth/authorize",
+		baseUrl+"/oauth/token",
+		baseUrl+"/oauth/userinfo",
+		[]string{"openid", "profile", "email"},
+	)
+	return client.NewGenericClient(cfg)
+}
@@ -0,0 +1,74 @@
+package preset
+
+import (
+	"context"
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/client/mapping"
+	"myoidc/pkg/errors"
+	"net/url"
+)
+
+const Google = "google"
+
+var GoogleUnmarshaler = mustMapping(mapping.Config{
+	Id:        mapping.RuleConfig{Claims: []string{"sub"}},
+	Login:     mapping.RuleConfig{Claims: []string{"email"}, Transforms: []string{"before:@"}},
+	Email:     mapping.RuleConfig{Claims: []string{"email"}},
+	FullName:  mapping.RuleConfig{Claims: []string{"name"}},
+	FirstName: mapping.RuleConfig{Claims: []string{"given_name"}},
+	LastName:  mapping.RuleConfig{Claims: []string{"family_name"}},
+})
+
+// GoogleClient restricts login to a Google Workspace domain if HostedDomain is set.
+// The "hd" auth parameter only optimizes account chooser UI, so the claim is verified as well.
+// See https://developers.google.com/identity/openid-connect/openid-connect
+type GoogleClient struct {
+	*client.GenericClient
+	hostedDomain string
+}
+
+func NewGoogleClient(cfg client.ClientConfig) (client.Client, error) {
+	cfg = withDefaults(cfg,
+		"https://accounts.google.com/o/oauth2/v2/auth",
+		"https://oauth2.googleapis.com/token",
+		"https://openidconnect.googleapis.com/v1/userinfo",
+		[]string{"openid", "profile", "email"},
+	)
+	generic, err := client.NewGenericClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleClient{
+		GenericClient: generic,
+		hostedDomain:  cfg.HostedDomain,
+	}, nil
+}
+
+func (cli GoogleClient) BuildAuthURL(ctx context.Context, state string, scopes []string, params ...client.UrlParam) (*url.URL, error) {
+	if cli.hostedDomain != "" {
+		params = append(params, client.NewUrlParam("hd", cli.hostedDomain))
+	}
+	return cli.GenericClient.BuildAuthURL(ctx, state, scopes, params...)
+}
+
+func (cli GoogleClient) FetchUserByToken(ctx context.Context, token *client.Token) (*domain.User, error) {
+	body, err := cli.FetchUserInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if cli.hostedDomain != "" {
+		var m map[string]interface{}
+		err = json.Unmarshal(body, &m)
+		if err != nil {
+			return nil, err
+		}
+		if hd, _ := m["hd"].(string); hd != cli.hostedDomain {
+			return nil, errors.Errorf("user hosted domain \"%s\" is not allowed", hd)
+		}
+	}
+
+	return cli.UnmarshalUserInfo(body)
+}
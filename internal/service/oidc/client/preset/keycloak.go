@@ -0,0 +1,36 @@
+package preset
+
+import (
+	"myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/client/mapping"
+	"myoidc/pkg/errors"
+	"net/url"
+	"strings"
+)
+
+const Keycloak = "keycloak"
+
+var KeycloakUnmarshaler = mustMapping(mapping.Config{
+	Id:        mapping.RuleConfig{Claims: []string{"sub"}},
+	Login:     mapping.RuleConfig{Claims: []string{"preferred_username"}},
+	Email:     mapping.RuleConfig{Claims: []string{"email"}},
+	FullName:  mapping.RuleConfig{Claims: []string{"name"}},
+	FirstName: mapping.RuleConfig{Claims: []string{"given_name"}},
+	LastName:  mapping.RuleConfig{Claims: []string{"family_name"}},
+})
+
+// NewKeycloakClient builds client for realm endpoints of Keycloak server at BaseUrl.
+// See https://www.keycloak.org/docs/latest/securing_apps/#endpoints
+func NewKeycloakClient(cfg client.ClientConfig) (client.Client, error) {
+	if cfg.BaseUrl == "" || cfg.Realm == "" {
+		return nil, errors.Error("keycloak preset requires BaseUrl and Realm")
+	}
+	realmUrl := strings.TrimRight(cfg.BaseUrl, "/") + "/realms/" + url.PathEscape(cfg.Realm) + "/protocol/openid-connect"
+	cfg = withDefaults(cfg,
+		realmUrl+"/auth",
+		realmUrl+"/token",
+		realmUrl+"/userinfo",
+		[]string{"openid", "profile", "email"},
+	)
+	return client.NewGenericClient(cfg)
+}
@@ -0,0 +1,63 @@
+package preset
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/client/mapping"
+	"myoidc/pkg/errors"
+	"net/http"
+)
+
+func mustMapping(cfg mapping.Config) *mapping.MappingUnmarshaler {
+	um, err := mapping.NewMappingUnmarshaler(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return um
+}
+
+func withDefaults(cfg client.ClientConfig, authUrl, tokenUrl, userInfoUrl string, scopes []string) client.ClientConfig {
+	if cfg.AuthUrl == "" {
+		cfg.AuthUrl = authUrl
+	}
+	if cfg.TokenUrl == "" {
+		cfg.TokenUrl = tokenUrl
+	}
+	if cfg.UserInfoUrl == "" {
+		cfg.UserInfoUrl = userInfoUrl
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = scopes
+	}
+	if cfg.UserInfoUnmarshaler == "" {
+		cfg.UserInfoUnmarshaler = cfg.Preset
+	}
+	return cfg
+}
+
+func getJSON(ctx context.Context, httpClient *http.Client, url string, token *client.Token, accept string, dist interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Access)
+	req.Header.Set("Accept", accept)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return errors.Wrapf(client.ErrTokenRejected, "invalid response from %s: %d %s", url, res.StatusCode, body)
+	} else if res.StatusCode != http.StatusOK {
+		return errors.Errorf("invalid response from %s: %d %s", url, res.StatusCode, body)
+	}
+	return json.Unmarshal(body, dist)
+}
@@ -0,0 +1,168 @@
+package preset
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"myoidc/internal/domain"
+	"myoidc/internal/service/oidc/client"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	client.RegisterUnmarshaler(GitHub, GitHubUnmarshaler)
+	client.RegisterUnmarshaler(Google, GoogleUnmarshaler)
+	client.RegisterUnmarshaler(Entra, EntraUnmarshaler)
+	client.RegisterUnmarshaler(Keycloak, KeycloakUnmarshaler)
+}
+
+func TestGitHubClient_FetchUserByToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer ACCESS_TOKEN", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v3/user":
+			w.Write([]byte(`{"id": 583231, "login": "octocat", "name": "The Octocat", "email": null}`))
+		case "/api/v3/user/emails":
+			w.Write([]byte(`[
+				{"email": "old@mail.test", "primary": false, "verified": true},
+				{"email": "octocat@mail.test", "primary": true, "verified": true}
+			]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cli, err := NewGitHubClient(client.ClientConfig{Preset: GitHub, BaseUrl: server.URL})
+	if !assert.NoError(t, err) {
+		return
+	}
+	user, err := cli.FetchUserByToken(context.TODO(), &client.Token{Access: "ACCESS_TOKEN"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &domain.User{
+			Id:       "583231",
+			Login:    "octocat",
+			Email:    "octocat@mail.test",
+			FullName: "The Octocat",
+		}, user)
+	}
+}
+
+func TestGoogleClient(t *testing.T) {
+	hd := "example.test"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sub": "1", "email": "jd@` + hd + `", "hd": "` + hd + `"}`))
+	}))
+	defer server.Close()
+
+	cli, err := NewGoogleClient(client.ClientConfig{
+		Preset:       Google,
+		UserInfoUrl:  server.URL,
+		HostedDomain: "example.test",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	authUrl, err := cli.BuildAuthURL(context.TODO(), "state", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.test", authUrl.Query().Get("hd"), "hd auth param")
+		assert.Equal(t, "openid profile email", authUrl.Query().Get("scope"), "default scopes")
+	}
+
+	user, err := cli.FetchUserByToken(context.TODO(), &client.Token{Access: "ACCESS_TOKEN"})
+	if assert.NoError(t, err, "allowed domain") {
+		assert.Equal(t, "jd", user.Login)
+	}
+
+	hd = "other.test"
+	_, err = cli.FetchUserByToken(context.TODO(), &client.Token{Access: "ACCESS_TOKEN"})
+	assert.Error(t, err, "foreign domain")
+}
+
+func TestEntraClient_FetchUserByToken(t *testing.T) {
+	const tenant = "9188040d-6c67-4c5b-b112-36a304b66dad"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sub": "SUB", "name": "John Dow", "email": "jd@mail.test"}`))
+	}))
+	defer server.Close()
+
+	idToken := func(claims map[string]interface{}) string {
+		payload, _ := json.Marshal(claims)
+		return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+	}
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://login.microsoftonline.com/" + tenant + "/v2.0",
+			"aud":   "client_id",
+			"tid":   tenant,
+			"sub":   "SUB",
+			"oid":   "OID",
+			"roles": []string{"Billing.Admin"},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		tenant         string
+		allowedTenants []string
+		claims         func(m map[string]interface{})
+		expectedError  bool
+	}{
+		{name: "multi-tenant", tenant: "common"},
+		{name: "single tenant", tenant: tenant},
+		{name: "allowed tenant", tenant: "organizations", allowedTenants: []string{tenant}},
+		{name: "not allowed tenant", allowedTenants: []string{"00000000-0000-0000-0000-000000000000"}, expectedError: true},
+		{name: "other tenant", tenant: "00000000-0000-0000-0000-000000000000", expectedError: true},
+		{name: "issuer mismatch", claims: func(m map[string]interface{}) {
+			m["iss"] = "https://login.microsoftonline.com/00000000-0000-0000-0000-000000000000/v2.0"
+		}, expectedError: true},
+		{name: "audience mismatch", claims: func(m map[string]interface{}) { m["aud"] = "other" }, expectedError: true},
+		{name: "subject mismatch", claims: func(m map[string]interface{}) { m["sub"] = "OTHER" }, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		cli, err := NewEntraClient(client.ClientConfig{
+			Preset:         Entra,
+			ClientId:       "client_id",
+			Tenant:         tt.tenant,
+			AllowedTenants: tt.allowedTenants,
+			UserInfoUrl:    server.URL,
+		})
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+		claims := validClaims()
+		if tt.claims != nil {
+			tt.claims(claims)
+		}
+
+		user, err := cli.FetchUserByToken(context.TODO(), &client.Token{Access: "ACCESS_TOKEN", ID: idToken(claims)})
+		if tt.expectedError {
+			assert.Error(t, err, tt.name)
+		} else if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, "OID", user.Id, tt.name)
+			assert.Equal(t, "John Dow", user.FullName, tt.name)
+		}
+	}
+}
+
+func TestNewKeycloakClient(t *testing.T) {
+	_, err := NewKeycloakClient(client.ClientConfig{Preset: Keycloak})
+	assert.Error(t, err, "missing realm")
+
+	cli, err := NewKeycloakClient(client.ClientConfig{Preset: Keycloak, BaseUrl: "https://sso.test/", Realm: "main"})
+	if assert.NoError(t, err) {
+		authUrl, err := cli.BuildAuthURL(context.TODO(), "", nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "https://sso.test/realms/main/protocol/openid-connect/auth", authUrl.Scheme+"://"+authUrl.Host+authUrl.Path)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"encoding/json"
 	"myoidc/internal/domain"
+	"myoidc/pkg/errors"
 )
 
 var unmarshalers map[string]UserInfoUnmarshaler
@@ -17,6 +18,15 @@ func RegisterUnmarshaler(name string, um UserInfoUnmarshaler) {
 	unmarshalers[name] = um
 }
 
+// GetUnmarshaler returns registered unmarshaler by name.
+func GetUnmarshaler(name string) (UserInfoUnmarshaler, error) {
+	um := unmarshalers[name]
+	if um == nil {
+		return nil, errors.Errorf("unknown user unmarshaler \"%s\". Use client.RegisterUnmarshaler to register a new unmarshaler type", name)
+	}
+	return um, nil
+}
+
 type UserInfoUnmarshaler interface {
 	UnmarshalUserInfo(body []byte, user *domain.User) error
 }
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"myoidc/internal/service/oidc/claims"
+	"myoidc/pkg/errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	TokenPlacementHeader = "header"
+	TokenPlacementForm   = "form"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeJWT  = "application/jwt"
+)
+
+// UserInfoRequestConfig describes how userinfo endpoint is called.
+// See https://openid.net/specs/openid-connect-core-1_0.html#UserInfoRequest and RFC 6750 section 2.
+type UserInfoRequestConfig struct {
+	// Method is GET (default) or POST.
+	Method string
+	// TokenPlacement is "header" (default) for Authorization: Bearer or "form" for access_token form parameter.
+	// Form placement requires POST method.
+	TokenPlacement string
+	// Headers are extra request headers.
+	Headers map[string]string
+	// Accept is sent as Accept header, "application/json" by default.
+	// Signed userinfo responses (application/jwt) are supported as well.
+	Accept string
+}
+
+func (cfg UserInfoRequestConfig) validate() error {
+	switch strings.ToUpper(cfg.Method) {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return errors.Errorf("unsupported userinfo request method \"%s\"", cfg.Method)
+	}
+	switch cfg.TokenPlacement {
+	case "", TokenPlacementHeader:
+	case TokenPlacementForm:
+		if !strings.EqualFold(cfg.Method, http.MethodPost) {
+			return errors.Error("form token placement requires POST userinfo request method")
+		}
+	default:
+		return errors.Errorf("unsupported userinfo token placement \"%s\"", cfg.TokenPlacement)
+	}
+	return nil
+}
+
+func (cfg UserInfoRequestConfig) newRequest(ctx context.Context, userInfoUrl string, token *Token) (*http.Request, error) {
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if cfg.TokenPlacement == TokenPlacementForm {
+		body = strings.NewReader(url.Values{"access_token": {token.Access}}.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, userInfoUrl, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	accept := cfg.Accept
+	if accept == "" {
+		accept = contentTypeJSON
+	}
+	req.Header.Set("Accept", accept)
+	if cfg.TokenPlacement == TokenPlacementForm {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req.Header.Set("Authorization", "Bearer "+token.Access)
+	}
+	return req, nil
+}
+
+// decodeUserInfoResponse returns userinfo claims as JSON according to response content type.
+func decodeUserInfoResponse(res *http.Response, body []byte) ([]byte, error) {
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" {
+		return body, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid userinfo content type \"%s\"", contentType)
+	}
+
+	switch {
+	case mediaType == contentTypeJSON || strings.HasSuffix(mediaType, "+json"):
+		return body, nil
+	case mediaType == contentTypeJWT:
+		// response is received directly from the provider over TLS, see claims.DecodeJWT
+		m, err := claims.DecodeJWT(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid signed userinfo response")
+		}
+		return json.Marshal(m)
+	default:
+		return nil, errors.Errorf("unexpected userinfo content type \"%s\"", mediaType)
+	}
+}
@@ -0,0 +1,107 @@
+package transaction
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+	"time"
+)
+
+// DefaultSealedTTL is used when SealedStore is created without ttl.
+const DefaultSealedTTL = 10 * time.Minute
+
+// stateAdditionalData separates sealed states from other data sealed by the same keys.
+var stateAdditionalData = []byte("login-state")
+
+// sealedState is the payload of the state token, short names keep the state compact.
+type sealedState struct {
+	Provider     string `json:"p"`
+	CodeVerifier string `json:"v,omitempty"`
+	Nonce        string `json:"n,omitempty"`
+	BackUrl      string `json:"b,omitempty"`
+	ExpiresAt    int64  `json:"e"`
+	// Binding is a hash of the browser cookie, the cookie itself never leaves the browser.
+	Binding string `json:"h"`
+}
+
+// SealedStore keeps nothing on the server, the transaction is sealed into the state parameter
+// and bound to the browser by a random cookie. Any replica sharing the keys completes the
+// login. A state can be replayed by the same browser until it expires, the authorization
+// code is single use at the identity provider though.
+type SealedStore struct {
+	keys *keyring.KeyRing
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+// NewSealedStore creates store, only session.WithClock of opts is used.
+func NewSealedStore(keys *keyring.KeyRing, ttl time.Duration, opts ...session.Option) *SealedStore {
+	if ttl <= 0 {
+		ttl = DefaultSealedTTL
+	}
+	s := &SealedStore{
+		keys: keys,
+		ttl:  ttl,
+	}
+	s.now = session.ApplyOptions(s, opts).Now
+	return s
+}
+
+func (s *SealedStore) Begin(ctx context.Context, tx session.LoginTransaction) (string, string, error) {
+	binding, err := session.NewId()
+	if err != nil {
+		return "", "", err
+	}
+	b, err := json.Marshal(sealedState{
+		Provider:     tx.ProviderName,
+		CodeVerifier: tx.CodeVerifier,
+		Nonce:        tx.Nonce,
+		BackUrl:      tx.BackUrl,
+		ExpiresAt:    s.now().Add(s.ttl).Unix(),
+		Binding:      hashBinding(binding),
+	})
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to encode login state")
+	}
+	state, err := s.keys.Seal(b, stateAdditionalData)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to seal login state")
+	}
+	return state, binding, nil
+}
+
+func (s *SealedStore) Complete(ctx context.Context, state string, binding string) (session.LoginTransaction, error) {
+	b, err := s.keys.Open(state, stateAdditionalData)
+	if err != nil {
+		return session.LoginTransaction{}, ErrStateMismatch
+	}
+	var payload sealedState
+	err = json.Unmarshal(b, &payload)
+	if err != nil {
+		return session.LoginTransaction{}, ErrStateMismatch
+	}
+	if s.now().Unix() >= payload.ExpiresAt {
+		return session.LoginTransaction{}, errors.WithField(ErrNotFound, "reason", "login state is expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(hashBinding(binding)), []byte(payload.Binding)) != 1 {
+		return session.LoginTransaction{}, errors.WithField(ErrNotFound, "reason", "login state is started by another browser")
+	}
+
+	return session.LoginTransaction{
+		ProviderName: payload.Provider,
+		State:        state,
+		CodeVerifier: payload.CodeVerifier,
+		Nonce:        payload.Nonce,
+		BackUrl:      payload.BackUrl,
+	}, nil
+}
+
+func hashBinding(binding string) string {
+	sum := sha256.Sum256([]byte(binding))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+// Package transaction keeps login transactions between the login and the callback.
+package transaction
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+)
+
+// ErrNotFound is returned when the transaction is missing, expired, already completed
+// or started by another browser.
+var ErrNotFound = errors.Error("login transaction is not found or expired")
+
+// ErrStateMismatch is returned when the state returned by identity provider doesn't match the transaction.
+var ErrStateMismatch = errors.Error("state doesn't match")
+
+// Store keeps login transactions. The transaction is bound to the browser by a cookie
+// holding the binding returned by Begin.
+type Store interface {
+	// Begin saves the transaction and returns the state parameter for the authorization
+	// request and the binding to set to the browser cookie.
+	Begin(ctx context.Context, tx session.LoginTransaction) (state string, binding string, err error)
+	// Complete returns the transaction by the state and the binding presented by the browser.
+	Complete(ctx context.Context, state string, binding string) (session.LoginTransaction, error)
+}
+
+// SessionStore keeps transactions in temporary sessions, the binding is the temporary session id.
+// Transactions are single use.
+type SessionStore struct {
+	sm session.Manager
+}
+
+func NewSessionStore(sm session.Manager) *SessionStore {
+	return &SessionStore{
+		sm: sm,
+	}
+}
+
+func (s *SessionStore) Begin(ctx context.Context, tx session.LoginTransaction) (string, string, error) {
+	sess, err := s.sm.CreateTemp(ctx, session.NewLoginData(tx))
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to create temp session")
+	}
+	return tx.State, sess.Id, nil
+}
+
+func (s *SessionStore) Complete(ctx context.Context, state string, binding string) (session.LoginTransaction, error) {
+	sess, err := session.TakeTemp(ctx, s.sm, binding)
+	if err != nil {
+		return session.LoginTransaction{}, errors.WithField(ErrNotFound, "reason", err.Error())
+	}
+	tx, ok := session.GetLoginTransaction(sess.Data)
+	if !ok {
+		return session.LoginTransaction{}, errors.WithField(ErrNotFound, "reason", "temporary session has no login transaction")
+	}
+	// state is empty for clients not supporting it
+	if tx.State != "" && tx.State != state {
+		return session.LoginTransaction{}, ErrStateMismatch
+	}
+	return tx, nil
+}
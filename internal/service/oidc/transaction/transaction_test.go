@@ -0,0 +1,81 @@
+package transaction
+
+import (
+	"bytes"
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/inmemory"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionStore(t *testing.T) {
+	store := NewSessionStore(inmemory.NewManager())
+	tx := session.LoginTransaction{ProviderName: "myoidc", State: "STATE", CodeVerifier: "VERIFIER", BackUrl: "/"}
+
+	state, binding, err := store.Begin(context.TODO(), tx)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	assert.Equal(t, "STATE", state, "state is not passed to the provider")
+
+	_, err = store.Complete(context.TODO(), "OTHER", binding)
+	assert.True(t, errors.HasCause(err, ErrStateMismatch), "state is not checked")
+
+	state, binding, _ = store.Begin(context.TODO(), tx)
+	res, err := store.Complete(context.TODO(), state, binding)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, tx, res, "invalid transaction")
+	}
+	_, err = store.Complete(context.TODO(), state, binding)
+	assert.True(t, errors.HasCause(err, ErrNotFound), "transaction is completed twice")
+}
+
+func TestSealedStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys, err := keyring.New("k1", keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	store := NewSealedStore(keys, time.Minute, session.WithClock(func() time.Time { return now }))
+	tx := session.LoginTransaction{ProviderName: "myoidc", CodeVerifier: "VERIFIER", Nonce: "NONCE", BackUrl: "/"}
+
+	state, binding, err := store.Begin(context.TODO(), tx)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	assert.NotContains(t, state, "VERIFIER", "code verifier is not encrypted")
+	assert.NotContains(t, state, binding, "binding is sent to the provider")
+
+	tests := []struct {
+		name     string
+		state    string
+		binding  string
+		after    time.Duration
+		expected error
+	}{
+		{name: "valid", state: state, binding: binding},
+		{name: "another browser", state: state, binding: "other", expected: ErrNotFound},
+		{name: "no cookie", state: state, binding: "", expected: ErrNotFound},
+		{name: "tampered", state: state[:len(state)-2] + "AA", binding: binding, expected: ErrStateMismatch},
+		{name: "expired", state: state, binding: binding, after: time.Minute, expected: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.now = func() time.Time { return now.Add(tt.after) }
+			res, err := store.Complete(context.TODO(), tt.state, tt.binding)
+			if tt.expected != nil {
+				assert.True(t, errors.HasCause(err, tt.expected), "unexpected error %v", err)
+				return
+			}
+			if assert.NoError(t, err, "unexpected error") {
+				tx.State = state
+				assert.Equal(t, tx, res, "invalid transaction")
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package session
+
+import (
+	"encoding/json"
+	"myoidc/pkg/errors"
+	"time"
+)
+
+// recordVersion is a layout version of session record.
+const recordVersion = 1
+
+const (
+	// dataVersion is a layout version of session data, encoded data without
+	// the version is a legacy flat layout of version 1.
+	dataVersion    = 2
+	dataVersionKey = "$v"
+)
+
+// dataTypes decode typed values of session data by key, other values are decoded as plain JSON.
+var dataTypes = map[string]func(raw json.RawMessage) (interface{}, error){
+	loginKey: decodeTyped[LoginTransaction],
+	authKey:  decodeTyped[Auth],
+}
+
+// record is a serialized form of Session used by persistent Manager implementations.
+type record struct {
+	Version      int             `json:"v"`
+	Id           string          `json:"id"`
+	UserId       string          `json:"userId,omitempty"`
+	Temp         bool            `json:"temp,omitempty"`
+	Data         json.RawMessage `json:"data,omitempty"`
+	SessVersion  int64           `json:"version,omitempty"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	LastAccessAt time.Time       `json:"lastAccessAt"`
+	ExpiresAt    time.Time       `json:"expiresAt,omitempty"`
+}
+
+// Marshal encodes session to a versioned JSON document.
+func Marshal(sess *Session) ([]byte, error) {
+	data, err := MarshalData(sess.Data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(record{
+		Version:      recordVersion,
+		Id:           sess.Id,
+		UserId:       sess.UserId,
+		Temp:         sess.Temp,
+		Data:         data,
+		SessVersion:  sess.Version,
+		CreatedAt:    sess.CreatedAt,
+		LastAccessAt: sess.LastAccessAt,
+		ExpiresAt:    sess.ExpiresAt,
+	})
+}
+
+// Unmarshal decodes session encoded by Marshal.
+func Unmarshal(b []byte) (*Session, error) {
+	var rec record
+	err := json.Unmarshal(b, &rec)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed session record")
+	}
+	if rec.Version < 1 || rec.Version > recordVersion {
+		return nil, errors.Errorf("unsupported session record version %d", rec.Version)
+	}
+
+	var data map[string]interface{}
+	if len(rec.Data) > 0 {
+		data, err = UnmarshalData(rec.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sess := NewSession(rec.Id, rec.UserId, data)
+	sess.Temp = rec.Temp
+	sess.Version = rec.SessVersion
+	sess.CreatedAt = rec.CreatedAt
+	sess.LastAccessAt = rec.LastAccessAt
+	sess.ExpiresAt = rec.ExpiresAt
+	return sess, nil
+}
+
+// MarshalData encodes session data with its layout version, typed values are encoded as JSON objects.
+func MarshalData(data map[string]interface{}) ([]byte, error) {
+	encoded := make(map[string]interface{}, len(data)+1)
+	for key, value := range data {
+		encoded[key] = value
+	}
+	encoded[dataVersionKey] = dataVersion
+	return json.Marshal(encoded)
+}
+
+// UnmarshalData decodes session data encoded by MarshalData, typed values are restored
+// and data of older layout versions is upgraded to the current one.
+func UnmarshalData(b []byte) (map[string]interface{}, error) {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed session data")
+	}
+
+	version := 1
+	if v, ok := raw[dataVersionKey]; ok {
+		err = json.Unmarshal(v, &version)
+		if err != nil {
+			return nil, errors.Wrap(err, "malformed session data version")
+		}
+		delete(raw, dataVersionKey)
+	}
+	if version < 1 || version > dataVersion {
+		return nil, errors.Errorf("unsupported session data version %d", version)
+	}
+
+	data := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		decode := decodeAny
+		if typed, ok := dataTypes[key]; ok && version > 1 {
+			decode = typed
+		}
+		data[key], err = decode(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed session data value %s", key)
+		}
+	}
+	if version == 1 {
+		upgradeFlatData(data)
+	}
+	return data, nil
+}
+
+func decodeAny(raw json.RawMessage) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+func decodeTyped[T any](raw json.RawMessage) (interface{}, error) {
+	var v T
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// upgradeFlatData moves values of the legacy flat layout into typed values.
+func upgradeFlatData(data map[string]interface{}) {
+	take := func(key string) string {
+		v := GetString(data, key, "")
+		delete(data, key)
+		return v
+	}
+
+	if _, ok := data["providerName"]; ok {
+		data[authKey] = Auth{
+			ProviderName: take("providerName"),
+			AccessToken:  take("accessToken"),
+			RefreshToken: take("refreshToken"),
+			IDToken:      take("idToken"),
+			ProviderSid:  take("providerSid"),
+			Client: ClientInfo{
+				IP:        take("clientIp"),
+				UserAgent: take("userAgent"),
+			},
+		}
+	}
+	for _, key := range []string{"oidcState", "oidcCodeVerifier", "backUrl"} {
+		if _, ok := data[key]; ok {
+			data[loginKey] = LoginTransaction{
+				State:        take("oidcState"),
+				CodeVerifier: take("oidcCodeVerifier"),
+				BackUrl:      take("backUrl"),
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshal(t *testing.T) {
+	sess := NewSession("id", "123", NewAuthData(Auth{
+		ProviderName: "myoidc",
+		AccessToken:  "ACCESS_TOKEN",
+		RefreshToken: "REFRESH_TOKEN",
+		ProviderSid:  "sid",
+		Client:       ClientInfo{IP: "127.0.0.1"},
+	}))
+	sess.Data["custom"] = "value"
+	sess.Version = 3
+	sess.CreatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sess.LastAccessAt = sess.CreatedAt
+
+	b, err := Marshal(sess)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	res, err := Unmarshal(b)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, sess, res, "session is changed by round trip")
+	}
+}
+
+func TestUnmarshal_Temp(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   string
+		expected bool
+	}{
+		{name: "temp", record: `{"v":1,"id":"id","temp":true}`, expected: true},
+		{name: "user session", record: `{"v":1,"id":"id","userId":"123"}`, expected: false},
+		{name: "user session without user", record: `{"v":1,"id":"id"}`, expected: false},
+	}
+	for _, tt := range tests {
+		sess, err := Unmarshal([]byte(tt.record))
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expected, sess.IsTemp(), tt.name)
+		}
+	}
+}
+
+func TestUnmarshalData(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		expected      map[string]interface{}
+		expectedError bool
+	}{
+		{
+			name: "current version",
+			data: `{"$v":2,"login":{"state":"STATE","backUrl":"/"},"custom":1}`,
+			expected: map[string]interface{}{
+				"login":  LoginTransaction{State: "STATE", BackUrl: "/"},
+				"custom": float64(1),
+			},
+		},
+		{
+			name: "legacy auth data",
+			data: `{"providerName":"myoidc","accessToken":"ACCESS_TOKEN","refreshToken":"REFRESH_TOKEN","clientIp":"127.0.0.1","providerSid":"sid"}`,
+			expected: NewAuthData(Auth{
+				ProviderName: "myoidc",
+				AccessToken:  "ACCESS_TOKEN",
+				RefreshToken: "REFRESH_TOKEN",
+				ProviderSid:  "sid",
+				Client:       ClientInfo{IP: "127.0.0.1"},
+			}),
+		},
+		{
+			name: "legacy login data",
+			data: `{"oidcState":"STATE","oidcCodeVerifier":"VERIFIER","backUrl":"/"}`,
+			expected: NewLoginData(LoginTransaction{
+				State:        "STATE",
+				CodeVerifier: "VERIFIER",
+				BackUrl:      "/",
+			}),
+		},
+		{
+			name:          "future version",
+			data:          `{"$v":3}`,
+			expectedError: true,
+		},
+		{
+			name:          "malformed typed value",
+			data:          `{"$v":2,"auth":"token"}`,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := UnmarshalData([]byte(tt.data))
+			if tt.expectedError {
+				assert.Error(t, err, "error is expected")
+				return
+			}
+			if assert.NoError(t, err, "unexpected error") {
+				assert.Equal(t, tt.expected, res, "invalid data")
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"myoidc/internal/domain"
+	"time"
+)
+
+const (
+	// loginKey holds LoginTransaction of a temporary session.
+	loginKey = "login"
+	// authKey holds Auth of a user session.
+	authKey = "auth"
+)
+
+// LoginTransaction is a state of the login kept in a temporary session until the callback.
+type LoginTransaction struct {
+	ProviderName string `json:"provider,omitempty"`
+	State        string `json:"state,omitempty"`
+	CodeVerifier string `json:"codeVerifier,omitempty"`
+	// Nonce is sent in the authorization request and must be returned in the id token.
+	Nonce   string `json:"nonce,omitempty"`
+	BackUrl string `json:"backUrl,omitempty"`
+}
+
+// NewLoginData returns temporary session data holding the login transaction.
+func NewLoginData(tx LoginTransaction) map[string]interface{} {
+	return map[string]interface{}{loginKey: tx}
+}
+
+// GetLoginTransaction returns the login transaction stored by NewLoginData.
+func GetLoginTransaction(data map[string]interface{}) (LoginTransaction, bool) {
+	tx, ok := data[loginKey].(LoginTransaction)
+	return tx, ok
+}
+
+// ClientInfo describes the client the session was created from.
+type ClientInfo struct {
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// Auth is an authentication result kept in a user session.
+type Auth struct {
+	ProviderName string `json:"provider"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	IDToken      string `json:"idToken,omitempty"`
+	// ProviderSid is identity provider session id used by provider initiated logout.
+	ProviderSid string     `json:"providerSid,omitempty"`
+	Client      ClientInfo `json:"client"`
+	// Expiry of the access token, zero if provider didn't tell it.
+	Expiry time.Time `json:"expiry"`
+	// User fetched from the provider at UserCheckedAt, reused until it is checked again.
+	User          *domain.User `json:"user,omitempty"`
+	UserCheckedAt time.Time    `json:"userCheckedAt"`
+}
+
+func (a Auth) IsValid() bool {
+	return a.ProviderName != "" && a.AccessToken != ""
+}
+
+// IsExpired reports whether the access token expires within leeway, tokens without expiry never expire.
+func (a Auth) IsExpired(now time.Time, leeway time.Duration) bool {
+	return !a.Expiry.IsZero() && !now.Add(leeway).Before(a.Expiry)
+}
+
+// NewAuthData returns user session data holding the auth.
+func NewAuthData(auth Auth) map[string]interface{} {
+	return map[string]interface{}{authKey: auth}
+}
+
+// GetAuth returns the auth stored by NewAuthData or SetAuth.
+func GetAuth(data map[string]interface{}) (Auth, bool) {
+	auth, ok := data[authKey].(Auth)
+	return auth, ok
+}
+
+// SetAuth replaces the auth of session data.
+func SetAuth(data map[string]interface{}, auth Auth) {
+	data[authKey] = auth
+}
@@ -0,0 +1,104 @@
+// Package encrypted keeps provider tokens encrypted at rest in any session.Manager.
+package encrypted
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+)
+
+// purpose separates tokens sealed in session stores from other sealed data.
+const purpose = "session"
+
+// Manager wraps session.Manager, tokens are encrypted before they reach the wrapped store
+// and decrypted on read. Tokens are bound to the user id, as the session id is unknown
+// before the session is created. Callers always see plaintext tokens.
+type Manager struct {
+	session.Manager
+	sealer *session.TokenSealer
+}
+
+// NewManager wraps mgr, tokens are sealed with the active key and opened with any key of the ring.
+func NewManager(mgr session.Manager, keys *keyring.KeyRing) *Manager {
+	return &Manager{
+		Manager: mgr,
+		sealer:  session.NewTokenSealer(keys, purpose),
+	}
+}
+
+func (mgr *Manager) Create(ctx context.Context, userId string, data map[string]interface{}) (*session.Session, error) {
+	sealed := copyData(data)
+	err := mgr.sealer.Seal(sealed, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to seal session tokens")
+	}
+	sess, err := mgr.Manager.Create(ctx, userId, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.open(sess)
+}
+
+func (mgr *Manager) Get(ctx context.Context, sessId string) (*session.Session, error) {
+	sess, err := mgr.Manager.Get(ctx, sessId)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.open(sess)
+}
+
+// Update reseals tokens, so tokens sealed by a retired key are moved to the active one.
+func (mgr *Manager) Update(ctx context.Context, sess *session.Session) (*session.Session, error) {
+	sealed := sess.Clone()
+	err := mgr.sealer.Seal(sealed.Data, sealed.UserId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to seal session tokens")
+	}
+	updated, err := mgr.Manager.Update(ctx, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.open(updated)
+}
+
+func (mgr *Manager) ListByUser(ctx context.Context, userId string) ([]*session.Session, error) {
+	list, err := mgr.Manager.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	for i, sess := range list {
+		list[i], err = mgr.open(sess)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// TakeTemp keeps atomic take of the wrapped manager.
+func (mgr *Manager) TakeTemp(ctx context.Context, sessId string) (*session.Session, error) {
+	sess, err := session.TakeTemp(ctx, mgr.Manager, sessId)
+	if err != nil {
+		return nil, err
+	}
+	return mgr.open(sess)
+}
+
+func (mgr *Manager) open(sess *session.Session) (*session.Session, error) {
+	err := mgr.sealer.Open(sess.Data, sess.UserId)
+	if err != nil {
+		err = errors.Wrap(err, "failed to open session tokens")
+		return nil, errors.WithField(err, "sessId", sess.Id)
+	}
+	return sess, nil
+}
+
+// copyData returns a shallow copy, sealing replaces auth value and doesn't change the caller data.
+func copyData(data map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		c[key] = value
+	}
+	return c
+}
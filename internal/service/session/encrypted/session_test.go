@@ -0,0 +1,105 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/inmemory"
+	"myoidc/internal/service/session/sessiontest"
+	"myoidc/pkg/keyring"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newKeyRing(t *testing.T, active string) *keyring.KeyRing {
+	kr, err := keyring.New(active,
+		keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)},
+		keyring.Key{Id: "k2", Secret: bytes.Repeat([]byte{2}, 32)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestManager_Behaviour(t *testing.T) {
+	sessiontest.Run(t, func(t *testing.T, now func() time.Time, lifetime session.Lifetime) session.Manager {
+		return NewManager(inmemory.NewManager(session.WithClock(now), session.WithLifetime(lifetime)), newKeyRing(t, "k1"))
+	})
+}
+
+func TestManager_Tokens(t *testing.T) {
+	store := inmemory.NewManager()
+	auth := session.Auth{ProviderName: "myoidc", AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"}
+	data := session.NewAuthData(auth)
+
+	old := NewManager(store, newKeyRing(t, "k1"))
+	sess, err := old.Create(context.TODO(), "123", data)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	res, _ := session.GetAuth(sess.Data)
+	assert.Equal(t, auth, res, "created session has sealed tokens")
+	res, _ = session.GetAuth(data)
+	assert.Equal(t, auth, res, "caller data is changed")
+
+	stored, err := store.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		res, _ = session.GetAuth(stored.Data)
+		assert.NotContains(t, res.AccessToken, "ACCESS_TOKEN", "access token is stored in plaintext")
+		assert.NotContains(t, res.RefreshToken, "REFRESH_TOKEN", "refresh token is stored in plaintext")
+		assert.Equal(t, "myoidc", res.ProviderName, "provider name is sealed")
+	}
+
+	rotated := NewManager(store, newKeyRing(t, "k2"))
+	got, err := rotated.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "session sealed by retired key") {
+		res, _ = session.GetAuth(got.Data)
+		assert.Equal(t, auth, res, "tokens are not opened")
+	}
+
+	other, _ := keyring.New("k1", keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{3}, 32)})
+	_, err = NewManager(store, other).Get(context.TODO(), sess.Id)
+	assert.Error(t, err, "tokens are opened by foreign key")
+
+	plain, err := store.Create(context.TODO(), "456", session.NewAuthData(auth))
+	assert.NoError(t, err, "unexpected error")
+	got, err = rotated.Get(context.TODO(), plain.Id)
+	if assert.NoError(t, err, "session stored before encryption is not readable") {
+		res, _ = session.GetAuth(got.Data)
+		assert.Equal(t, auth, res, "plaintext tokens are changed")
+	}
+}
+
+func TestManager_Snapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sessions.json")
+	keys := newKeyRing(t, "k1")
+	auth := session.Auth{ProviderName: "myoidc", AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"}
+
+	store := inmemory.NewManager(inmemory.WithSnapshot(file, 0, keys))
+	sess, err := NewManager(store, keys).Create(context.TODO(), "123", session.NewAuthData(auth))
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	assert.NoError(t, store.Close(), "snapshot is not saved")
+
+	b, err := os.ReadFile(file)
+	if assert.NoError(t, err, "snapshot file is missing") {
+		assert.NotContains(t, string(b), "ACCESS_TOKEN", "access token is not encrypted")
+		assert.NotContains(t, string(b), "$sealed:", "session record is not sealed")
+	}
+
+	restored := inmemory.NewManager(inmemory.WithSnapshot(file, 0, keys))
+	count, err := restored.RestoreSnapshot()
+	assert.NoError(t, err, "snapshot of sealed tokens is not restored")
+	assert.Equal(t, 1, count)
+	got, err := NewManager(restored, keys).Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "session is not restored") {
+		res, _ := session.GetAuth(got.Data)
+		assert.Equal(t, auth, res, "tokens are not opened")
+	}
+}
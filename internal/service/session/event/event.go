@@ -0,0 +1,158 @@
+// Package event delivers session lifecycle events to subscribers, e.g. audit, metrics
+// or cache invalidation.
+package event
+
+import (
+	"context"
+	"myoidc/pkg/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Type string
+
+const (
+	// Created, Updated, Destroyed and Expired are emitted by Manager for user sessions.
+	Created   Type = "created"
+	Updated   Type = "updated"
+	Destroyed Type = "destroyed"
+	Expired   Type = "expired"
+	// LoginStarted, LoginCompleted and LoginFailed are emitted by login and callback use cases.
+	LoginStarted   Type = "login_started"
+	LoginCompleted Type = "login_completed"
+	LoginFailed    Type = "login_failed"
+	// Refreshed is emitted by userinfo use case when provider tokens of the session are refreshed.
+	Refreshed Type = "refreshed"
+)
+
+// Event carries session.Ref of the session instead of its id, as the id is a bearer credential.
+// Events emitted without session details, e.g. Destroyed by session id, carry the ref only.
+type Event struct {
+	Type         Type
+	SessRef      string
+	UserId       string
+	ProviderName string
+	// Reason of Destroyed and LoginFailed events, e.g. session.ReasonLogout.
+	Reason string
+	Time   time.Time
+}
+
+// Observer receives events. Synchronous observers are called on the request path
+// and must be fast.
+type Observer interface {
+	OnEvent(ctx context.Context, e Event)
+}
+
+type ObserverFunc func(ctx context.Context, e Event)
+
+func (f ObserverFunc) OnEvent(ctx context.Context, e Event) {
+	f(ctx, e)
+}
+
+// Discard drops all events.
+var Discard Observer = ObserverFunc(func(ctx context.Context, e Event) {})
+
+// Dispatcher fans events out to subscribers, it is an Observer itself.
+type Dispatcher struct {
+	mx    sync.RWMutex
+	sync  []Observer
+	async []*asyncObserver
+	now   func() time.Time
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		now: time.Now,
+	}
+}
+
+// Subscribe calls obs in the goroutine emitting the event.
+func (d *Dispatcher) Subscribe(obs Observer) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.sync = append(d.sync, obs)
+}
+
+// SubscribeAsync calls obs in a separate goroutine. Events are queued up to buffer,
+// events emitted while the queue is full are dropped, so a slow subscriber never blocks requests.
+func (d *Dispatcher) SubscribeAsync(obs Observer, buffer int) {
+	a := &asyncObserver{
+		obs:    obs,
+		events: make(chan Event, buffer),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.async = append(d.async, a)
+}
+
+func (d *Dispatcher) OnEvent(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = d.now()
+	}
+
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	for _, obs := range d.sync {
+		obs.OnEvent(ctx, e)
+	}
+	for _, a := range d.async {
+		select {
+		case a.events <- e:
+		default:
+			a.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped by full async queues.
+func (d *Dispatcher) Dropped() uint64 {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	var dropped uint64
+	for _, a := range d.async {
+		dropped += a.dropped.Load()
+	}
+	return dropped
+}
+
+// Close delivers queued events and stops async subscribers, events emitted after Close are lost.
+func (d *Dispatcher) Close() error {
+	d.mx.Lock()
+	async := d.async
+	d.async = nil
+	d.mx.Unlock()
+
+	for _, a := range async {
+		close(a.events)
+		<-a.done
+	}
+	return nil
+}
+
+type asyncObserver struct {
+	obs     Observer
+	events  chan Event
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+func (a *asyncObserver) run() {
+	defer close(a.done)
+	for e := range a.events {
+		a.deliver(e)
+	}
+}
+
+// deliver keeps the worker alive when the subscriber panics.
+func (a *asyncObserver) deliver(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.GetDefault().Errorf("session event subscriber panic: %v", r)
+		}
+	}()
+	a.obs.OnEvent(context.Background(), e)
+}
@@ -0,0 +1,105 @@
+package event
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/inmemory"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mx     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) OnEvent(ctx context.Context, e Event) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) types() []Type {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	types := make([]Type, 0, len(r.events))
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestDispatcher(t *testing.T) {
+	d := NewDispatcher()
+	direct, async := &recorder{}, &recorder{}
+	d.Subscribe(direct)
+	d.SubscribeAsync(async, 10)
+
+	d.OnEvent(context.TODO(), Event{Type: LoginStarted})
+	d.OnEvent(context.TODO(), Event{Type: LoginCompleted})
+	assert.Equal(t, []Type{LoginStarted, LoginCompleted}, direct.types(), "sync events are not delivered in order")
+	assert.False(t, direct.events[0].Time.IsZero(), "event time is not set")
+
+	assert.NoError(t, d.Close())
+	assert.Equal(t, []Type{LoginStarted, LoginCompleted}, async.types(), "queued events are not delivered on close")
+}
+
+func TestDispatcher_Dropped(t *testing.T) {
+	d := NewDispatcher()
+	block := make(chan struct{})
+	d.SubscribeAsync(ObserverFunc(func(ctx context.Context, e Event) {
+		<-block
+	}), 1)
+
+	for i := 0; i < 5; i++ {
+		d.OnEvent(context.TODO(), Event{Type: Refreshed})
+	}
+	// one event is taken by the worker, one is queued
+	assert.GreaterOrEqual(t, d.Dropped(), uint64(3), "full queue blocks or keeps events")
+	close(block)
+	assert.NoError(t, d.Close())
+}
+
+func TestManager(t *testing.T) {
+	rec := &recorder{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := inmemory.NewManager(session.WithClock(func() time.Time { return now }))
+	mgr := NewManager(store, rec)
+	data := func() map[string]interface{} {
+		return session.NewAuthData(session.Auth{ProviderName: "myoidc", AccessToken: "ACCESS_TOKEN"})
+	}
+
+	_, _ = mgr.CreateTemp(context.TODO(), nil)
+	sess, err := mgr.Create(context.TODO(), "123", data())
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	_, err = session.Modify(context.TODO(), mgr, sess.Id, func(sess *session.Session) error {
+		sess.Data["key"] = "value"
+		return nil
+	})
+	assert.NoError(t, err, "unexpected error")
+	err = mgr.Destroy(session.WithDestroyReason(context.TODO(), session.ReasonLogout), sess.Id)
+	assert.NoError(t, err, "unexpected error")
+	_, _ = mgr.Create(context.TODO(), "123", data())
+	_, _ = mgr.Create(context.TODO(), "123", data())
+	count, err := mgr.DestroyByUser(context.TODO(), "123")
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 2, count, "invalid destroyed count")
+
+	expired, _ := mgr.Create(context.TODO(), "456", data())
+	now = now.Add(session.DefaultIdleTimeout)
+	_, err = mgr.Get(context.TODO(), expired.Id)
+	assert.Error(t, err, "session is not expired")
+
+	assert.Equal(t, []Type{Created, Updated, Destroyed, Created, Created, Destroyed, Destroyed, Created, Expired}, rec.types(), "invalid events")
+	assert.Equal(t, Event{Type: Created, SessRef: session.Ref(sess.Id), UserId: "123", ProviderName: "myoidc"}, rec.events[0])
+	assert.Equal(t, Event{Type: Destroyed, SessRef: session.Ref(sess.Id), Reason: session.ReasonLogout}, rec.events[2])
+	assert.Equal(t, Event{Type: Expired, SessRef: session.Ref(expired.Id)}, rec.events[8])
+	for _, e := range rec.events {
+		assert.NotContains(t, e.SessRef, sess.Id, "session id is disclosed")
+	}
+}
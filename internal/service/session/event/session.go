@@ -0,0 +1,110 @@
+package event
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+)
+
+// Manager wraps session.Manager and emits events of user sessions, temporary sessions
+// are reported by login events. Sessions are reported Expired when they are found expired
+// on access, ones evicted by a janitor or by the store TTL without access are not reported.
+type Manager struct {
+	session.Manager
+	obs Observer
+}
+
+func NewManager(mgr session.Manager, obs Observer) *Manager {
+	return &Manager{
+		Manager: mgr,
+		obs:     obs,
+	}
+}
+
+func (mgr *Manager) Create(ctx context.Context, userId string, data map[string]interface{}) (*session.Session, error) {
+	sess, err := mgr.Manager.Create(ctx, userId, data)
+	if err == nil {
+		mgr.obs.OnEvent(ctx, newEvent(Created, sess, ""))
+	}
+	return sess, err
+}
+
+func (mgr *Manager) Get(ctx context.Context, sessId string) (*session.Session, error) {
+	sess, err := mgr.Manager.Get(ctx, sessId)
+	mgr.reportExpired(ctx, sessId, err)
+	return sess, err
+}
+
+func (mgr *Manager) Update(ctx context.Context, sess *session.Session) (*session.Session, error) {
+	updated, err := mgr.Manager.Update(ctx, sess)
+	if err == nil && !updated.IsTemp() {
+		mgr.obs.OnEvent(ctx, newEvent(Updated, updated, ""))
+	}
+	mgr.reportExpired(ctx, sess.Id, err)
+	return updated, err
+}
+
+// Destroy reports the session by its ref only, as reading the session first would touch it
+// and cost a store round trip. The reason is taken from session.DestroyReason.
+func (mgr *Manager) Destroy(ctx context.Context, sessId string) error {
+	err := mgr.Manager.Destroy(ctx, sessId)
+	if err == nil {
+		mgr.obs.OnEvent(ctx, Event{
+			Type:    Destroyed,
+			SessRef: session.Ref(sessId),
+			Reason:  session.DestroyReason(ctx),
+		})
+	}
+	return err
+}
+
+// DestroyByUser reports every destroyed session listed before destruction.
+func (mgr *Manager) DestroyByUser(ctx context.Context, userId string) (int, error) {
+	list, listErr := mgr.Manager.ListByUser(ctx, userId)
+	count, err := mgr.Manager.DestroyByUser(ctx, userId)
+	if err == nil && listErr == nil {
+		for _, sess := range list {
+			mgr.obs.OnEvent(ctx, newEvent(Destroyed, sess, session.DestroyReason(ctx)))
+		}
+	}
+	return count, err
+}
+
+// DestroyByProviderSession reports a single event without session id, as destroyed sessions
+// can't be listed by provider session.
+func (mgr *Manager) DestroyByProviderSession(ctx context.Context, providerName string, providerSid string) (int, error) {
+	count, err := mgr.Manager.DestroyByProviderSession(ctx, providerName, providerSid)
+	if err == nil && count > 0 {
+		mgr.obs.OnEvent(ctx, Event{
+			Type:         Destroyed,
+			ProviderName: providerName,
+			Reason:       session.DestroyReason(ctx),
+		})
+	}
+	return count, err
+}
+
+// TakeTemp keeps atomic take of the wrapped manager.
+func (mgr *Manager) TakeTemp(ctx context.Context, sessId string) (*session.Session, error) {
+	return session.TakeTemp(ctx, mgr.Manager, sessId)
+}
+
+func (mgr *Manager) reportExpired(ctx context.Context, sessId string, err error) {
+	if errors.HasCause(err, session.ErrExpired) {
+		mgr.obs.OnEvent(ctx, Event{
+			Type:    Expired,
+			SessRef: session.Ref(sessId),
+		})
+	}
+}
+
+func newEvent(t Type, sess *session.Session, reason string) Event {
+	auth, _ := session.GetAuth(sess.Data)
+	return Event{
+		Type:         t,
+		SessRef:      session.Ref(sess.Id),
+		UserId:       sess.UserId,
+		ProviderName: auth.ProviderName,
+		Reason:       reason,
+	}
+}
@@ -0,0 +1,20 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"myoidc/pkg/errors"
+)
+
+// idBytes is an entropy of session ids, 256 bits.
+const idBytes = 32
+
+// NewId generates an unpredictable session id from CSPRNG, encoded as unpadded base64url.
+func NewId() (string, error) {
+	b := make([]byte, idBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate session id")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
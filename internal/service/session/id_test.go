@@ -0,0 +1,23 @@
+package session
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewId(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := NewId()
+		if !assert.NoError(t, err) {
+			return
+		}
+		b, err := base64.RawURLEncoding.DecodeString(id)
+		assert.NoError(t, err, "id is not base64url")
+		assert.Len(t, b, 32, "id entropy is less than 256 bits")
+		assert.False(t, seen[id], "duplicate id")
+		seen[id] = true
+	}
+}
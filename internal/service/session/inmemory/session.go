@@ -2,67 +2,267 @@ package inmemory
 
 import (
 	"context"
-	"github.com/google/uuid"
 	"myoidc/internal/service/session"
 	"myoidc/pkg/errors"
 	"sync"
+	"time"
 )
 
 // Manager simple in-memory implementation of session.Manager interface.
 type Manager struct {
 	store map[string]*session.Session
-	mx    sync.RWMutex
+	// secondary indexes of session ids by user and by provider session
+	byUser        map[string]map[string]struct{}
+	byProviderSid map[string]map[string]struct{}
+	mx            sync.RWMutex
+
+	lifetime session.Lifetime
+	now      func() time.Time
+	snapshot *snapshotConfig
+	janitor  *session.Janitor
 }
 
-func NewManager() *Manager {
-	return &Manager{
-		store: make(map[string]*session.Session),
-		mx:    sync.RWMutex{},
+// NewManager creates manager, session.WithCleanupInterval and WithSnapshot start background
+// janitor, use Manager.Close to stop it.
+func NewManager(opts ...session.Option) *Manager {
+	mgr := &Manager{
+		store:         make(map[string]*session.Session),
+		byUser:        make(map[string]map[string]struct{}),
+		byProviderSid: make(map[string]map[string]struct{}),
+		mx:            sync.RWMutex{},
+	}
+	o := session.ApplyOptions(mgr, opts)
+	mgr.lifetime, mgr.now = o.Lifetime, o.Now
+
+	cleanup := session.Task{Interval: o.CleanupInterval, Run: func() { mgr.Cleanup() }}
+	snapshot := session.Task{Run: func() {
+		// failed snapshot is retried on the next tick and on Close
+		if err := mgr.SaveSnapshot(); err != nil {
+			o.Logger.WithError(err).Error("failed to save session snapshot")
+		}
+	}}
+	if mgr.snapshot != nil {
+		snapshot.Interval = mgr.snapshot.interval
 	}
+	mgr.janitor = session.StartJanitor(cleanup, snapshot)
+	return mgr
 }
 
 func (mgr *Manager) Create(ctx context.Context, userId string, data map[string]interface{}) (*session.Session, error) {
-	return mgr.create(userId, data)
+	return mgr.create(userId, false, data)
 }
 
 func (mgr *Manager) CreateTemp(ctx context.Context, data map[string]interface{}) (*session.Session, error) {
-	return mgr.create("", data)
+	return mgr.create("", true, data)
 }
 
-func (mgr *Manager) create(userId string, data map[string]interface{}) (*session.Session, error) {
-	sessUuid, err := uuid.NewUUID()
+func (mgr *Manager) create(userId string, temp bool, data map[string]interface{}) (*session.Session, error) {
+	sessId, err := session.NewId()
 	if err != nil {
-		err = errors.Wrap(err, "failed to generate session id")
 		return nil, err
 	}
 
-	sessId := sessUuid.String()
 	sess := session.NewSession(sessId, userId, data)
+	sess.Temp = temp
+	mgr.lifetime.Start(sess, mgr.now())
 
 	mgr.mx.Lock()
-	mgr.store[sessId] = sess
+	mgr.put(sess.Clone())
 	mgr.mx.Unlock()
 
 	return sess, nil
 }
 
 func (mgr *Manager) Get(ctx context.Context, sessId string) (*session.Session, error) {
-	mgr.mx.RLock()
-	sess := mgr.store[sessId]
-	mgr.mx.RUnlock()
+	now := mgr.now()
 
+	mgr.mx.Lock()
+	defer mgr.mx.Unlock()
+
+	sess := mgr.store[sessId]
 	if sess == nil {
 		err := errors.Errorf("session not found by id %s", sessId)
 		return nil, err
 	}
+	if mgr.lifetime.Expired(sess, now) {
+		mgr.remove(sess)
+		err := errors.Wrapf(session.ErrExpired, "session %s", sessId)
+		return nil, err
+	}
+	mgr.lifetime.Touch(sess, now)
+
+	return sess.Clone(), nil
+}
+
+func (mgr *Manager) Update(ctx context.Context, sess *session.Session) (*session.Session, error) {
+	now := mgr.now()
+
+	mgr.mx.Lock()
+	defer mgr.mx.Unlock()
+
+	stored := mgr.store[sess.Id]
+	if stored == nil {
+		err := errors.Errorf("session not found by id %s", sess.Id)
+		return nil, err
+	}
+	if mgr.lifetime.Expired(stored, now) {
+		mgr.remove(stored)
+		return nil, errors.Wrapf(session.ErrExpired, "session %s", sess.Id)
+	}
+	if stored.Version != sess.Version {
+		return nil, session.ErrVersionConflict
+	}
+
+	updated := stored.Clone()
+	updated.Data = sess.Clone().Data
+	updated.Version++
+	mgr.lifetime.Touch(updated, now)
+	mgr.remove(stored)
+	mgr.put(updated)
+
+	return updated.Clone(), nil
+}
+
+func (mgr *Manager) TakeTemp(ctx context.Context, sessId string) (*session.Session, error) {
+	now := mgr.now()
+
+	mgr.mx.Lock()
+	defer mgr.mx.Unlock()
+
+	sess := mgr.store[sessId]
+	if sess == nil || !sess.IsTemp() {
+		err := errors.Errorf("temporary session not found by id %s", sessId)
+		return nil, err
+	}
+	mgr.remove(sess)
+	if mgr.lifetime.Expired(sess, now) {
+		err := errors.Wrapf(session.ErrExpired, "session %s", sessId)
+		return nil, err
+	}
 
 	return sess, nil
 }
 
 func (mgr *Manager) Destroy(ctx context.Context, sessId string) error {
 	mgr.mx.Lock()
-	delete(mgr.store, sessId)
+	if sess := mgr.store[sessId]; sess != nil {
+		mgr.remove(sess)
+	}
 	mgr.mx.Unlock()
 
 	return nil
 }
+
+func (mgr *Manager) ListByUser(ctx context.Context, userId string) ([]*session.Session, error) {
+	now := mgr.now()
+
+	mgr.mx.RLock()
+	defer mgr.mx.RUnlock()
+
+	list := make([]*session.Session, 0, len(mgr.byUser[userId]))
+	for sessId := range mgr.byUser[userId] {
+		sess := mgr.store[sessId]
+		if !mgr.lifetime.Expired(sess, now) {
+			list = append(list, sess.Clone())
+		}
+	}
+	session.SortByCreatedAt(list)
+	return list, nil
+}
+
+func (mgr *Manager) DestroyByUser(ctx context.Context, userId string) (int, error) {
+	mgr.mx.Lock()
+	defer mgr.mx.Unlock()
+
+	return mgr.removeAll(mgr.byUser[userId]), nil
+}
+
+func (mgr *Manager) DestroyByProviderSession(ctx context.Context, providerName string, providerSid string) (int, error) {
+	mgr.mx.Lock()
+	defer mgr.mx.Unlock()
+
+	return mgr.removeAll(mgr.byProviderSid[providerSidKey(providerName, providerSid)]), nil
+}
+
+// Cleanup evicts expired sessions and returns their count.
+func (mgr *Manager) Cleanup() int {
+	now := mgr.now()
+
+	mgr.mx.Lock()
+	defer mgr.mx.Unlock()
+
+	count := 0
+	for _, sess := range mgr.store {
+		if mgr.lifetime.Expired(sess, now) {
+			mgr.remove(sess)
+			count++
+		}
+	}
+	return count
+}
+
+// Close stops background janitor and waits for it to exit, the snapshot is saved if enabled.
+func (mgr *Manager) Close() error {
+	mgr.janitor.Close()
+	if mgr.snapshot != nil {
+		return mgr.SaveSnapshot()
+	}
+	return nil
+}
+
+// put stores the session and indexes it, must be called under write lock.
+func (mgr *Manager) put(sess *session.Session) {
+	mgr.store[sess.Id] = sess
+	if sess.IsTemp() {
+		return
+	}
+	addIndex(mgr.byUser, sess.UserId, sess.Id)
+	if auth, _ := session.GetAuth(sess.Data); auth.ProviderSid != "" {
+		addIndex(mgr.byProviderSid, providerSidKey(auth.ProviderName, auth.ProviderSid), sess.Id)
+	}
+}
+
+// remove deletes the session with its index entries, must be called under write lock.
+func (mgr *Manager) remove(sess *session.Session) {
+	delete(mgr.store, sess.Id)
+	if sess.IsTemp() {
+		return
+	}
+	removeIndex(mgr.byUser, sess.UserId, sess.Id)
+	if auth, _ := session.GetAuth(sess.Data); auth.ProviderSid != "" {
+		removeIndex(mgr.byProviderSid, providerSidKey(auth.ProviderName, auth.ProviderSid), sess.Id)
+	}
+}
+
+// removeAll removes indexed sessions, must be called under write lock.
+func (mgr *Manager) removeAll(ids map[string]struct{}) int {
+	list := make([]*session.Session, 0, len(ids))
+	for sessId := range ids {
+		list = append(list, mgr.store[sessId])
+	}
+	for _, sess := range list {
+		mgr.remove(sess)
+	}
+	return len(list)
+}
+
+func addIndex(index map[string]map[string]struct{}, key string, sessId string) {
+	ids := index[key]
+	if ids == nil {
+		ids = make(map[string]struct{})
+		index[key] = ids
+	}
+	ids[sessId] = struct{}{}
+}
+
+func removeIndex(index map[string]map[string]struct{}, key string, sessId string) {
+	ids := index[key]
+	delete(ids, sessId)
+	if len(ids) == 0 {
+		delete(index, key)
+	}
+}
+
+func providerSidKey(providerName string, providerSid string) string {
+	return providerName + "\x00" + providerSid
+}
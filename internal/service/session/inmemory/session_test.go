@@ -1,9 +1,16 @@
 package inmemory
 
 import (
+	"bytes"
 	"context"
 	"github.com/stretchr/testify/assert"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/sessiontest"
+	"myoidc/pkg/keyring"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestManager_Create(t *testing.T) {
@@ -45,7 +52,8 @@ func TestManager_CreateTemp(t *testing.T) {
 }
 
 func TestManager_Get(t *testing.T) {
-	mgr := NewManager()
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mgr := NewManager(session.WithClock(clock.Now))
 
 	sess1, err := mgr.CreateTemp(context.TODO(), map[string]interface{}{
 		"field1": 11,
@@ -75,7 +83,8 @@ func TestManager_Get(t *testing.T) {
 }
 
 func TestManager_Destroy(t *testing.T) {
-	mgr := NewManager()
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mgr := NewManager(session.WithClock(clock.Now))
 
 	sess1, err := mgr.CreateTemp(context.TODO(), map[string]interface{}{
 		"field1": 11,
@@ -122,3 +131,163 @@ func TestManager_Destroy(t *testing.T) {
 	assert.Error(t, err, "error expected")
 	assert.Equal(t, 0, len(mgr.store), "sessions count is invalid")
 }
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestManager_Expiration(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mgr := NewManager(session.WithClock(clock.Now), session.WithLifetime(session.Lifetime{
+		TempTTL:     5 * time.Minute,
+		IdleTimeout: 30 * time.Minute,
+		AbsoluteTTL: time.Hour,
+	}))
+
+	temp, err := mgr.CreateTemp(context.TODO(), nil)
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, clock.now, temp.CreatedAt, "invalid created at")
+	assert.Equal(t, clock.now.Add(5*time.Minute), temp.ExpiresAt, "invalid temp session expiration")
+
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, clock.now.Add(time.Hour), sess.ExpiresAt, "invalid session expiration")
+
+	// temp session is not prolonged by access
+	clock.Add(4 * time.Minute)
+	_, err = mgr.Get(context.TODO(), temp.Id)
+	assert.NoError(t, err, "temp session expired too early")
+	clock.Add(time.Minute)
+	_, err = mgr.Get(context.TODO(), temp.Id)
+	assert.Error(t, err, "temp session is not expired")
+	assert.Equal(t, 1, len(mgr.store), "expired temp session is not removed")
+
+	// sliding idle timeout
+	clock.Add(20 * time.Minute)
+	res, err := mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "session expired too early")
+	assert.Equal(t, clock.now, res.LastAccessAt, "last access is not updated")
+	clock.Add(29 * time.Minute)
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "idle timeout is not prolonged")
+
+	// absolute lifetime
+	clock.Add(6 * time.Minute)
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.Error(t, err, "absolute lifetime is exceeded")
+	assert.Equal(t, 0, len(mgr.store), "expired session is not removed")
+
+	// idle timeout
+	sess, err = mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+	clock.Add(30 * time.Minute)
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.Error(t, err, "idle timeout is exceeded")
+}
+
+func TestManager_Cleanup(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mgr := NewManager(session.WithClock(clock.Now), session.WithLifetime(session.Lifetime{
+		TempTTL:     time.Minute,
+		AbsoluteTTL: time.Hour,
+	}))
+
+	for i := 0; i < 3; i++ {
+		_, err := mgr.CreateTemp(context.TODO(), nil)
+		assert.NoError(t, err, "unexpected error")
+	}
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+
+	assert.Equal(t, 0, mgr.Cleanup(), "nothing is expired yet")
+	clock.Add(time.Minute)
+	assert.Equal(t, 3, mgr.Cleanup(), "temp sessions are not evicted")
+	assert.Equal(t, 1, len(mgr.store), "sessions count is invalid")
+	assert.NotNil(t, mgr.store[sess.Id], "user session is evicted")
+}
+
+func TestManager_Janitor(t *testing.T) {
+	mgr := NewManager(
+		session.WithLifetime(session.Lifetime{TempTTL: time.Millisecond}),
+		session.WithCleanupInterval(5*time.Millisecond),
+	)
+
+	_, err := mgr.CreateTemp(context.TODO(), nil)
+	assert.NoError(t, err, "unexpected error")
+	assert.Eventually(t, func() bool {
+		mgr.mx.RLock()
+		defer mgr.mx.RUnlock()
+		return len(mgr.store) == 0
+	}, time.Second, 5*time.Millisecond, "janitor didn't evict expired session")
+
+	assert.NoError(t, mgr.Close(), "unexpected error")
+	assert.NoError(t, mgr.Close(), "close is not idempotent")
+
+	// manager without janitor is closed immediately
+	assert.NoError(t, NewManager().Close(), "unexpected error")
+}
+
+func TestManager_Behaviour(t *testing.T) {
+	sessiontest.Run(t, func(t *testing.T, now func() time.Time, lifetime session.Lifetime) session.Manager {
+		return NewManager(session.WithClock(now), session.WithLifetime(lifetime))
+	})
+}
+
+func TestManager_Snapshot(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	file := filepath.Join(t.TempDir(), "sessions.json")
+	keys, err := keyring.New("k1", keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	newManager := func() *Manager {
+		return NewManager(session.WithClock(clock.Now), WithSnapshot(file, 0, keys), session.WithLifetime(session.Lifetime{
+			TempTTL:     time.Minute,
+			IdleTimeout: 30 * time.Minute,
+		}))
+	}
+
+	auth := session.Auth{ProviderName: "myoidc", AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"}
+	mgr := newManager()
+	sess, err := mgr.Create(context.TODO(), "123", session.NewAuthData(auth))
+	assert.NoError(t, err, "unexpected error")
+	_, err = mgr.CreateTemp(context.TODO(), nil)
+	assert.NoError(t, err, "unexpected error")
+	assert.NoError(t, mgr.Close(), "snapshot is not saved on close")
+
+	b, err := os.ReadFile(file)
+	if assert.NoError(t, err, "snapshot file is missing") {
+		assert.NotContains(t, string(b), "ACCESS_TOKEN", "access token is not encrypted")
+		assert.NotContains(t, string(b), "REFRESH_TOKEN", "refresh token is not encrypted")
+	}
+
+	// temp session expires while the app is down
+	clock.Add(time.Minute)
+	restored := newManager()
+	count, err := restored.RestoreSnapshot()
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 1, count, "expired session is restored")
+	res, err := restored.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "session is not restored") {
+		restoredAuth, _ := session.GetAuth(res.Data)
+		assert.Equal(t, auth, restoredAuth, "tokens are not decrypted")
+		list, _ := restored.ListByUser(context.TODO(), "123")
+		assert.Len(t, list, 1, "user index is not restored")
+	}
+
+	otherKeys, _ := keyring.New("k2", keyring.Key{Id: "k2", Secret: bytes.Repeat([]byte{2}, 32)})
+	_, err = NewManager(session.WithClock(clock.Now), WithSnapshot(file, 0, otherKeys)).RestoreSnapshot()
+	assert.Error(t, err, "snapshot is decrypted by unknown key")
+
+	count, err = NewManager(WithSnapshot(filepath.Join(t.TempDir(), "missing.json"), 0, keys)).RestoreSnapshot()
+	assert.NoError(t, err, "missing snapshot is an error")
+	assert.Equal(t, 0, count)
+}
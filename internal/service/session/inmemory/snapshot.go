@@ -0,0 +1,173 @@
+package inmemory
+
+import (
+	"encoding/json"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// snapshotAdditionalData separates sealed session records from other data sealed by the same keys.
+var snapshotAdditionalData = []byte("session-snapshot")
+
+type snapshotConfig struct {
+	file     string
+	interval time.Duration
+	keys     *keyring.KeyRing
+}
+
+type snapshot struct {
+	Version int       `json:"v"`
+	SavedAt time.Time `json:"savedAt"`
+	// Sessions are sealed session records.
+	Sessions []json.RawMessage `json:"sessions"`
+}
+
+// WithSnapshot persists sessions to the file every interval (0 disables periodic saving)
+// and on Close. Session records are encrypted with the key ring as opaque values, so tokens
+// sealed by the encrypted manager wrapper are kept as is. Use Manager.RestoreSnapshot to load
+// sessions on startup.
+func WithSnapshot(file string, interval time.Duration, keys *keyring.KeyRing) session.Option {
+	return session.ManagerOption(func(mgr *Manager) {
+		mgr.snapshot = &snapshotConfig{
+			file:     file,
+			interval: interval,
+			keys:     keys,
+		}
+	})
+}
+
+// SaveSnapshot writes active sessions to the snapshot file atomically.
+func (mgr *Manager) SaveSnapshot() error {
+	if mgr.snapshot == nil {
+		return errors.Error("session snapshot is not configured")
+	}
+	now := mgr.now()
+
+	mgr.mx.RLock()
+	list := make([]*session.Session, 0, len(mgr.store))
+	for _, sess := range mgr.store {
+		if !mgr.lifetime.Expired(sess, now) {
+			list = append(list, sess.Clone())
+		}
+	}
+	mgr.mx.RUnlock()
+
+	snap := snapshot{
+		Version:  snapshotVersion,
+		SavedAt:  now,
+		Sessions: make([]json.RawMessage, 0, len(list)),
+	}
+	for _, sess := range list {
+		b, err := mgr.sealSession(sess)
+		if err != nil {
+			return err
+		}
+		snap.Sessions = append(snap.Sessions, b)
+	}
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode session snapshot")
+	}
+	return writeFileAtomic(mgr.snapshot.file, b)
+}
+
+// RestoreSnapshot loads sessions from the snapshot file, expired sessions are skipped.
+// Missing file is not an error. It returns the number of restored sessions.
+func (mgr *Manager) RestoreSnapshot() (int, error) {
+	if mgr.snapshot == nil {
+		return 0, errors.Error("session snapshot is not configured")
+	}
+	b, err := os.ReadFile(mgr.snapshot.file)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrap(err, "failed to read session snapshot")
+	}
+
+	var snap snapshot
+	err = json.Unmarshal(b, &snap)
+	if err != nil {
+		return 0, errors.Wrap(err, "malformed session snapshot")
+	}
+	if snap.Version != snapshotVersion {
+		return 0, errors.Errorf("unsupported session snapshot version %d", snap.Version)
+	}
+
+	now := mgr.now()
+	list := make([]*session.Session, 0, len(snap.Sessions))
+	for _, raw := range snap.Sessions {
+		sess, err := mgr.openSession(raw)
+		if err != nil {
+			return 0, err
+		}
+		if !mgr.lifetime.Expired(sess, now) {
+			list = append(list, sess)
+		}
+	}
+
+	mgr.mx.Lock()
+	defer mgr.mx.Unlock()
+	for _, sess := range list {
+		if old := mgr.store[sess.Id]; old != nil {
+			mgr.remove(old)
+		}
+		mgr.put(sess)
+	}
+	return len(list), nil
+}
+
+func (mgr *Manager) sealSession(sess *session.Session) (json.RawMessage, error) {
+	b, err := session.Marshal(sess)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode session %s", sess.Id)
+	}
+	sealed, err := mgr.snapshot.keys.Seal(b, snapshotAdditionalData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to seal session %s", sess.Id)
+	}
+	return json.Marshal(sealed)
+}
+
+func (mgr *Manager) openSession(raw json.RawMessage) (*session.Session, error) {
+	var sealed string
+	err := json.Unmarshal(raw, &sealed)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed sealed session")
+	}
+	b, err := mgr.snapshot.keys.Open(sealed, snapshotAdditionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open sealed session")
+	}
+	return session.Unmarshal(b)
+}
+
+// writeFileAtomic replaces the file with data, readers never see a partially written file.
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create session snapshot")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write session snapshot")
+	}
+	err = os.Rename(tmp.Name(), file)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace session snapshot")
+	}
+	return nil
+}
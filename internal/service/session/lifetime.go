@@ -0,0 +1,66 @@
+package session
+
+import "time"
+
+const (
+	DefaultTempTTL         = 10 * time.Minute
+	DefaultIdleTimeout     = 30 * time.Minute
+	DefaultAbsoluteTTL     = 24 * time.Hour
+	DefaultCleanupInterval = time.Minute
+)
+
+// Lifetime defines session expiration rules shared by Manager implementations.
+// Zero duration disables the corresponding limit.
+type Lifetime struct {
+	// TempTTL is a lifetime of temporary login sessions.
+	TempTTL time.Duration
+	// IdleTimeout expires user session which was not accessed for the duration (sliding expiration).
+	IdleTimeout time.Duration
+	// AbsoluteTTL expires user session regardless of activity.
+	AbsoluteTTL time.Duration
+}
+
+func DefaultLifetime() Lifetime {
+	return Lifetime{
+		TempTTL:     DefaultTempTTL,
+		IdleTimeout: DefaultIdleTimeout,
+		AbsoluteTTL: DefaultAbsoluteTTL,
+	}
+}
+
+// Start initializes timestamps of a new session.
+func (l Lifetime) Start(sess *Session, now time.Time) {
+	sess.Version = 1
+	sess.CreatedAt = now
+	sess.LastAccessAt = now
+	sess.ExpiresAt = time.Time{}
+	ttl := l.AbsoluteTTL
+	if sess.IsTemp() {
+		ttl = l.TempTTL
+	}
+	if ttl > 0 {
+		sess.ExpiresAt = now.Add(ttl)
+	}
+}
+
+// Touch prolongs idle timeout of the session.
+func (l Lifetime) Touch(sess *Session, now time.Time) {
+	sess.LastAccessAt = now
+}
+
+// Deadline returns the moment the session expires unless it is touched, zero time means never.
+func (l Lifetime) Deadline(sess *Session) time.Time {
+	deadline := sess.ExpiresAt
+	if !sess.IsTemp() && l.IdleTimeout > 0 {
+		idle := sess.LastAccessAt.Add(l.IdleTimeout)
+		if deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+	return deadline
+}
+
+func (l Lifetime) Expired(sess *Session, now time.Time) bool {
+	deadline := l.Deadline(sess)
+	return !deadline.IsZero() && !now.Before(deadline)
+}
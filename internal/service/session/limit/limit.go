@@ -0,0 +1,137 @@
+// Package limit enforces the number of concurrent user sessions on top of session.Manager.
+package limit
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"time"
+)
+
+const (
+	// PolicyReject fails the new login when the user has Max sessions.
+	PolicyReject = "reject"
+	// PolicyEvictOldest destroys the oldest sessions to make room for the new one.
+	PolicyEvictOldest = "evict_oldest"
+)
+
+// DefaultTombstoneTTL keeps termination reason of evicted sessions without absolute expiration.
+const DefaultTombstoneTTL = 24 * time.Hour
+
+// Policy limits sessions of a user created with one provider.
+type Policy struct {
+	Max    int
+	Policy string
+}
+
+func (p Policy) validate() error {
+	if p.Max < 1 {
+		return errors.Errorf("session limit must be positive: %d", p.Max)
+	}
+	if p.Policy != PolicyReject && p.Policy != PolicyEvictOldest {
+		return errors.Errorf("unknown session limit policy \"%s\"", p.Policy)
+	}
+	return nil
+}
+
+// Manager wraps session.Manager and applies policies by provider name of the new session.
+// The limit is checked before the session is created, so concurrent logins of the same
+// user may briefly exceed it.
+type Manager struct {
+	session.Manager
+	policies   map[string]Policy
+	tombstones Tombstones
+	now        func() time.Time
+}
+
+// NewManager wraps mgr, which must support session.Manager.ListByUser. Only session.WithClock
+// of opts is used. Tombstones should be shared by replicas as the sessions are.
+func NewManager(mgr session.Manager, policies map[string]Policy, tombstones Tombstones, opts ...session.Option) (*Manager, error) {
+	for provider, policy := range policies {
+		err := policy.validate()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid session limit of provider %s", provider)
+		}
+	}
+	m := &Manager{
+		Manager:    mgr,
+		policies:   policies,
+		tombstones: tombstones,
+	}
+	m.now = session.ApplyOptions(m, opts).Now
+	return m, nil
+}
+
+func (mgr *Manager) Create(ctx context.Context, userId string, data map[string]interface{}) (*session.Session, error) {
+	providerName := providerOf(data)
+	policy, ok := mgr.policies[providerName]
+	if !ok {
+		return mgr.Manager.Create(ctx, userId, data)
+	}
+
+	all, err := mgr.Manager.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count user sessions")
+	}
+	active := make([]*session.Session, 0, len(all))
+	for _, sess := range all {
+		if providerOf(sess.Data) == providerName {
+			active = append(active, sess)
+		}
+	}
+
+	if excess := len(active) - policy.Max + 1; excess > 0 {
+		if policy.Policy == PolicyReject {
+			err = errors.WithField(session.ErrLimitExceeded, "limit", policy.Max)
+			return nil, errors.WithField(err, "userId", userId)
+		}
+		// sessions are sorted from the oldest
+		for _, sess := range active[:excess] {
+			err = mgr.evict(ctx, sess)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return mgr.Manager.Create(ctx, userId, data)
+}
+
+// Get returns session.TerminatedError for evicted sessions.
+func (mgr *Manager) Get(ctx context.Context, sessId string) (*session.Session, error) {
+	sess, err := mgr.Manager.Get(ctx, sessId)
+	if err == nil {
+		return sess, nil
+	}
+	reason, ok, tombErr := mgr.tombstones.Get(ctx, sessId)
+	if tombErr == nil && ok {
+		return nil, &session.TerminatedError{SessId: sessId, Reason: reason}
+	}
+	return nil, err
+}
+
+// TakeTemp keeps atomic take of the wrapped manager.
+func (mgr *Manager) TakeTemp(ctx context.Context, sessId string) (*session.Session, error) {
+	return session.TakeTemp(ctx, mgr.Manager, sessId)
+}
+
+func (mgr *Manager) evict(ctx context.Context, sess *session.Session) error {
+	until := sess.ExpiresAt
+	if until.IsZero() {
+		until = mgr.now().Add(DefaultTombstoneTTL)
+	}
+	err := mgr.tombstones.Put(ctx, sess.Id, session.ReasonSessionLimit, until)
+	if err != nil {
+		return errors.Wrap(err, "failed to record session eviction")
+	}
+	err = mgr.Manager.Destroy(session.WithDestroyReason(ctx, session.ReasonSessionLimit), sess.Id)
+	if err != nil {
+		return errors.Wrapf(err, "failed to evict session")
+	}
+	return nil
+}
+
+func providerOf(data map[string]interface{}) string {
+	auth, _ := session.GetAuth(data)
+	return auth.ProviderName
+}
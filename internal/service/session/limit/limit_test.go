@@ -0,0 +1,80 @@
+package limit
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/inmemory"
+	"myoidc/pkg/errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Create(t *testing.T) {
+	auth := func(provider string) map[string]interface{} {
+		return session.NewAuthData(session.Auth{ProviderName: provider, AccessToken: "ACCESS_TOKEN"})
+	}
+
+	tests := []struct {
+		name          string
+		policy        Policy
+		expectedError bool
+		evicted       int
+	}{
+		{name: "reject", policy: Policy{Max: 2, Policy: PolicyReject}, expectedError: true},
+		{name: "evict oldest", policy: Policy{Max: 2, Policy: PolicyEvictOldest}, evicted: 1},
+		{name: "evict to single", policy: Policy{Max: 1, Policy: PolicyEvictOldest}, evicted: 2},
+		{name: "under limit", policy: Policy{Max: 3, Policy: PolicyReject}},
+	}
+
+	for _, tt := range tests {
+		// far from time.Now, so tombstones kept without absolute ttl expire unless the clock is used
+		now := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := session.WithClock(func() time.Time { return now })
+		inner := inmemory.NewManager(clock, session.WithLifetime(session.Lifetime{IdleTimeout: time.Hour}))
+		mgr, err := NewManager(inner, map[string]Policy{"limited": tt.policy}, NewMemoryTombstones(clock), clock)
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+
+		existing := make([]*session.Session, 0)
+		for i := 0; i < 2; i++ {
+			sess, err := mgr.Create(context.TODO(), "123", auth("limited"))
+			assert.NoError(t, err, tt.name)
+			existing = append(existing, sess)
+			now = now.Add(time.Second)
+		}
+		// sessions of other providers and users are not counted
+		_, err = mgr.Create(context.TODO(), "123", auth("unlimited"))
+		assert.NoError(t, err, tt.name)
+		_, err = mgr.Create(context.TODO(), "456", auth("limited"))
+		assert.NoError(t, err, tt.name)
+
+		_, err = mgr.Create(context.TODO(), "123", auth("limited"))
+		if tt.expectedError {
+			assert.True(t, errors.HasCause(err, session.ErrLimitExceeded), tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+
+		for i, sess := range existing {
+			_, err = mgr.Get(context.TODO(), sess.Id)
+			if i < tt.evicted {
+				var terminated *session.TerminatedError
+				if assert.True(t, errors.As(err, &terminated), tt.name) {
+					assert.Equal(t, session.ReasonSessionLimit, terminated.Reason, tt.name)
+				}
+			} else {
+				assert.NoError(t, err, tt.name)
+			}
+		}
+	}
+}
+
+func TestNewManager(t *testing.T) {
+	_, err := NewManager(inmemory.NewManager(), map[string]Policy{"p": {Max: 0, Policy: PolicyReject}}, NewMemoryTombstones())
+	assert.Error(t, err, "zero limit")
+	_, err = NewManager(inmemory.NewManager(), map[string]Policy{"p": {Max: 1, Policy: "unknown"}}, NewMemoryTombstones())
+	assert.Error(t, err, "unknown policy")
+}
@@ -0,0 +1,98 @@
+package limit
+
+import (
+	"context"
+	goredis "github.com/redis/go-redis/v9"
+	"myoidc/internal/service/session"
+	"sync"
+	"time"
+)
+
+// Tombstones keep termination reasons of destroyed sessions until they would expire anyway.
+type Tombstones interface {
+	Put(ctx context.Context, sessId string, reason string, until time.Time) error
+	Get(ctx context.Context, sessId string) (string, bool, error)
+}
+
+type tombstone struct {
+	reason string
+	until  time.Time
+}
+
+// MemoryTombstones are Tombstones for single replica deployments.
+type MemoryTombstones struct {
+	items map[string]tombstone
+	mx    sync.Mutex
+	now   func() time.Time
+}
+
+// NewMemoryTombstones creates tombstones, only session.WithClock of opts is used.
+func NewMemoryTombstones(opts ...session.Option) *MemoryTombstones {
+	t := &MemoryTombstones{
+		items: make(map[string]tombstone),
+	}
+	t.now = session.ApplyOptions(t, opts).Now
+	return t
+}
+
+func (t *MemoryTombstones) Put(ctx context.Context, sessId string, reason string, until time.Time) error {
+	now := t.now()
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	// evict expired tombstones on write, so no janitor is needed
+	for id, item := range t.items {
+		if !now.Before(item.until) {
+			delete(t.items, id)
+		}
+	}
+	t.items[sessId] = tombstone{reason: reason, until: until}
+	return nil
+}
+
+func (t *MemoryTombstones) Get(ctx context.Context, sessId string) (string, bool, error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	item, ok := t.items[sessId]
+	if !ok || !t.now().Before(item.until) {
+		return "", false, nil
+	}
+	return item.reason, true, nil
+}
+
+// RedisTombstones are Tombstones shared by replicas, keys are "{prefix}tomb:{sessId}".
+type RedisTombstones struct {
+	rdb    goredis.UniversalClient
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisTombstones creates tombstones, only session.WithClock of opts is used.
+func NewRedisTombstones(rdb goredis.UniversalClient, prefix string, opts ...session.Option) *RedisTombstones {
+	t := &RedisTombstones{
+		rdb:    rdb,
+		prefix: prefix,
+	}
+	t.now = session.ApplyOptions(t, opts).Now
+	return t
+}
+
+func (t *RedisTombstones) Put(ctx context.Context, sessId string, reason string, until time.Time) error {
+	ttl := until.Sub(t.now())
+	if ttl <= 0 {
+		return nil
+	}
+	return t.rdb.Set(ctx, t.prefix+"tomb:"+sessId, reason, ttl).Err()
+}
+
+func (t *RedisTombstones) Get(ctx context.Context, sessId string) (string, bool, error) {
+	reason, err := t.rdb.Get(ctx, t.prefix+"tomb:"+sessId).Result()
+	if err == goredis.Nil {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return reason, true, nil
+}
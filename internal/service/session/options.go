@@ -0,0 +1,129 @@
+package session
+
+import (
+	"myoidc/pkg/log"
+	"sync"
+	"time"
+)
+
+// Options are settings shared by Manager implementations and other session based stores.
+type Options struct {
+	Lifetime Lifetime
+	Now      func() time.Time
+	// CleanupInterval of the background janitor, zero disables it.
+	CleanupInterval time.Duration
+	// Logger reports failures of background tasks, log.GetDefault() by default.
+	Logger log.Logger
+}
+
+// Option configures a manager, shared options are defined here and managers define
+// their own ones by ManagerOption.
+type Option interface {
+	apply(o *Options, target interface{})
+}
+
+type optionFunc func(o *Options, target interface{})
+
+func (fn optionFunc) apply(o *Options, target interface{}) {
+	fn(o, target)
+}
+
+// WithLifetime sets session expiration rules, DefaultLifetime by default.
+func WithLifetime(lifetime Lifetime) Option {
+	return optionFunc(func(o *Options, _ interface{}) {
+		o.Lifetime = lifetime
+	})
+}
+
+// WithClock replaces time.Now, useful for tests.
+func WithClock(now func() time.Time) Option {
+	return optionFunc(func(o *Options, _ interface{}) {
+		o.Now = now
+	})
+}
+
+// WithCleanupInterval starts background janitor removing expired sessions with the interval,
+// the manager must be closed to stop it. Stores expiring entries by themselves ignore it.
+func WithCleanupInterval(interval time.Duration) Option {
+	return optionFunc(func(o *Options, _ interface{}) {
+		o.CleanupInterval = interval
+	})
+}
+
+// WithLogger sets logger of background tasks.
+func WithLogger(l log.Logger) Option {
+	return optionFunc(func(o *Options, _ interface{}) {
+		o.Logger = l
+	})
+}
+
+// ManagerOption returns option of a specific manager type T, other targets ignore it.
+func ManagerOption[T any](fn func(target T)) Option {
+	return optionFunc(func(_ *Options, target interface{}) {
+		if t, ok := target.(T); ok {
+			fn(t)
+		}
+	})
+}
+
+// ApplyOptions returns default options overridden by opts, manager specific options are applied to target.
+func ApplyOptions(target interface{}, opts []Option) Options {
+	o := Options{
+		Lifetime: DefaultLifetime(),
+		Now:      time.Now,
+		Logger:   log.GetDefault(),
+	}
+	for _, opt := range opts {
+		opt.apply(&o, target)
+	}
+	return o
+}
+
+// Task is run by Janitor every Interval, zero Interval disables it.
+type Task struct {
+	Interval time.Duration
+	Run      func()
+}
+
+// Janitor runs background tasks of a store until it is closed.
+type Janitor struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// StartJanitor starts a goroutine per enabled task.
+func StartJanitor(tasks ...Task) *Janitor {
+	j := &Janitor{stop: make(chan struct{})}
+	for _, task := range tasks {
+		if task.Interval <= 0 {
+			continue
+		}
+		j.wg.Add(1)
+		go j.run(task)
+	}
+	return j
+}
+
+func (j *Janitor) run(task Task) {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(task.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			task.Run()
+		}
+	}
+}
+
+// Close stops the tasks and waits for running ones to complete, it is safe to call it twice.
+func (j *Janitor) Close() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	j.wg.Wait()
+}
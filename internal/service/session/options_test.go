@@ -0,0 +1,44 @@
+package session
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testTarget struct {
+	name string
+}
+
+func TestApplyOptions(t *testing.T) {
+	now := func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	target := &testTarget{}
+	o := ApplyOptions(target, []Option{
+		WithClock(now),
+		WithCleanupInterval(time.Second),
+		ManagerOption(func(tt *testTarget) { tt.name = "applied" }),
+		ManagerOption(func(s *Session) { t.Error("option of another target is applied") }),
+	})
+
+	assert.Equal(t, now(), o.Now())
+	assert.Equal(t, DefaultLifetime(), o.Lifetime)
+	assert.Equal(t, time.Second, o.CleanupInterval)
+	assert.Equal(t, "applied", target.name)
+}
+
+func TestJanitor(t *testing.T) {
+	var runs atomic.Int32
+	j := StartJanitor(
+		Task{Interval: time.Millisecond, Run: func() { runs.Add(1) }},
+		Task{Run: func() { t.Error("disabled task is run") }},
+	)
+	assert.Eventually(t, func() bool { return runs.Load() > 1 }, time.Second, time.Millisecond)
+	j.Close()
+	j.Close()
+
+	stopped := runs.Load()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load(), "task is run after Close")
+}
@@ -0,0 +1,362 @@
+package redis
+
+import (
+	"context"
+	goredis "github.com/redis/go-redis/v9"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"time"
+)
+
+const DefaultPrefix = "myoidc:"
+
+// Manager is a Redis implementation of session.Manager interface for multi replica deployments.
+//
+// Keys layout:
+//
+//	{prefix}sess:{id}      user session, expires with session deadline
+//	{prefix}temp:{id}      temporary login session, taken atomically with GETDEL
+//	{prefix}user:{userId}  set of user session ids
+//	{prefix}psid:{provider}:{providerSid}  set of session ids of the provider session
+type Manager struct {
+	rdb      goredis.UniversalClient
+	prefix   string
+	lifetime session.Lifetime
+	now      func() time.Time
+}
+
+func WithPrefix(prefix string) session.Option {
+	return session.ManagerOption(func(mgr *Manager) {
+		mgr.prefix = prefix
+	})
+}
+
+// NewManager creates manager, session.WithCleanupInterval is ignored as Redis expires keys itself.
+func NewManager(rdb goredis.UniversalClient, opts ...session.Option) *Manager {
+	mgr := &Manager{
+		rdb:    rdb,
+		prefix: DefaultPrefix,
+	}
+	o := session.ApplyOptions(mgr, opts)
+	mgr.lifetime, mgr.now = o.Lifetime, o.Now
+	return mgr
+}
+
+func (mgr *Manager) Create(ctx context.Context, userId string, data map[string]interface{}) (*session.Session, error) {
+	return mgr.create(ctx, userId, false, data)
+}
+
+func (mgr *Manager) CreateTemp(ctx context.Context, data map[string]interface{}) (*session.Session, error) {
+	return mgr.create(ctx, "", true, data)
+}
+
+func (mgr *Manager) create(ctx context.Context, userId string, temp bool, data map[string]interface{}) (*session.Session, error) {
+	sessId, err := session.NewId()
+	if err != nil {
+		return nil, err
+	}
+
+	now := mgr.now()
+	sess := session.NewSession(sessId, userId, data)
+	sess.Temp = temp
+	mgr.lifetime.Start(sess, now)
+	value, err := session.Marshal(sess)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode session")
+	}
+
+	_, err = mgr.rdb.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, mgr.key(sess), value, mgr.ttl(sess, now))
+		if !sess.IsTemp() {
+			for _, indexKey := range mgr.indexKeys(sess) {
+				pipe.SAdd(ctx, indexKey, sess.Id)
+			}
+			mgr.expireIndexes(ctx, pipe, sess)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store session")
+	}
+
+	return sess, nil
+}
+
+func (mgr *Manager) Get(ctx context.Context, sessId string) (*session.Session, error) {
+	values, err := mgr.rdb.MGet(ctx, mgr.sessKey(sessId), mgr.tempKey(sessId)).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load session")
+	}
+	var value string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			value = s
+			break
+		}
+	}
+	if value == "" {
+		return nil, errors.Errorf("session not found by id %s", sessId)
+	}
+
+	sess, err := session.Unmarshal([]byte(value))
+	if err != nil {
+		return nil, err
+	}
+	now := mgr.now()
+	if mgr.lifetime.Expired(sess, now) {
+		_ = mgr.destroy(ctx, sess)
+		return nil, errors.Wrapf(session.ErrExpired, "session %s", sessId)
+	}
+	if sess.IsTemp() {
+		return sess, nil
+	}
+
+	mgr.lifetime.Touch(sess, now)
+	err = mgr.compareAndSet(ctx, sess, sess.Version, now)
+	if err == session.ErrVersionConflict {
+		// concurrent update has touched the session already
+		return sess, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to touch session")
+	}
+
+	return sess, nil
+}
+
+func (mgr *Manager) Update(ctx context.Context, sess *session.Session) (*session.Session, error) {
+	now := mgr.now()
+	updated := sess.Clone()
+	updated.Version++
+	mgr.lifetime.Touch(updated, now)
+
+	err := mgr.compareAndSet(ctx, updated, sess.Version, now)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// compareAndSet stores the session if the stored one has the expected version.
+// Watched key fails the transaction if it's changed between the check and the write.
+func (mgr *Manager) compareAndSet(ctx context.Context, sess *session.Session, expected int64, now time.Time) error {
+	key := mgr.key(sess)
+	err := mgr.rdb.Watch(ctx, func(tx *goredis.Tx) error {
+		value, err := tx.Get(ctx, key).Result()
+		if err == goredis.Nil {
+			return errors.Errorf("session not found by id %s", sess.Id)
+		} else if err != nil {
+			return errors.Wrap(err, "failed to load session")
+		}
+		stored, err := session.Unmarshal([]byte(value))
+		if err != nil {
+			return err
+		}
+		if mgr.lifetime.Expired(stored, now) {
+			return errors.Wrapf(session.ErrExpired, "session %s", sess.Id)
+		}
+		if stored.Version != expected {
+			return session.ErrVersionConflict
+		}
+		// only data and access time are changed by callers
+		sess.UserId = stored.UserId
+		sess.CreatedAt = stored.CreatedAt
+		sess.ExpiresAt = stored.ExpiresAt
+
+		b, err := session.Marshal(sess)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode session")
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, key, b, mgr.ttl(sess, now))
+			if !sess.IsTemp() && mgr.lifetime.AbsoluteTTL <= 0 {
+				// idle timeout is prolonged, so is the longest member ttl
+				mgr.expireIndexes(ctx, pipe, sess)
+			}
+			return nil
+		})
+		return err
+	}, key)
+	if err == goredis.TxFailedErr {
+		return session.ErrVersionConflict
+	}
+	return err
+}
+
+func (mgr *Manager) TakeTemp(ctx context.Context, sessId string) (*session.Session, error) {
+	value, err := mgr.rdb.GetDel(ctx, mgr.tempKey(sessId)).Result()
+	if err == goredis.Nil {
+		return nil, errors.Errorf("temporary session not found by id %s", sessId)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to take temporary session")
+	}
+
+	sess, err := session.Unmarshal([]byte(value))
+	if err != nil {
+		return nil, err
+	}
+	if mgr.lifetime.Expired(sess, mgr.now()) {
+		return nil, errors.Wrapf(session.ErrExpired, "session %s", sessId)
+	}
+	return sess, nil
+}
+
+func (mgr *Manager) Destroy(ctx context.Context, sessId string) error {
+	value, err := mgr.rdb.Get(ctx, mgr.sessKey(sessId)).Result()
+	if err == goredis.Nil {
+		return mgr.rdb.Del(ctx, mgr.tempKey(sessId)).Err()
+	} else if err != nil {
+		return errors.Wrap(err, "failed to load session")
+	}
+
+	sess, err := session.Unmarshal([]byte(value))
+	if err != nil {
+		return mgr.rdb.Del(ctx, mgr.sessKey(sessId)).Err()
+	}
+	return mgr.destroy(ctx, sess)
+}
+
+func (mgr *Manager) destroy(ctx context.Context, sess *session.Session) error {
+	_, err := mgr.rdb.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, mgr.key(sess))
+		if !sess.IsTemp() {
+			for _, indexKey := range mgr.indexKeys(sess) {
+				pipe.SRem(ctx, indexKey, sess.Id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to destroy session")
+	}
+	return nil
+}
+
+func (mgr *Manager) ListByUser(ctx context.Context, userId string) ([]*session.Session, error) {
+	list, err := mgr.loadIndexed(ctx, mgr.userKey(userId))
+	if err != nil {
+		return nil, err
+	}
+	session.SortByCreatedAt(list)
+	return list, nil
+}
+
+func (mgr *Manager) DestroyByUser(ctx context.Context, userId string) (int, error) {
+	return mgr.destroyIndexed(ctx, mgr.userKey(userId))
+}
+
+func (mgr *Manager) DestroyByProviderSession(ctx context.Context, providerName string, providerSid string) (int, error) {
+	return mgr.destroyIndexed(ctx, mgr.providerSidKey(providerName, providerSid))
+}
+
+// loadIndexed returns active sessions from the index set, ids of gone sessions are removed from the set.
+func (mgr *Manager) loadIndexed(ctx context.Context, indexKey string) ([]*session.Session, error) {
+	ids, err := mgr.rdb.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load session index")
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = mgr.sessKey(id)
+	}
+	values, err := mgr.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load sessions")
+	}
+
+	now := mgr.now()
+	list := make([]*session.Session, 0, len(values))
+	stale := make([]interface{}, 0)
+	for i, v := range values {
+		value, ok := v.(string)
+		if !ok {
+			stale = append(stale, ids[i])
+			continue
+		}
+		sess, err := session.Unmarshal([]byte(value))
+		if err != nil || mgr.lifetime.Expired(sess, now) {
+			continue
+		}
+		list = append(list, sess)
+	}
+	if len(stale) > 0 {
+		mgr.rdb.SRem(ctx, indexKey, stale...)
+	}
+	return list, nil
+}
+
+func (mgr *Manager) destroyIndexed(ctx context.Context, indexKey string) (int, error) {
+	list, err := mgr.loadIndexed(ctx, indexKey)
+	if err != nil {
+		return 0, err
+	}
+	for _, sess := range list {
+		err = mgr.destroy(ctx, sess)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(list), nil
+}
+
+// indexKeys returns keys of index sets the user session belongs to.
+func (mgr *Manager) indexKeys(sess *session.Session) []string {
+	keys := []string{mgr.userKey(sess.UserId)}
+	if auth, _ := session.GetAuth(sess.Data); auth.ProviderSid != "" {
+		keys = append(keys, mgr.providerSidKey(auth.ProviderName, auth.ProviderSid))
+	}
+	return keys
+}
+
+// expireIndexes sets ttl of index sets to the longest ttl a member may have, the session
+// being stored is the last one to expire. Sets of sessions without expiration don't expire.
+func (mgr *Manager) expireIndexes(ctx context.Context, pipe goredis.Pipeliner, sess *session.Session) {
+	ttl := mgr.lifetime.AbsoluteTTL
+	if ttl <= 0 {
+		ttl = mgr.lifetime.IdleTimeout
+	}
+	if ttl <= 0 {
+		return
+	}
+	for _, indexKey := range mgr.indexKeys(sess) {
+		pipe.PExpire(ctx, indexKey, ttl)
+	}
+}
+
+// ttl returns key expiration, 0 means the key doesn't expire.
+func (mgr *Manager) ttl(sess *session.Session, now time.Time) time.Duration {
+	deadline := mgr.lifetime.Deadline(sess)
+	if deadline.IsZero() {
+		return 0
+	}
+	ttl := deadline.Sub(now)
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	return ttl
+}
+
+func (mgr *Manager) key(sess *session.Session) string {
+	if sess.IsTemp() {
+		return mgr.tempKey(sess.Id)
+	}
+	return mgr.sessKey(sess.Id)
+}
+
+func (mgr *Manager) sessKey(sessId string) string {
+	return mgr.prefix + "sess:" + sessId
+}
+
+func (mgr *Manager) tempKey(sessId string) string {
+	return mgr.prefix + "temp:" + sessId
+}
+
+func (mgr *Manager) userKey(userId string) string {
+	return mgr.prefix + "user:" + userId
+}
+
+func (mgr *Manager) providerSidKey(providerName string, providerSid string) string {
+	return mgr.prefix + "psid:" + providerName + ":" + providerSid
+}
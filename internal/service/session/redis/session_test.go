@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/sessiontest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestManager(t *testing.T, opts ...session.Option) (*Manager, *miniredis.Miniredis) {
+	srv := miniredis.RunT(t)
+	rdb := goredis.NewClient(&goredis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewManager(rdb, opts...), srv
+}
+
+func TestManager_Behaviour(t *testing.T) {
+	sessiontest.Run(t, func(t *testing.T, now func() time.Time, lifetime session.Lifetime) session.Manager {
+		mgr, _ := newTestManager(t, session.WithClock(now), session.WithLifetime(lifetime))
+		return mgr
+	})
+}
+
+func TestManager_Keys(t *testing.T) {
+	mgr, srv := newTestManager(t, WithPrefix("test:"), session.WithLifetime(session.Lifetime{
+		TempTTL:     time.Minute,
+		IdleTimeout: 30 * time.Minute,
+		AbsoluteTTL: time.Hour,
+	}))
+
+	temp, err := mgr.CreateTemp(context.TODO(), nil)
+	assert.NoError(t, err, "unexpected error")
+	assert.True(t, srv.Exists("test:temp:"+temp.Id), "temp session key is missing")
+	assert.Equal(t, time.Minute, srv.TTL("test:temp:"+temp.Id), "temp session has invalid ttl")
+
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+	assert.True(t, srv.Exists("test:sess:"+sess.Id), "session key is missing")
+	assert.Equal(t, 30*time.Minute, srv.TTL("test:sess:"+sess.Id), "session ttl is not an idle timeout")
+	members, err := srv.Members("test:user:123")
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, []string{sess.Id}, members, "user index is invalid")
+
+	// native ttl evicts session
+	srv.FastForward(time.Minute)
+	assert.False(t, srv.Exists("test:temp:"+temp.Id), "temp session is not expired")
+
+	assert.NoError(t, mgr.Destroy(context.TODO(), sess.Id), "unexpected error")
+	assert.False(t, srv.Exists("test:sess:"+sess.Id), "session is not destroyed")
+	assert.False(t, srv.Exists("test:user:123"), "user index is not cleaned")
+}
+
+func TestManager_IndexTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mgr, srv := newTestManager(t, WithPrefix("test:"), session.WithClock(func() time.Time { return now }), session.WithLifetime(session.Lifetime{
+		IdleTimeout: 30 * time.Minute,
+	}))
+
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	assert.Equal(t, 30*time.Minute, srv.TTL("test:user:123"), "user index doesn't expire without absolute ttl")
+
+	// touch prolongs the index with the session
+	srv.FastForward(20 * time.Minute)
+	now = now.Add(20 * time.Minute)
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 30*time.Minute, srv.TTL("test:user:123"), "user index is not prolonged by touch")
+
+	srv.FastForward(30 * time.Minute)
+	assert.False(t, srv.Exists("test:user:123"), "user index of idle user is not expired")
+}
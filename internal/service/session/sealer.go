@@ -0,0 +1,80 @@
+package session
+
+import (
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+	"strings"
+)
+
+// sealedPrefix marks an encrypted token: "$sealed:<keyring token>".
+const sealedPrefix = "$sealed:"
+
+// TokenSealer encrypts provider tokens of Auth in session data, other data is kept as is.
+// Key id is stored with every token, so keys can be rotated while old tokens are readable.
+type TokenSealer struct {
+	keys    *keyring.KeyRing
+	purpose string
+}
+
+// NewTokenSealer creates sealer, purpose separates tokens sealed for different stores.
+func NewTokenSealer(keys *keyring.KeyRing, purpose string) *TokenSealer {
+	return &TokenSealer{
+		keys:    keys,
+		purpose: purpose,
+	}
+}
+
+// Seal encrypts tokens in data bound to the subject, e.g. user or session id,
+// so sealed tokens can't be moved to another session. Data is changed in place.
+func (s *TokenSealer) Seal(data map[string]interface{}, subject string) error {
+	auth, ok := GetAuth(data)
+	if !ok {
+		return nil
+	}
+	for name, token := range authTokens(&auth) {
+		if *token == "" || strings.HasPrefix(*token, sealedPrefix) {
+			continue
+		}
+		sealed, err := s.keys.Seal([]byte(*token), s.additionalData(subject, name))
+		if err != nil {
+			return errors.Wrapf(err, "failed to encrypt %s", name)
+		}
+		*token = sealedPrefix + sealed
+	}
+	SetAuth(data, auth)
+	return nil
+}
+
+// Open decrypts tokens sealed by Seal, plaintext tokens written before encryption
+// was enabled are kept as is. Data is changed in place.
+func (s *TokenSealer) Open(data map[string]interface{}, subject string) error {
+	auth, ok := GetAuth(data)
+	if !ok {
+		return nil
+	}
+	for name, token := range authTokens(&auth) {
+		if !strings.HasPrefix(*token, sealedPrefix) {
+			continue
+		}
+		plaintext, err := s.keys.Open(strings.TrimPrefix(*token, sealedPrefix), s.additionalData(subject, name))
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt %s", name)
+		}
+		*token = string(plaintext)
+	}
+	SetAuth(data, auth)
+	return nil
+}
+
+func (s *TokenSealer) additionalData(subject string, name string) []byte {
+	return []byte(s.purpose + "." + subject + "." + name)
+}
+
+// authTokens returns provider tokens of the auth by name.
+func authTokens(auth *Auth) map[string]*string {
+	return map[string]*string{
+		"accessToken":  &auth.AccessToken,
+		"refreshToken": &auth.RefreshToken,
+		"idToken":      &auth.IDToken,
+	}
+}
@@ -1,61 +1,191 @@
 package session
 
-import "context"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"myoidc/pkg/errors"
+	"sort"
+	"time"
+)
 
+// ErrVersionConflict is returned by Manager.Update when the session was changed concurrently.
+var ErrVersionConflict = errors.Error("session was modified concurrently")
+
+// ErrNotSupported is returned by managers which can't perform the operation by design.
+var ErrNotSupported = errors.Error("operation is not supported by session manager")
+
+// ErrExpired is returned by Manager.Get and Manager.Update for a session found expired on access.
+var ErrExpired = errors.Error("session is expired")
+
+// ErrLimitExceeded is returned by Manager.Create when a session limit policy rejects the new session.
+var ErrLimitExceeded = errors.Error("active sessions limit is exceeded")
+
+// Reasons sessions are destroyed for.
+const (
+	// ReasonSessionLimit is a termination reason of sessions evicted by a newer login.
+	ReasonSessionLimit = "session_limit"
+	ReasonLogout       = "logout"
+	ReasonRevoked      = "revoked"
+)
+
+type destroyReasonKey struct{}
+
+// WithDestroyReason returns context telling session observers why sessions are destroyed.
+func WithDestroyReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, destroyReasonKey{}, reason)
+}
+
+// DestroyReason returns reason set by WithDestroyReason or empty string.
+func DestroyReason(ctx context.Context) string {
+	reason, _ := ctx.Value(destroyReasonKey{}).(string)
+	return reason
+}
+
+// Ref identifies the session without disclosing its id, which is a bearer credential,
+// e.g. in events and admin API.
+func Ref(sessId string) string {
+	sum := sha256.Sum256([]byte(sessId))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// TerminatedError is returned by Manager.Get for a session destroyed by a policy,
+// so the client can be told why the session has ended.
+type TerminatedError struct {
+	SessId string
+	Reason string
+}
+
+func (e *TerminatedError) Error() string {
+	return "session " + e.SessId + " is terminated: " + e.Reason
+}
+
+// modifyAttempts limits retries of Modify on version conflicts.
+const modifyAttempts = 5
+
+// Manager stores sessions. Get returns a copy, changes are persisted only by Update.
 type Manager interface {
 	Create(ctx context.Context, userId string, data map[string]interface{}) (*Session, error)
 	CreateTemp(ctx context.Context, data map[string]interface{}) (*Session, error)
 	Get(ctx context.Context, sessId string) (*Session, error)
+	// Update stores session data if the stored version equals sess.Version, otherwise
+	// ErrVersionConflict is returned. The stored session with incremented version is returned.
+	Update(ctx context.Context, sess *Session) (*Session, error)
 	Destroy(ctx context.Context, sessId string) error
+	// ListByUser returns active sessions of the user, temporary sessions are never listed.
+	ListByUser(ctx context.Context, userId string) ([]*Session, error)
+	// DestroyByUser destroys all sessions of the user and returns their count.
+	DestroyByUser(ctx context.Context, userId string) (int, error)
+	// DestroyByProviderSession destroys sessions created within the identity provider session,
+	// e.g. by OIDC "sid" claim on back-channel logout, and returns their count.
+	DestroyByProviderSession(ctx context.Context, providerName string, providerSid string) (int, error)
 }
 
-type Session struct {
-	Id     string
-	UserId string
-	Data   map[string]interface{}
+// Modify applies fn to the current session and stores the result, fn is called again
+// with a fresh copy on version conflict. Errors returned by fn are returned as is.
+func Modify(ctx context.Context, mgr Manager, sessId string, fn func(sess *Session) error) (*Session, error) {
+	for attempt := 0; attempt < modifyAttempts; attempt++ {
+		sess, err := mgr.Get(ctx, sessId)
+		if err != nil {
+			return nil, err
+		}
+		err = fn(sess)
+		if err != nil {
+			return nil, err
+		}
+		sess, err = mgr.Update(ctx, sess)
+		if err != ErrVersionConflict {
+			return sess, err
+		}
+	}
+	return nil, ErrVersionConflict
 }
 
-func NewSession(id string, userId string, data map[string]interface{}) *Session {
-	if data == nil {
-		data = make(map[string]interface{})
+// TempTaker is implemented by managers able to get and destroy temporary session atomically,
+// so a login transaction can't be completed twice by concurrent requests.
+type TempTaker interface {
+	TakeTemp(ctx context.Context, sessId string) (*Session, error)
+}
+
+// TakeTemp returns temporary session and destroys it, atomically if Manager implements TempTaker.
+func TakeTemp(ctx context.Context, mgr Manager, sessId string) (*Session, error) {
+	if taker, ok := mgr.(TempTaker); ok {
+		return taker.TakeTemp(ctx, sessId)
 	}
-	return &Session{
-		Id:     id,
-		UserId: userId,
-		Data:   data,
+	sess, err := mgr.Get(ctx, sessId)
+	if err != nil {
+		return nil, err
 	}
+	if !sess.IsTemp() {
+		return nil, errors.Errorf("session %s is not temporary", sessId)
+	}
+	return sess, mgr.Destroy(ctx, sessId)
 }
 
-type AuthData map[string]interface{}
+type Session struct {
+	Id     string
+	UserId string
+	// Temp marks a login session created by Manager.CreateTemp, it has no user.
+	Temp bool
+	Data map[string]interface{}
+	// Version is incremented by every Manager.Update, it starts with 1.
+	Version int64
 
-func NewAuthData(providerName string, accessToken string, refreshToken *string) AuthData {
-	m := AuthData{
-		"providerName": providerName,
-		"accessToken":  accessToken,
-		"refreshToken": refreshToken,
-	}
-	return m
+	CreatedAt    time.Time
+	LastAccessAt time.Time
+	// ExpiresAt is an absolute expiration time, idle timeout is tracked by LastAccessAt.
+	ExpiresAt time.Time
 }
 
-func (data AuthData) IsValid() bool {
-	return GetString(data, "providerName", "") != "" &&
-		GetString(data, "accessToken", "") != ""
+// IsTemp reports whether session is a temporary one created by Manager.CreateTemp.
+func (s *Session) IsTemp() bool {
+	return s.Temp
 }
 
-func (data AuthData) GetProviderName() string {
-	return GetString(data, "providerName", "")
+// Clone returns a deep copy of the session, so it can be changed without affecting the store.
+func (s *Session) Clone() *Session {
+	c := *s
+	c.Data = cloneValue(s.Data).(map[string]interface{})
+	return &c
 }
 
-func (data AuthData) GetAccessToken() string {
-	return GetString(data, "accessToken", "")
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = cloneValue(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = cloneValue(value)
+		}
+		return c
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return v
+	}
+}
+
+// SortByCreatedAt sorts sessions from the oldest to the newest.
+func SortByCreatedAt(list []*Session) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
 }
 
-func (data AuthData) GetRefreshToken() *string {
-	refreshToken := GetString(data, "refreshToken", "")
-	if refreshToken == "" {
-		return nil
+func NewSession(id string, userId string, data map[string]interface{}) *Session {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	return &Session{
+		Id:     id,
+		UserId: userId,
+		Data:   data,
 	}
-	return &refreshToken
 }
 
 func GetString(m map[string]interface{}, key string, def string) string {
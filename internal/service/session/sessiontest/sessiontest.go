@@ -0,0 +1,349 @@
+// Package sessiontest contains behaviour tests shared by session.Manager implementations.
+package sessiontest
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory builds an empty manager using the clock and lifetime.
+type Factory func(t *testing.T, now func() time.Time, lifetime session.Lifetime) session.Manager
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+var lifetime = session.Lifetime{
+	TempTTL:     5 * time.Minute,
+	IdleTimeout: 30 * time.Minute,
+	AbsoluteTTL: time.Hour,
+}
+
+// Run runs behaviour tests against the manager implementation, tests named in skip
+// are skipped for managers which can't support the behaviour by design.
+func Run(t *testing.T, factory Factory, skip ...string) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, c *clock, mgr session.Manager)
+	}{
+		{"Create", testCreate},
+		{"CreateTemp", testCreateTemp},
+		{"Get", testGet},
+		{"Destroy", testDestroy},
+		{"TakeTemp", testTakeTemp},
+		{"Expiration", testExpiration},
+		{"Update", testUpdate},
+		{"Conflict", testConflict},
+		{"Modify", testModify},
+		{"ByUser", testByUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range skip {
+				if name == tt.name {
+					t.Skip("not supported by the manager")
+				}
+			}
+			c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			tt.test(t, c, factory(t, c.Now, lifetime))
+		})
+	}
+}
+
+func testCreate(t *testing.T, c *clock, mgr session.Manager) {
+	sess, err := mgr.Create(context.TODO(), "123", map[string]interface{}{"field1": "1"})
+	assert.NoError(t, err, "unexpected error")
+	assert.NotEmpty(t, sess.Id, "invalid session id")
+	assert.Equal(t, "123", sess.UserId, "invalid user id")
+	assert.False(t, sess.IsTemp(), "user session is temp")
+	assert.Equal(t, map[string]interface{}{"field1": "1"}, sess.Data, "invalid session data")
+	assert.True(t, c.now.Equal(sess.CreatedAt), "invalid created at")
+	assert.True(t, c.now.Add(lifetime.AbsoluteTTL).Equal(sess.ExpiresAt), "invalid expires at")
+
+	other, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+	assert.NotEqual(t, sess.Id, other.Id, "session ids are not unique")
+}
+
+func testCreateTemp(t *testing.T, c *clock, mgr session.Manager) {
+	sess, err := mgr.CreateTemp(context.TODO(), map[string]interface{}{"field1": "1"})
+	assert.NoError(t, err, "unexpected error")
+	assert.NotEmpty(t, sess.Id, "invalid session id")
+	assert.True(t, sess.IsTemp(), "temp session has user")
+	assert.Equal(t, map[string]interface{}{"field1": "1"}, sess.Data, "invalid session data")
+	assert.True(t, c.now.Add(lifetime.TempTTL).Equal(sess.ExpiresAt), "invalid expires at")
+}
+
+func testGet(t *testing.T, c *clock, mgr session.Manager) {
+	temp, err := mgr.CreateTemp(context.TODO(), map[string]interface{}{"field1": "11"})
+	assert.NoError(t, err, "unexpected error")
+	sess, err := mgr.Create(context.TODO(), "123", map[string]interface{}{"field1": "12"})
+	assert.NoError(t, err, "unexpected error")
+
+	res, err := mgr.Get(context.TODO(), temp.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assertSessionEqual(t, temp, res)
+	}
+	res, err = mgr.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assertSessionEqual(t, sess, res)
+	}
+
+	_, err = mgr.Get(context.TODO(), "not_exists")
+	assert.Error(t, err, "error expected")
+}
+
+func testDestroy(t *testing.T, c *clock, mgr session.Manager) {
+	sess1, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+	sess2, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+
+	assert.NoError(t, mgr.Destroy(context.TODO(), "not_exists"), "unexpected error")
+	assert.NoError(t, mgr.Destroy(context.TODO(), sess1.Id), "unexpected error")
+
+	_, err = mgr.Get(context.TODO(), sess1.Id)
+	assert.Error(t, err, "destroyed session is found")
+	_, err = mgr.Get(context.TODO(), sess2.Id)
+	assert.NoError(t, err, "another session is destroyed")
+}
+
+func testTakeTemp(t *testing.T, c *clock, mgr session.Manager) {
+	temp, err := mgr.CreateTemp(context.TODO(), map[string]interface{}{"backUrl": "/"})
+	assert.NoError(t, err, "unexpected error")
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+
+	res, err := session.TakeTemp(context.TODO(), mgr, temp.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assertSessionEqual(t, temp, res)
+	}
+	_, err = session.TakeTemp(context.TODO(), mgr, temp.Id)
+	assert.Error(t, err, "temp session is taken twice")
+	_, err = mgr.Get(context.TODO(), temp.Id)
+	assert.Error(t, err, "taken session is found")
+
+	_, err = session.TakeTemp(context.TODO(), mgr, sess.Id)
+	assert.Error(t, err, "user session is taken as temp")
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "user session is destroyed by take")
+}
+
+func testExpiration(t *testing.T, c *clock, mgr session.Manager) {
+	temp, err := mgr.CreateTemp(context.TODO(), nil)
+	assert.NoError(t, err, "unexpected error")
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+
+	c.now = c.now.Add(lifetime.TempTTL)
+	_, err = mgr.Get(context.TODO(), temp.Id)
+	assert.Error(t, err, "temp session is not expired")
+
+	// sliding idle timeout up to absolute lifetime: 5m, 30m, 55m
+	for i := 0; i < 3; i++ {
+		res, err := mgr.Get(context.TODO(), sess.Id)
+		if assert.NoError(t, err, "session expired too early") {
+			assert.True(t, c.now.Equal(res.LastAccessAt), "last access is not updated")
+			// stateless managers return a new id on touch
+			sess = res
+		}
+		c.now = c.now.Add(25 * time.Minute)
+	}
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.Error(t, err, "absolute lifetime is exceeded")
+
+	sess, err = mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+	c.now = c.now.Add(lifetime.IdleTimeout)
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.Error(t, err, "idle timeout is exceeded")
+}
+
+func testUpdate(t *testing.T, c *clock, mgr session.Manager) {
+	sess, err := mgr.Create(context.TODO(), "123", map[string]interface{}{"field1": "1"})
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, int64(1), sess.Version, "invalid initial version")
+
+	res, err := mgr.Get(context.TODO(), sess.Id)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	res.Data["field1"] = "changed"
+	again, err := mgr.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, "1", again.Data["field1"], "stored session is shared with caller")
+	}
+
+	c.now = c.now.Add(time.Minute)
+	res.Data["field2"] = "2"
+	updated, err := mgr.Update(context.TODO(), res)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	assert.Equal(t, int64(2), updated.Version, "version is not incremented")
+	assert.True(t, c.now.Equal(updated.LastAccessAt), "update doesn't touch session")
+
+	res, err = mgr.Get(context.TODO(), updated.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, map[string]interface{}{"field1": "changed", "field2": "2"}, res.Data, "data is not updated")
+		assert.Equal(t, int64(2), res.Version, "version is not stored")
+		assert.Equal(t, "123", res.UserId, "user id is changed")
+	}
+
+	// only data is updated
+	createdAt := res.CreatedAt
+	res.UserId = "456"
+	res.CreatedAt = res.CreatedAt.Add(-time.Hour)
+	updated, err = mgr.Update(context.TODO(), res)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, "123", updated.UserId, "user id is updated")
+		assert.True(t, createdAt.Equal(updated.CreatedAt), "creation time is updated")
+	}
+	res, err = mgr.Get(context.TODO(), updated.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, "123", res.UserId, "user id is stored")
+		assert.True(t, createdAt.Equal(res.CreatedAt), "creation time is stored")
+	}
+
+	// version of the sealed or stored session must match
+	stale := res.Clone()
+	stale.Version--
+	_, err = mgr.Update(context.TODO(), stale)
+	assert.Equal(t, session.ErrVersionConflict, err, "session of another version is updated")
+
+	// expired session is reported as such
+	c.now = c.now.Add(lifetime.IdleTimeout)
+	_, err = mgr.Update(context.TODO(), res)
+	assert.True(t, errors.HasCause(err, session.ErrExpired), "expired session is updated: %v", err)
+
+	sess, err = mgr.Create(context.TODO(), "123", nil)
+	if !assert.NoError(t, err, "unexpected error") {
+		return
+	}
+	assert.NoError(t, mgr.Destroy(context.TODO(), sess.Id), "unexpected error")
+	_, err = mgr.Update(context.TODO(), sess)
+	assert.Error(t, err, "destroyed session is updated")
+}
+
+func testConflict(t *testing.T, c *clock, mgr session.Manager) {
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+
+	first, err := mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "unexpected error")
+	second, err := mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "unexpected error")
+
+	first.Data["field1"] = "first"
+	_, err = mgr.Update(context.TODO(), first)
+	assert.NoError(t, err, "unexpected error")
+
+	second.Data["field1"] = "second"
+	_, err = mgr.Update(context.TODO(), second)
+	assert.Equal(t, session.ErrVersionConflict, err, "stale session is updated")
+
+	res, err := mgr.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, "first", res.Data["field1"], "stale session overwrites data")
+	}
+}
+
+func testModify(t *testing.T, c *clock, mgr session.Manager) {
+	sess, err := mgr.Create(context.TODO(), "123", map[string]interface{}{"field1": "1"})
+	assert.NoError(t, err, "unexpected error")
+
+	calls := 0
+	res, err := session.Modify(context.TODO(), mgr, sess.Id, func(s *session.Session) error {
+		calls++
+		if calls == 1 {
+			// concurrent request changes the session in between
+			other, err := mgr.Get(context.TODO(), sess.Id)
+			if err != nil {
+				return err
+			}
+			other.Data["field2"] = "2"
+			_, err = mgr.Update(context.TODO(), other)
+			if err != nil {
+				return err
+			}
+		}
+		s.Data["field1"] = s.Data["field1"].(string) + "1"
+		return nil
+	})
+	if assert.NoError(t, err, "unexpected error") {
+		assert.Equal(t, 2, calls, "modification is not retried on conflict")
+		assert.Equal(t, map[string]interface{}{"field1": "11", "field2": "2"}, res.Data, "invalid session data")
+		assert.Equal(t, int64(3), res.Version, "invalid version")
+	}
+
+	_, err = session.Modify(context.TODO(), mgr, res.Id, func(s *session.Session) error {
+		return assert.AnError
+	})
+	assert.Equal(t, assert.AnError, err, "fn error is not returned")
+}
+
+func testByUser(t *testing.T, c *clock, mgr session.Manager) {
+	newAuth := func(sid string) map[string]interface{} {
+		return session.NewAuthData(session.Auth{
+			ProviderName: "myoidc",
+			AccessToken:  "ACCESS_TOKEN",
+			ProviderSid:  sid,
+		})
+	}
+	_, err := mgr.CreateTemp(context.TODO(), nil)
+	assert.NoError(t, err, "unexpected error")
+	first, err := mgr.Create(context.TODO(), "123", newAuth("sid1"))
+	assert.NoError(t, err, "unexpected error")
+	c.now = c.now.Add(time.Minute)
+	second, err := mgr.Create(context.TODO(), "123", newAuth("sid2"))
+	assert.NoError(t, err, "unexpected error")
+	other, err := mgr.Create(context.TODO(), "456", newAuth("sid1"))
+	assert.NoError(t, err, "unexpected error")
+
+	list, err := mgr.ListByUser(context.TODO(), "123")
+	if assert.NoError(t, err, "unexpected error") && assert.Len(t, list, 2, "invalid sessions count") {
+		assertSessionEqual(t, first, list[0])
+		assertSessionEqual(t, second, list[1])
+	}
+	list, err = mgr.ListByUser(context.TODO(), "")
+	assert.NoError(t, err, "unexpected error")
+	assert.Empty(t, list, "temp sessions are listed")
+
+	count, err := mgr.DestroyByProviderSession(context.TODO(), "myoidc", "sid2")
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 1, count, "invalid destroyed count")
+	_, err = mgr.Get(context.TODO(), second.Id)
+	assert.Error(t, err, "session is not destroyed by provider session")
+	count, err = mgr.DestroyByProviderSession(context.TODO(), "other", "sid1")
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 0, count, "session of other provider is destroyed")
+
+	count, err = mgr.DestroyByUser(context.TODO(), "123")
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 1, count, "invalid destroyed count")
+	_, err = mgr.Get(context.TODO(), first.Id)
+	assert.Error(t, err, "session is not destroyed by user")
+	list, err = mgr.ListByUser(context.TODO(), "123")
+	assert.NoError(t, err, "unexpected error")
+	assert.Empty(t, list, "destroyed sessions are listed")
+
+	_, err = mgr.Get(context.TODO(), other.Id)
+	assert.NoError(t, err, "session of other user is destroyed")
+}
+
+func assertSessionEqual(t *testing.T, expected, actual *session.Session) {
+	assert.Equal(t, expected.Id, actual.Id, "session ids don't match")
+	assert.Equal(t, expected.UserId, actual.UserId, "user ids don't match")
+	assert.Equal(t, expected.Data, actual.Data, "session data don't match")
+	assert.True(t, expected.CreatedAt.Equal(actual.CreatedAt), "created at doesn't match")
+	assert.True(t, expected.ExpiresAt.Equal(actual.ExpiresAt), "expires at doesn't match")
+}
@@ -0,0 +1,48 @@
+package sqldb
+
+import (
+	"myoidc/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Dialect hides SQL differences between supported databases.
+type Dialect struct {
+	name string
+	// lock serializes migrations run by several replicas, empty if not needed
+	lock string
+}
+
+func NewDialect(name string) (Dialect, error) {
+	switch name {
+	case Postgres:
+		return Dialect{name: Postgres, lock: "SELECT pg_advisory_xact_lock(7346205817)"}, nil
+	case SQLite:
+		return Dialect{name: SQLite}, nil
+	default:
+		return Dialect{}, errors.Errorf("unsupported sql dialect \"%s\"", name)
+	}
+}
+
+// rebind replaces "?" placeholders with dialect specific ones.
+func (d Dialect) rebind(query string) string {
+	if d.name != Postgres {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
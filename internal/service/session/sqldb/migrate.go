@@ -0,0 +1,117 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"myoidc/pkg/errors"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// Migrate applies embedded schema migrations which are not applied yet.
+// Each migration runs in its own transaction and is recorded in schema_migrations table.
+func Migrate(ctx context.Context, db *sql.DB, dialect Dialect) error {
+	list, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS session_schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create migrations table")
+	}
+
+	for _, m := range list {
+		err = applyMigration(ctx, db, dialect, m)
+		if err != nil {
+			return errors.Wrapf(err, "failed to apply migration %s", m.name)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, dialect Dialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if dialect.lock != "" {
+		_, err = tx.ExecContext(ctx, dialect.lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	var applied int
+	err = tx.QueryRowContext(ctx,
+		dialect.rebind(`SELECT COUNT(*) FROM session_schema_migrations WHERE version = ?`),
+		m.version,
+	).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, m.query)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		dialect.rebind(`INSERT INTO session_schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+		m.version, m.name, time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func loadMigrations(dialect Dialect) ([]migration, error) {
+	dir := path.Join("migrations", dialect.name)
+	entries, err := migrations.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "no migrations for dialect %s", dialect.name)
+	}
+
+	list := make([]migration, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, errors.Errorf("invalid migration file name %s", e.Name())
+		}
+		query, err := migrations.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, migration{version: version, name: e.Name(), query: string(query)})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].version < list[j].version
+	})
+	return list, nil
+}
@@ -0,0 +1,13 @@
+CREATE TABLE sessions (
+    id             VARCHAR(128) PRIMARY KEY,
+    user_id        VARCHAR(255) NOT NULL DEFAULT '',
+    temp           BOOLEAN      NOT NULL DEFAULT FALSE,
+    data           JSONB        NOT NULL,
+    created_at     BIGINT       NOT NULL,
+    last_access_at BIGINT       NOT NULL,
+    expires_at     BIGINT,
+    deadline       BIGINT
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id) WHERE user_id <> '';
+CREATE INDEX sessions_deadline_idx ON sessions (deadline);
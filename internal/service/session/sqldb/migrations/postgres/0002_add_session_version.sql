@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+ALTER TABLE sessions ADD COLUMN provider VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN provider_sid VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX sessions_provider_sid_idx ON sessions (provider, provider_sid) WHERE provider_sid <> '';
@@ -0,0 +1,7 @@
+CREATE TABLE session_tombstones (
+    id         VARCHAR(128) PRIMARY KEY,
+    reason     VARCHAR(64)  NOT NULL,
+    expires_at BIGINT       NOT NULL
+);
+
+CREATE INDEX session_tombstones_expires_at_idx ON session_tombstones (expires_at);
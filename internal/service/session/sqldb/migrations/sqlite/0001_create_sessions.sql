@@ -0,0 +1,13 @@
+CREATE TABLE sessions (
+    id             TEXT    PRIMARY KEY,
+    user_id        TEXT    NOT NULL DEFAULT '',
+    temp           INTEGER NOT NULL DEFAULT 0,
+    data           TEXT    NOT NULL,
+    created_at     INTEGER NOT NULL,
+    last_access_at INTEGER NOT NULL,
+    expires_at     INTEGER,
+    deadline       INTEGER
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id) WHERE user_id <> '';
+CREATE INDEX sessions_deadline_idx ON sessions (deadline);
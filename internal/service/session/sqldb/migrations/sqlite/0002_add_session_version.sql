@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+CREATE TABLE session_tombstones (
+    id         TEXT    PRIMARY KEY,
+    reason     TEXT    NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX session_tombstones_expires_at_idx ON session_tombstones (expires_at);
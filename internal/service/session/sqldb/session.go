@@ -0,0 +1,299 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"time"
+)
+
+// Manager is a database/sql implementation of session.Manager interface.
+// Timestamps are stored as unix milliseconds, deadline column is the nearest
+// of absolute and idle expiration and is indexed for cleanup.
+type Manager struct {
+	db       *sql.DB
+	dialect  Dialect
+	lifetime session.Lifetime
+	now      func() time.Time
+	janitor  *session.Janitor
+}
+
+// NewManager creates manager, the schema must be created by Migrate beforehand.
+// session.WithCleanupInterval starts background janitor, use Manager.Close to stop it.
+func NewManager(db *sql.DB, dialect Dialect, opts ...session.Option) *Manager {
+	mgr := &Manager{
+		db:      db,
+		dialect: dialect,
+	}
+	o := session.ApplyOptions(mgr, opts)
+	mgr.lifetime, mgr.now = o.Lifetime, o.Now
+	mgr.janitor = session.StartJanitor(session.Task{
+		Interval: o.CleanupInterval,
+		Run: func() {
+			if _, err := mgr.Cleanup(context.Background()); err != nil {
+				o.Logger.WithError(err).Error("failed to cleanup sessions")
+			}
+		},
+	})
+	return mgr
+}
+
+func (mgr *Manager) Create(ctx context.Context, userId string, data map[string]interface{}) (*session.Session, error) {
+	return mgr.create(ctx, userId, false, data)
+}
+
+func (mgr *Manager) CreateTemp(ctx context.Context, data map[string]interface{}) (*session.Session, error) {
+	return mgr.create(ctx, "", true, data)
+}
+
+func (mgr *Manager) create(ctx context.Context, userId string, temp bool, data map[string]interface{}) (*session.Session, error) {
+	sessId, err := session.NewId()
+	if err != nil {
+		return nil, err
+	}
+
+	sess := session.NewSession(sessId, userId, data)
+	sess.Temp = temp
+	mgr.lifetime.Start(sess, mgr.now())
+	encoded, err := session.MarshalData(sess.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode session data")
+	}
+
+	auth, _ := session.GetAuth(sess.Data)
+	_, err = mgr.db.ExecContext(ctx, mgr.dialect.rebind(
+		`INSERT INTO sessions (id, user_id, temp, provider, provider_sid, data, version, created_at, last_access_at, expires_at, deadline)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		sess.Id, sess.UserId, sess.Temp, auth.ProviderName, auth.ProviderSid, string(encoded), sess.Version,
+		toMillis(sess.CreatedAt), toMillis(sess.LastAccessAt),
+		nullMillis(sess.ExpiresAt), nullMillis(mgr.lifetime.Deadline(sess)),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store session")
+	}
+
+	return sess, nil
+}
+
+const selectColumns = `id, user_id, temp, data, version, created_at, last_access_at, expires_at`
+
+func (mgr *Manager) Get(ctx context.Context, sessId string) (*session.Session, error) {
+	row := mgr.db.QueryRowContext(ctx,
+		mgr.dialect.rebind(`SELECT `+selectColumns+` FROM sessions WHERE id = ?`),
+		sessId,
+	)
+	sess, err := scanSession(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("session not found by id %s", sessId)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to load session")
+	}
+
+	now := mgr.now()
+	if mgr.lifetime.Expired(sess, now) {
+		_ = mgr.Destroy(ctx, sessId)
+		return nil, errors.Wrapf(session.ErrExpired, "session %s", sessId)
+	}
+	if sess.IsTemp() {
+		return sess, nil
+	}
+
+	mgr.lifetime.Touch(sess, now)
+	_, err = mgr.db.ExecContext(ctx,
+		mgr.dialect.rebind(`UPDATE sessions SET last_access_at = ?, deadline = ? WHERE id = ?`),
+		toMillis(sess.LastAccessAt), nullMillis(mgr.lifetime.Deadline(sess)), sessId,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to touch session")
+	}
+
+	return sess, nil
+}
+
+func (mgr *Manager) Update(ctx context.Context, sess *session.Session) (*session.Session, error) {
+	now := mgr.now()
+	updated := sess.Clone()
+	updated.Version++
+	mgr.lifetime.Touch(updated, now)
+	encoded, err := session.MarshalData(updated.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode session data")
+	}
+
+	// only data and access time are changed by callers, the stored rest is returned
+	var (
+		userId    string
+		createdAt int64
+		expiresAt sql.NullInt64
+	)
+	err = mgr.db.QueryRowContext(ctx, mgr.dialect.rebind(
+		`UPDATE sessions SET data = ?, version = ?, last_access_at = ?, deadline = ?
+		WHERE id = ? AND version = ? AND (deadline IS NULL OR deadline > ?)
+		RETURNING user_id, created_at, expires_at`),
+		string(encoded), updated.Version, toMillis(updated.LastAccessAt), nullMillis(mgr.lifetime.Deadline(updated)),
+		sess.Id, sess.Version, toMillis(now),
+	).Scan(&userId, &createdAt, &expiresAt)
+	if err == nil {
+		updated.UserId = userId
+		updated.CreatedAt = fromMillis(createdAt)
+		updated.ExpiresAt = time.Time{}
+		if expiresAt.Valid {
+			updated.ExpiresAt = fromMillis(expiresAt.Int64)
+		}
+		return updated, nil
+	} else if err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "failed to update session")
+	}
+
+	// nothing is updated, either version is changed or session is gone or expired
+	var deadline sql.NullInt64
+	err = mgr.db.QueryRowContext(ctx,
+		mgr.dialect.rebind(`SELECT deadline FROM sessions WHERE id = ?`),
+		sess.Id,
+	).Scan(&deadline)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("session not found by id %s", sess.Id)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to load session")
+	}
+	if deadline.Valid && deadline.Int64 <= toMillis(now) {
+		return nil, errors.Wrapf(session.ErrExpired, "session %s", sess.Id)
+	}
+	return nil, session.ErrVersionConflict
+}
+
+func (mgr *Manager) TakeTemp(ctx context.Context, sessId string) (*session.Session, error) {
+	row := mgr.db.QueryRowContext(ctx,
+		mgr.dialect.rebind(`DELETE FROM sessions WHERE id = ? AND temp = ? RETURNING `+selectColumns),
+		sessId, true,
+	)
+	sess, err := scanSession(row)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("temporary session not found by id %s", sessId)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to take temporary session")
+	}
+
+	if mgr.lifetime.Expired(sess, mgr.now()) {
+		return nil, errors.Wrapf(session.ErrExpired, "session %s", sessId)
+	}
+	return sess, nil
+}
+
+func (mgr *Manager) Destroy(ctx context.Context, sessId string) error {
+	_, err := mgr.db.ExecContext(ctx, mgr.dialect.rebind(`DELETE FROM sessions WHERE id = ?`), sessId)
+	if err != nil {
+		return errors.Wrap(err, "failed to destroy session")
+	}
+	return nil
+}
+
+func (mgr *Manager) ListByUser(ctx context.Context, userId string) ([]*session.Session, error) {
+	rows, err := mgr.db.QueryContext(ctx, mgr.dialect.rebind(
+		`SELECT `+selectColumns+` FROM sessions
+		WHERE user_id = ? AND temp = ? AND (deadline IS NULL OR deadline > ?)
+		ORDER BY created_at`),
+		userId, false, toMillis(mgr.now()),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load sessions")
+	}
+	defer rows.Close()
+
+	list := make([]*session.Session, 0)
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load sessions")
+		}
+		list = append(list, sess)
+	}
+	return list, rows.Err()
+}
+
+func (mgr *Manager) DestroyByUser(ctx context.Context, userId string) (int, error) {
+	return mgr.destroyWhere(ctx, `user_id = ? AND temp = ?`, userId, false)
+}
+
+func (mgr *Manager) DestroyByProviderSession(ctx context.Context, providerName string, providerSid string) (int, error) {
+	return mgr.destroyWhere(ctx, `provider = ? AND provider_sid = ? AND provider_sid <> ''`, providerName, providerSid)
+}
+
+// destroyWhere deletes active sessions matching the condition, expired ones are left to Cleanup.
+func (mgr *Manager) destroyWhere(ctx context.Context, cond string, args ...interface{}) (int, error) {
+	args = append(args, toMillis(mgr.now()))
+	res, err := mgr.db.ExecContext(ctx,
+		mgr.dialect.rebind(`DELETE FROM sessions WHERE `+cond+` AND (deadline IS NULL OR deadline > ?)`),
+		args...,
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to destroy sessions")
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+// Cleanup deletes expired sessions and returns their count.
+func (mgr *Manager) Cleanup(ctx context.Context) (int64, error) {
+	res, err := mgr.db.ExecContext(ctx,
+		mgr.dialect.rebind(`DELETE FROM sessions WHERE deadline IS NOT NULL AND deadline <= ?`),
+		toMillis(mgr.now()),
+	)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to cleanup sessions")
+	}
+	return res.RowsAffected()
+}
+
+// Close stops background janitor and waits for it to exit. Database is not closed.
+func (mgr *Manager) Close() error {
+	mgr.janitor.Close()
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row scanner) (*session.Session, error) {
+	var (
+		id, userId, data                 string
+		temp                             bool
+		version, createdAt, lastAccessAt int64
+		expiresAt                        sql.NullInt64
+	)
+	err := row.Scan(&id, &userId, &temp, &data, &version, &createdAt, &lastAccessAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := session.UnmarshalData([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	sess := session.NewSession(id, userId, decoded)
+	sess.Temp = temp
+	sess.Version = version
+	sess.CreatedAt = fromMillis(createdAt)
+	sess.LastAccessAt = fromMillis(lastAccessAt)
+	if expiresAt.Valid {
+		sess.ExpiresAt = fromMillis(expiresAt.Int64)
+	}
+	return sess, nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func nullMillis(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: true}
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,96 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/sessiontest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	dialect, _ := NewDialect(SQLite)
+	err = Migrate(context.TODO(), db, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestManager_Behaviour(t *testing.T) {
+	sessiontest.Run(t, func(t *testing.T, now func() time.Time, lifetime session.Lifetime) session.Manager {
+		dialect, _ := NewDialect(SQLite)
+		return NewManager(newTestDB(t), dialect, session.WithClock(now), session.WithLifetime(lifetime))
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+	dialect, _ := NewDialect(SQLite)
+
+	// second run is a no-op
+	assert.NoError(t, Migrate(context.TODO(), db, dialect), "unexpected error")
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM session_schema_migrations`).Scan(&count)
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, 4, count, "migrations count is invalid")
+}
+
+func TestManager_Cleanup(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dialect, _ := NewDialect(SQLite)
+	mgr := NewManager(newTestDB(t), dialect, session.WithClock(func() time.Time { return now }), session.WithLifetime(session.Lifetime{
+		TempTTL:     time.Minute,
+		IdleTimeout: 30 * time.Minute,
+	}))
+
+	for i := 0; i < 3; i++ {
+		_, err := mgr.CreateTemp(context.TODO(), nil)
+		assert.NoError(t, err, "unexpected error")
+	}
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+
+	count, err := mgr.Cleanup(context.TODO())
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, int64(0), count, "nothing is expired yet")
+
+	now = now.Add(time.Minute)
+	count, err = mgr.Cleanup(context.TODO())
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, int64(3), count, "temp sessions are not deleted")
+
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "user session is deleted")
+	now = now.Add(29 * time.Minute)
+	count, err = mgr.Cleanup(context.TODO())
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, int64(0), count, "touched session is deleted")
+	now = now.Add(2 * time.Minute)
+	count, err = mgr.Cleanup(context.TODO())
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, int64(1), count, "idle session is not deleted")
+}
+
+func TestDialect_rebind(t *testing.T) {
+	postgres, _ := NewDialect(Postgres)
+	sqlite, _ := NewDialect(SQLite)
+	query := `UPDATE sessions SET data = ? WHERE id = ? AND user_id = ?`
+	assert.Equal(t, `UPDATE sessions SET data = $1 WHERE id = $2 AND user_id = $3`, postgres.rebind(query))
+	assert.Equal(t, query, sqlite.rebind(query))
+
+	_, err := NewDialect("oracle")
+	assert.Error(t, err)
+}
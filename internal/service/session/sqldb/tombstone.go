@@ -0,0 +1,66 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"time"
+)
+
+// Tombstones keep termination reasons of sessions evicted by limit.Manager in session_tombstones
+// table, so all replicas report them. The schema is created by Migrate.
+type Tombstones struct {
+	db      *sql.DB
+	dialect Dialect
+	now     func() time.Time
+}
+
+// NewTombstones creates tombstones, only session.WithClock of opts is used.
+func NewTombstones(db *sql.DB, dialect Dialect, opts ...session.Option) *Tombstones {
+	t := &Tombstones{
+		db:      db,
+		dialect: dialect,
+	}
+	t.now = session.ApplyOptions(t, opts).Now
+	return t
+}
+
+func (t *Tombstones) Put(ctx context.Context, sessId string, reason string, until time.Time) error {
+	now := t.now()
+	if !until.After(now) {
+		return nil
+	}
+
+	// delete expired tombstones on write, so no janitor is needed
+	_, err := t.db.ExecContext(ctx,
+		t.dialect.rebind(`DELETE FROM session_tombstones WHERE expires_at <= ?`),
+		toMillis(now),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to cleanup session tombstones")
+	}
+	_, err = t.db.ExecContext(ctx, t.dialect.rebind(
+		`INSERT INTO session_tombstones (id, reason, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET reason = excluded.reason, expires_at = excluded.expires_at`),
+		sessId, reason, toMillis(until),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to store session tombstone")
+	}
+	return nil
+}
+
+func (t *Tombstones) Get(ctx context.Context, sessId string) (string, bool, error) {
+	var reason string
+	err := t.db.QueryRowContext(ctx,
+		t.dialect.rebind(`SELECT reason FROM session_tombstones WHERE id = ? AND expires_at > ?`),
+		sessId, toMillis(t.now()),
+	).Scan(&reason)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, errors.Wrap(err, "failed to load session tombstone")
+	}
+	return reason, true, nil
+}
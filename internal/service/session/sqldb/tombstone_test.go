@@ -0,0 +1,39 @@
+package sqldb
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTombstones(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dialect, _ := NewDialect(SQLite)
+	db := newTestDB(t)
+	tombs := NewTombstones(db, dialect, session.WithClock(func() time.Time { return now }))
+
+	assert.NoError(t, tombs.Put(context.TODO(), "s1", session.ReasonSessionLimit, now.Add(time.Hour)))
+	assert.NoError(t, tombs.Put(context.TODO(), "s2", session.ReasonSessionLimit, now.Add(time.Minute)))
+	assert.NoError(t, tombs.Put(context.TODO(), "s1", session.ReasonRevoked, now.Add(time.Hour)), "tombstone is not replaced")
+
+	// another replica reads the same table
+	other := NewTombstones(db, dialect, session.WithClock(func() time.Time { return now }))
+	reason, ok, err := other.Get(context.TODO(), "s1")
+	if assert.NoError(t, err) {
+		assert.True(t, ok, "tombstone is not found")
+		assert.Equal(t, session.ReasonRevoked, reason)
+	}
+
+	now = now.Add(time.Minute)
+	_, ok, err = other.Get(context.TODO(), "s2")
+	if assert.NoError(t, err) {
+		assert.False(t, ok, "expired tombstone is found")
+	}
+	assert.NoError(t, tombs.Put(context.TODO(), "s3", session.ReasonSessionLimit, now.Add(time.Hour)))
+	var count int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM session_tombstones`).Scan(&count))
+	assert.Equal(t, 2, count, "expired tombstones are not deleted")
+}
@@ -0,0 +1,88 @@
+package stateless
+
+import (
+	"context"
+	goredis "github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// RevocationList keeps ids of destroyed sessions until they expire anyway.
+type RevocationList interface {
+	// Revoke adds the id to the list until the moment, zero time means forever.
+	// It reports false if the id has been revoked already.
+	Revoke(ctx context.Context, id string, until time.Time) (bool, error)
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// MemoryRevocationList is a RevocationList for single replica deployments.
+type MemoryRevocationList struct {
+	ids map[string]time.Time
+	mx  sync.Mutex
+	now func() time.Time
+}
+
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{
+		ids: make(map[string]time.Time),
+		now: time.Now,
+	}
+}
+
+func (l *MemoryRevocationList) Revoke(ctx context.Context, id string, until time.Time) (bool, error) {
+	now := l.now()
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	// evict expired ids on write, so the list doesn't need a janitor
+	for revokedId, revokedUntil := range l.ids {
+		if !revokedUntil.IsZero() && !now.Before(revokedUntil) {
+			delete(l.ids, revokedId)
+		}
+	}
+	if _, ok := l.ids[id]; ok {
+		return false, nil
+	}
+	l.ids[id] = until
+	return true, nil
+}
+
+func (l *MemoryRevocationList) IsRevoked(ctx context.Context, id string) (bool, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	until, ok := l.ids[id]
+	return ok && (until.IsZero() || l.now().Before(until)), nil
+}
+
+// RedisRevocationList is a RevocationList shared by replicas, keys are "{prefix}revoked:{id}".
+type RedisRevocationList struct {
+	rdb    goredis.UniversalClient
+	prefix string
+	now    func() time.Time
+}
+
+func NewRedisRevocationList(rdb goredis.UniversalClient, prefix string) *RedisRevocationList {
+	return &RedisRevocationList{
+		rdb:    rdb,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+func (l *RedisRevocationList) Revoke(ctx context.Context, id string, until time.Time) (bool, error) {
+	var ttl time.Duration
+	if !until.IsZero() {
+		ttl = until.Sub(l.now())
+		if ttl <= 0 {
+			return true, nil
+		}
+	}
+	return l.rdb.SetNX(ctx, l.prefix+"revoked:"+id, 1, ttl).Result()
+}
+
+func (l *RedisRevocationList) IsRevoked(ctx context.Context, id string) (bool, error) {
+	n, err := l.rdb.Exists(ctx, l.prefix+"revoked:"+id).Result()
+	return n > 0, err
+}
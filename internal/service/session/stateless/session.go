@@ -0,0 +1,208 @@
+// Package stateless keeps the whole session in an encrypted client cookie,
+// so no session store is needed.
+package stateless
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+	"myoidc/pkg/keyring"
+	"time"
+)
+
+// additionalData binds sealed sessions to this purpose, tokens sealed by the same
+// key ring for other needs are not accepted as sessions.
+var additionalData = []byte("session")
+
+// touchInterval limits how often the session is resealed to prolong idle timeout,
+// every reseal makes the handler rewrite the cookie.
+const touchInterval = time.Minute
+
+// Manager is a stateless implementation of session.Manager interface.
+//
+// Session id returned by the manager is the sealed session itself and must be sent
+// to the client as is, Get and Update return a new id when the session is resealed.
+// Destroy has effect only if a RevocationList is configured, otherwise a copy
+// of the cookie stays valid until the session expires.
+type Manager struct {
+	keys     *keyring.KeyRing
+	revoked  RevocationList
+	lifetime session.Lifetime
+	now      func() time.Time
+}
+
+// WithRevocationList enables server-side logout and single use of temporary sessions.
+func WithRevocationList(revoked RevocationList) session.Option {
+	return session.ManagerOption(func(mgr *Manager) {
+		mgr.revoked = revoked
+	})
+}
+
+// NewManager creates manager, session.WithCleanupInterval is ignored as nothing is stored.
+func NewManager(keys *keyring.KeyRing, opts ...session.Option) *Manager {
+	mgr := &Manager{
+		keys: keys,
+	}
+	o := session.ApplyOptions(mgr, opts)
+	mgr.lifetime, mgr.now = o.Lifetime, o.Now
+	return mgr
+}
+
+func (mgr *Manager) Create(ctx context.Context, userId string, data map[string]interface{}) (*session.Session, error) {
+	return mgr.create(userId, false, data)
+}
+
+func (mgr *Manager) CreateTemp(ctx context.Context, data map[string]interface{}) (*session.Session, error) {
+	return mgr.create("", true, data)
+}
+
+func (mgr *Manager) create(userId string, temp bool, data map[string]interface{}) (*session.Session, error) {
+	sessId, err := session.NewId()
+	if err != nil {
+		return nil, err
+	}
+
+	sess := session.NewSession(sessId, userId, data)
+	sess.Temp = temp
+	mgr.lifetime.Start(sess, mgr.now())
+	return mgr.seal(sess)
+}
+
+func (mgr *Manager) Get(ctx context.Context, sessId string) (*session.Session, error) {
+	now := mgr.now()
+	sess, jti, err := mgr.open(ctx, sessId, now)
+	if err != nil {
+		return nil, err
+	}
+	if sess.IsTemp() || mgr.lifetime.IdleTimeout <= 0 || now.Sub(sess.LastAccessAt) < touchInterval {
+		return sess, nil
+	}
+
+	sess.Id = jti
+	mgr.lifetime.Touch(sess, now)
+	return mgr.seal(sess)
+}
+
+// Update reseals the session with incremented version, the version must match the sealed one.
+// The state is kept by the client, so updates of other copies of the cookie can't be detected
+// and the last written cookie wins.
+func (mgr *Manager) Update(ctx context.Context, sess *session.Session) (*session.Session, error) {
+	now := mgr.now()
+	stored, jti, err := mgr.open(ctx, sess.Id, now)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Version != sess.Version {
+		return nil, session.ErrVersionConflict
+	}
+
+	updated := sess.Clone()
+	updated.Id = jti
+	updated.UserId = stored.UserId
+	updated.CreatedAt = stored.CreatedAt
+	updated.ExpiresAt = stored.ExpiresAt
+	updated.Version = stored.Version + 1
+	mgr.lifetime.Touch(updated, now)
+	return mgr.seal(updated)
+}
+
+func (mgr *Manager) TakeTemp(ctx context.Context, sessId string) (*session.Session, error) {
+	now := mgr.now()
+	sess, jti, err := mgr.open(ctx, sessId, now)
+	if err != nil {
+		return nil, err
+	}
+	if !sess.IsTemp() {
+		return nil, errors.Errorf("temporary session not found by id %s", jti)
+	}
+	if mgr.revoked != nil {
+		first, err := mgr.revoked.Revoke(ctx, jti, sess.ExpiresAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to revoke temporary session")
+		}
+		if !first {
+			return nil, errors.Errorf("temporary session %s is already taken", jti)
+		}
+	}
+	return sess, nil
+}
+
+// Destroy adds the session to the revocation list, invalid sessions are ignored.
+func (mgr *Manager) Destroy(ctx context.Context, sessId string) error {
+	if mgr.revoked == nil {
+		return nil
+	}
+	sess, jti, err := mgr.unseal(sessId)
+	if err != nil {
+		return nil
+	}
+	_, err = mgr.revoked.Revoke(ctx, jti, mgr.lifetime.Deadline(sess))
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke session")
+	}
+	return nil
+}
+
+// ListByUser is not supported, sessions are known to the clients only.
+func (mgr *Manager) ListByUser(ctx context.Context, userId string) ([]*session.Session, error) {
+	return nil, session.ErrNotSupported
+}
+
+// DestroyByUser is not supported, sessions are known to the clients only.
+func (mgr *Manager) DestroyByUser(ctx context.Context, userId string) (int, error) {
+	return 0, session.ErrNotSupported
+}
+
+// DestroyByProviderSession is not supported, sessions are known to the clients only.
+func (mgr *Manager) DestroyByProviderSession(ctx context.Context, providerName string, providerSid string) (int, error) {
+	return 0, session.ErrNotSupported
+}
+
+func (mgr *Manager) seal(sess *session.Session) (*session.Session, error) {
+	b, err := session.Marshal(sess)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode session")
+	}
+	token, err := mgr.keys.Seal(b, additionalData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to seal session")
+	}
+	sess.Id = token
+	return sess, nil
+}
+
+// open unseals the session and checks it is neither expired nor revoked.
+func (mgr *Manager) open(ctx context.Context, sessId string, now time.Time) (*session.Session, string, error) {
+	sess, jti, err := mgr.unseal(sessId)
+	if err != nil {
+		return nil, "", err
+	}
+	if mgr.lifetime.Expired(sess, now) {
+		return nil, "", errors.Wrapf(session.ErrExpired, "session %s", jti)
+	}
+	if mgr.revoked != nil {
+		revoked, err := mgr.revoked.IsRevoked(ctx, jti)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "failed to check session revocation")
+		}
+		if revoked {
+			return nil, "", errors.Errorf("session %s is revoked", jti)
+		}
+	}
+	return sess, jti, nil
+}
+
+// unseal decrypts the session, session id is replaced by the sealed value and jti is returned.
+func (mgr *Manager) unseal(sessId string) (*session.Session, string, error) {
+	b, err := mgr.keys.Open(sessId, additionalData)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "session not found")
+	}
+	sess, err := session.Unmarshal(b)
+	if err != nil {
+		return nil, "", err
+	}
+	jti := sess.Id
+	sess.Id = sessId
+	return sess, jti, nil
+}
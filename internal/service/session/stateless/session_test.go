@@ -0,0 +1,71 @@
+package stateless
+
+import (
+	"bytes"
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/sessiontest"
+	"myoidc/pkg/keyring"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newKeyRing(t *testing.T, active string) *keyring.KeyRing {
+	kr, err := keyring.New(active,
+		keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)},
+		keyring.Key{Id: "k2", Secret: bytes.Repeat([]byte{2}, 32)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestManager_Behaviour(t *testing.T) {
+	sessiontest.Run(t, func(t *testing.T, now func() time.Time, lifetime session.Lifetime) session.Manager {
+		revoked := NewMemoryRevocationList()
+		revoked.now = now
+		return NewManager(newKeyRing(t, "k1"), session.WithClock(now), session.WithLifetime(lifetime), WithRevocationList(revoked))
+	}, "Conflict", "Modify", "ByUser")
+}
+
+func TestManager_BehaviourRedis(t *testing.T) {
+	sessiontest.Run(t, func(t *testing.T, now func() time.Time, lifetime session.Lifetime) session.Manager {
+		srv := miniredis.RunT(t)
+		revoked := NewRedisRevocationList(goredis.NewClient(&goredis.Options{Addr: srv.Addr()}), "myoidc:")
+		revoked.now = now
+		return NewManager(newKeyRing(t, "k1"), session.WithClock(now), session.WithLifetime(lifetime), WithRevocationList(revoked))
+	}, "Conflict", "Modify", "ByUser")
+}
+
+func TestManager_KeyRotation(t *testing.T) {
+	old := NewManager(newKeyRing(t, "k1"))
+	sess, err := old.Create(context.TODO(), "123", session.NewAuthData(session.Auth{ProviderName: "myoidc", AccessToken: "ACCESS_TOKEN"}))
+	assert.NoError(t, err, "unexpected error")
+
+	rotated := NewManager(newKeyRing(t, "k2"))
+	res, err := rotated.Get(context.TODO(), sess.Id)
+	if assert.NoError(t, err, "session sealed by retired key") {
+		auth, _ := session.GetAuth(res.Data)
+		assert.Equal(t, "ACCESS_TOKEN", auth.AccessToken)
+	}
+
+	other, err := keyring.New("k1", keyring.Key{Id: "k1", Secret: bytes.Repeat([]byte{3}, 32)})
+	assert.NoError(t, err, "unexpected error")
+	_, err = NewManager(other).Get(context.TODO(), sess.Id)
+	assert.Error(t, err, "session sealed by foreign key")
+}
+
+func TestManager_WithoutRevocationList(t *testing.T) {
+	mgr := NewManager(newKeyRing(t, "k1"))
+	sess, err := mgr.Create(context.TODO(), "123", nil)
+	assert.NoError(t, err, "unexpected error")
+
+	assert.NoError(t, mgr.Destroy(context.TODO(), sess.Id), "unexpected error")
+	_, err = mgr.Get(context.TODO(), sess.Id)
+	assert.NoError(t, err, "session can't be revoked without revocation list")
+}
@@ -0,0 +1,96 @@
+package sessions
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/internal/usecase"
+	"myoidc/pkg/errors"
+	"time"
+)
+
+// SessionInfo is a session metadata shown to administrators.
+// Ref identifies the session without disclosing its id, which is a bearer credential.
+type SessionInfo struct {
+	Ref          string    `json:"ref"`
+	Provider     string    `json:"provider"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastAccessAt time.Time `json:"lastAccessAt"`
+	ExpiresAt    time.Time `json:"expiresAt,omitempty"`
+	IP           string    `json:"ip,omitempty"`
+	UserAgent    string    `json:"userAgent,omitempty"`
+}
+
+type UseCase struct {
+	sm session.Manager
+}
+
+func NewUseCase(sm session.Manager) *UseCase {
+	return &UseCase{
+		sm: sm,
+	}
+}
+
+func (uc UseCase) List(ctx context.Context, userId string) ([]SessionInfo, error) {
+	list, err := uc.sm.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, wrapError(errors.Wrapf(err, "failed to list sessions of user %s", userId))
+	}
+
+	infos := make([]SessionInfo, 0, len(list))
+	for _, sess := range list {
+		auth, _ := session.GetAuth(sess.Data)
+		infos = append(infos, SessionInfo{
+			Ref:          session.Ref(sess.Id),
+			Provider:     auth.ProviderName,
+			CreatedAt:    sess.CreatedAt,
+			LastAccessAt: sess.LastAccessAt,
+			ExpiresAt:    sess.ExpiresAt,
+			IP:           auth.Client.IP,
+			UserAgent:    auth.Client.UserAgent,
+		})
+	}
+	return infos, nil
+}
+
+// Revoke destroys the user session found by ref.
+func (uc UseCase) Revoke(ctx context.Context, userId string, sessRef string) error {
+	list, err := uc.sm.ListByUser(ctx, userId)
+	if err != nil {
+		return wrapError(errors.Wrapf(err, "failed to list sessions of user %s", userId))
+	}
+	for _, sess := range list {
+		if session.Ref(sess.Id) == sessRef {
+			err = uc.sm.Destroy(session.WithDestroyReason(ctx, session.ReasonRevoked), sess.Id)
+			if err != nil {
+				return errors.Wrapf(err, "failed to revoke session %s", sessRef)
+			}
+			return nil
+		}
+	}
+	err = errors.Errorf("session %s of user %s not found", sessRef, userId)
+	return errors.WithCode(err, usecase.ErrCodeEntityNotFound)
+}
+
+func (uc UseCase) RevokeAll(ctx context.Context, userId string) (int, error) {
+	count, err := uc.sm.DestroyByUser(session.WithDestroyReason(ctx, session.ReasonRevoked), userId)
+	if err != nil {
+		return 0, wrapError(errors.Wrapf(err, "failed to revoke sessions of user %s", userId))
+	}
+	return count, nil
+}
+
+func (uc UseCase) RevokeByProviderSession(ctx context.Context, providerName string, providerSid string) (int, error) {
+	count, err := uc.sm.DestroyByProviderSession(session.WithDestroyReason(ctx, session.ReasonRevoked), providerName, providerSid)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to revoke sessions of provider %s session %s", providerName, providerSid)
+		return 0, wrapError(err)
+	}
+	return count, nil
+}
+
+func wrapError(err error) error {
+	if errors.HasCause(err, session.ErrNotSupported) {
+		return errors.WithCode(err, usecase.ErrCodeNotSupported)
+	}
+	return err
+}
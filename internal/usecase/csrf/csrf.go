@@ -0,0 +1,74 @@
+package csrf
+
+import (
+	"context"
+	"crypto/subtle"
+	"myoidc/internal/service/session"
+	"myoidc/internal/usecase"
+	"myoidc/pkg/errors"
+)
+
+// dataKey holds synchronizer token in session data.
+const dataKey = "csrfToken"
+
+// UseCase keeps synchronizer tokens in session data, so any session store can hold them.
+type UseCase struct {
+	sm session.Manager
+}
+
+func NewUseCase(sm session.Manager) *UseCase {
+	return &UseCase{
+		sm: sm,
+	}
+}
+
+// Token returns the token of the session, it is generated on first use. The session is
+// returned as its id may change when the token is stored, e.g. by stateless manager.
+func (uc UseCase) Token(ctx context.Context, sessId string) (string, *session.Session, error) {
+	sess, err := uc.sm.Get(ctx, sessId)
+	if err != nil {
+		err = errors.Wrap(err, "session not found")
+		err = errors.WithField(err, "sessId", sessId)
+		return "", nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
+	}
+	if token := session.GetString(sess.Data, dataKey, ""); token != "" {
+		return token, sess, nil
+	}
+
+	token, err := session.NewId()
+	if err != nil {
+		return "", nil, err
+	}
+	sess, err = session.Modify(ctx, uc.sm, sessId, func(sess *session.Session) error {
+		if existing := session.GetString(sess.Data, dataKey, ""); existing != "" {
+			token = existing // issued by a concurrent request
+			return nil
+		}
+		sess.Data[dataKey] = token
+		return nil
+	})
+	if err != nil {
+		err = errors.Wrap(err, "failed to store csrf token")
+		return "", nil, errors.WithField(err, "sessId", sessId)
+	}
+	return token, sess, nil
+}
+
+// Verify checks the token sent with the request against the session one.
+func (uc UseCase) Verify(ctx context.Context, sessId string, token string) error {
+	if sessId == "" || token == "" {
+		return errors.WithCode(errors.Error("csrf token or session is missing"), usecase.ErrCodeForbidden)
+	}
+	sess, err := uc.sm.Get(ctx, sessId)
+	if err != nil {
+		err = errors.Wrap(err, "session not found")
+		return errors.WithCode(err, usecase.ErrCodeForbidden)
+	}
+	expected := session.GetString(sess.Data, dataKey, "")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		err = errors.Error("csrf token doesn't match")
+		err = errors.WithField(err, "sessId", sessId)
+		return errors.WithCode(err, usecase.ErrCodeForbidden)
+	}
+	return nil
+}
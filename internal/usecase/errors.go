@@ -3,7 +3,12 @@ package usecase
 const (
 	ErrCodeInvalidCredentials = 30400
 	ErrCodeUserUnauthorized   = 30401
+	ErrCodeForbidden          = 30403
 	ErrCodeEntityNotFound     = 30404
 	ErrCodeInternal           = 30500
 	ErrCodeSessionInterrupt   = 30501
+	ErrCodeNotSupported       = 30502
+	ErrCodeSessionTerminated  = 30503
+	// ErrCodeLoginExpired is returned when login transaction is missing, expired or already completed.
+	ErrCodeLoginExpired = 30504
 )
@@ -3,15 +3,21 @@ package callback
 import (
 	"context"
 	"myoidc/internal/domain"
+	"myoidc/internal/service/oidc/claims"
 	oidccli "myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/transaction"
 	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/event"
 	"myoidc/internal/usecase"
 	"myoidc/pkg/errors"
+	"time"
 )
 
 type UseCase struct {
 	reg oidccli.ClientRegistry
 	sm  session.Manager
+	txs transaction.Store
+	obs event.Observer
 }
 
 type Result struct {
@@ -20,49 +26,82 @@ type Result struct {
 	RedirectURL string
 }
 
-func NewUseCase(reg oidccli.ClientRegistry, sm session.Manager) *UseCase {
+// failureReasons name LoginFailed events by error code.
+var failureReasons = map[int]string{
+	usecase.ErrCodeEntityNotFound:   "unknown_provider",
+	usecase.ErrCodeLoginExpired:     "login_expired",
+	usecase.ErrCodeUserUnauthorized: "unauthorized",
+	usecase.ErrCodeForbidden:        session.ReasonSessionLimit,
+}
+
+func NewUseCase(reg oidccli.ClientRegistry, sm session.Manager, txs transaction.Store, obs event.Observer) *UseCase {
 	return &UseCase{
 		reg: reg,
 		sm:  sm,
+		txs: txs,
+		obs: obs,
 	}
 }
 
-func (uc UseCase) Execute(ctx context.Context, providerName string, code string, state string, tempSessId string) (*Result, error) {
+func (uc UseCase) Execute(ctx context.Context, providerName string, code string, state string, binding string, clientInfo session.ClientInfo) (*Result, error) {
+	res, err := uc.execute(ctx, providerName, code, state, binding, clientInfo)
+	if err != nil {
+		reason, ok := failureReasons[errors.GetErrCode(err)]
+		if !ok {
+			reason = "error"
+		}
+		uc.obs.OnEvent(ctx, event.Event{
+			Type:         event.LoginFailed,
+			ProviderName: providerName,
+			Reason:       reason,
+		})
+		return nil, err
+	}
+	uc.obs.OnEvent(ctx, event.Event{
+		Type:         event.LoginCompleted,
+		SessRef:      session.Ref(res.Session.Id),
+		UserId:       res.Session.UserId,
+		ProviderName: providerName,
+	})
+	return res, nil
+}
+
+func (uc UseCase) execute(ctx context.Context, providerName string, code string, state string, binding string, clientInfo session.ClientInfo) (*Result, error) {
 	client, err := uc.reg.GetClient(ctx, providerName)
 	if err != nil {
 		err = errors.Wrapf(err, "client not found for provider %s", providerName)
 		return nil, errors.WithCode(err, usecase.ErrCodeEntityNotFound)
 	}
 
-	sess, err := uc.sm.Get(ctx, tempSessId)
-	if err != nil {
-		err = errors.Wrap(err, "temporary session not found")
-		err = errors.WithField(err, "tempSessId", tempSessId)
+	tx, err := uc.txs.Complete(ctx, state, binding)
+	if errors.HasCause(err, transaction.ErrStateMismatch) {
+		err = errors.Wrap(err, "invalid login state")
+		return nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
+	} else if err != nil {
+		err = errors.Wrap(err, "login transaction not found")
+		return nil, errors.WithCode(err, usecase.ErrCodeLoginExpired)
+	}
+	if tx.ProviderName != providerName {
+		err = errors.Errorf("login transaction is started for provider %s", tx.ProviderName)
 		return nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
 	}
-	defer uc.sm.Destroy(ctx, tempSessId)
 
 	var params = make([]oidccli.UrlParam, 0)
-	if security, ok := client.(oidccli.SecurityClient); ok {
-		if security.SupportsState(ctx) {
-			sessState := session.GetString(sess.Data, "oidcState", "")
-			if state != sessState {
-				err = errors.Error("state doesn't match")
-				return nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
-			}
-		}
-		if security.SupportsPKCE(ctx) {
-			codeVerifier := session.GetString(sess.Data, "oidcCodeVerifier", "")
-			params = append(params, oidccli.NewUrlParam("code_verifier", codeVerifier))
-		}
+	if tx.CodeVerifier != "" {
+		params = append(params, oidccli.NewUrlParam("code_verifier", tx.CodeVerifier))
 	}
-	token, err := client.FetchTokenByCode(ctx, code, tempSessId, params...)
+	token, err := client.FetchTokenByCode(ctx, code, params...)
 	if err != nil {
 		err = errors.Wrap(err, "code is invalid")
 		err = errors.WithField(err, "oidcCode", code)
 		return nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
 	}
 
+	if tx.Nonce != "" && token.ID != "" && idTokenClaim(token.ID, "nonce") != tx.Nonce {
+		err = errors.Error("id token nonce doesn't match")
+		return nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
+	}
+
 	// fetch user from external system
 	user, err := client.FetchUserByToken(ctx, token)
 	if err != nil {
@@ -72,16 +111,49 @@ func (uc UseCase) Execute(ctx context.Context, providerName string, code string,
 	}
 
 	// create persistent session instead of temp
-	newSess, err := uc.sm.Create(ctx, user.Id, session.NewAuthData(providerName, token.Access, token.Refresh))
-	if err != nil {
-		err = errors.Wrap(err, "failed to create temp session")
+	auth := session.Auth{
+		ProviderName: providerName,
+		AccessToken:  token.Access,
+		IDToken:      token.ID,
+		ProviderSid:  idTokenClaim(token.ID, "sid"),
+		Client:       clientInfo,
+		Expiry:       token.Expiry,
+		// reused by userinfo use case until the user is checked again
+		User:          user,
+		UserCheckedAt: time.Now(),
+	}
+	if token.Refresh != nil {
+		auth.RefreshToken = *token.Refresh
+	}
+	newSess, err := uc.sm.Create(ctx, user.Id, session.NewAuthData(auth))
+	if errors.HasCause(err, session.ErrLimitExceeded) {
+		err = errors.Wrap(err, "session limit rejects login")
+		return nil, errors.WithCode(err, usecase.ErrCodeForbidden)
+	} else if err != nil {
+		err = errors.Wrap(err, "failed to create session")
 		return nil, err
 	}
 
-	var redirectUrl = session.GetString(sess.Data, "backUrl", "/")
+	var redirectUrl = tx.BackUrl
+	if redirectUrl == "" {
+		redirectUrl = "/"
+	}
 	return &Result{
 		Session:     newSess,
 		ActiveUser:  user,
 		RedirectURL: redirectUrl,
 	}, nil
 }
+
+// idTokenClaim returns string claim of id token, e.g. "sid" used by provider initiated logout.
+func idTokenClaim(idToken string, name string) string {
+	if idToken == "" {
+		return ""
+	}
+	m, err := claims.DecodeJWT(idToken)
+	if err != nil {
+		return ""
+	}
+	value, _ := m[name].(string)
+	return value
+}
@@ -3,7 +3,9 @@ package login
 import (
 	"context"
 	oidccli "myoidc/internal/service/oidc/client"
+	"myoidc/internal/service/oidc/transaction"
 	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/event"
 	"myoidc/internal/usecase"
 	"myoidc/pkg/errors"
 	"net/url"
@@ -11,36 +13,46 @@ import (
 
 type UseCase struct {
 	reg oidccli.ClientRegistry
-	sm  session.Manager
+	txs transaction.Store
+	obs event.Observer
+}
+
+type Result struct {
+	AuthURL *url.URL
+	// Binding must be set to the browser cookie and passed to the callback.
+	Binding string
 }
 
 func NewUseCase(
 	reg oidccli.ClientRegistry,
-	sm session.Manager,
+	txs transaction.Store,
+	obs event.Observer,
 ) *UseCase {
 	return &UseCase{
 		reg: reg,
-		sm:  sm,
+		txs: txs,
+		obs: obs,
 	}
 }
 
-func (uc UseCase) Execute(ctx context.Context, providerName string, scopes []string, tempSessionData map[string]interface{}) (*url.URL, error) {
+func (uc UseCase) Execute(ctx context.Context, providerName string, scopes []string, tx session.LoginTransaction) (*Result, error) {
 	client, err := uc.reg.GetClient(ctx, providerName)
 	if err != nil {
 		err = errors.Wrapf(err, "client not found for provider %s", providerName)
 		return nil, errors.WithCode(err, usecase.ErrCodeEntityNotFound)
 	}
 
-	state := ""
+	tx.ProviderName = providerName
 	params := make([]oidccli.UrlParam, 0)
 	if security, ok := client.(oidccli.SecurityClient); ok {
 		if security.SupportsState(ctx) {
-			state = security.GetPKCEGenerator(ctx).State()
-			tempSessionData["oidcState"] = state
+			tx.State = security.GetPKCEGenerator(ctx).State()
+			tx.Nonce = security.GetPKCEGenerator(ctx).State()
+			params = append(params, oidccli.NewUrlParam("nonce", tx.Nonce))
 		}
 		if security.SupportsPKCE(ctx) {
 			codeChallenge, codeChallengeMethod, codeVerifier := security.GetPKCEGenerator(ctx).CodeChallengeVerifier()
-			tempSessionData["oidcCodeVerifier"] = codeVerifier
+			tx.CodeVerifier = codeVerifier
 			params = append(
 				params,
 				oidccli.NewUrlParam("code_challenge", codeChallenge),
@@ -49,17 +61,24 @@ func (uc UseCase) Execute(ctx context.Context, providerName string, scopes []str
 		}
 	}
 
-	sess, err := uc.sm.CreateTemp(ctx, tempSessionData)
+	state, binding, err := uc.txs.Begin(ctx, tx)
 	if err != nil {
-		err = errors.Wrap(err, "failed to create temp session")
+		err = errors.Wrap(err, "failed to begin login transaction")
 		return nil, err
 	}
 
-	authURL, err := client.BuildAuthURL(ctx, state, scopes, sess.Id, params...)
+	authURL, err := client.BuildAuthURL(ctx, state, scopes, params...)
 	if err != nil {
-		err = errors.Wrapf(err, "failed to build auth url for temp session %s", sess.Id)
+		err = errors.Wrapf(err, "failed to build auth url for provider %s", providerName)
 		return nil, err
 	}
 
-	return authURL, nil
+	uc.obs.OnEvent(ctx, event.Event{
+		Type:         event.LoginStarted,
+		ProviderName: providerName,
+	})
+	return &Result{
+		AuthURL: authURL,
+		Binding: binding,
+	}, nil
 }
@@ -0,0 +1,30 @@
+package logout
+
+import (
+	"context"
+	"myoidc/internal/service/session"
+	"myoidc/pkg/errors"
+)
+
+type UseCase struct {
+	sm session.Manager
+}
+
+func NewUseCase(sm session.Manager) *UseCase {
+	return &UseCase{
+		sm: sm,
+	}
+}
+
+// Execute destroys user session, stateless sessions are revoked if revocation list is configured.
+func (uc UseCase) Execute(ctx context.Context, sessId string) error {
+	if sessId == "" {
+		return nil
+	}
+	err := uc.sm.Destroy(session.WithDestroyReason(ctx, session.ReasonLogout), sessId)
+	if err != nil {
+		err = errors.Wrap(err, "failed to destroy session")
+		return errors.WithField(err, "sessId", sessId)
+	}
+	return nil
+}
@@ -5,58 +5,200 @@ import (
 	"myoidc/internal/domain"
 	oidccli "myoidc/internal/service/oidc/client"
 	"myoidc/internal/service/session"
+	"myoidc/internal/service/session/event"
 	"myoidc/internal/usecase"
 	"myoidc/pkg/errors"
+	"time"
 )
 
+// expiryLeeway refreshes access tokens shortly before they expire.
+const expiryLeeway = 10 * time.Second
+
 type UseCase struct {
-	reg oidccli.ClientRegistry
-	sm  session.Manager
+	reg     oidccli.ClientRegistry
+	sm      session.Manager
+	obs     event.Observer
+	userTTL time.Duration
+	now     func() time.Time
+}
+
+type Result struct {
+	// Session may have a new id when the manager reissues it on access, e.g. stateless one.
+	Session *session.Session
+	User    *domain.User
 }
 
+// NewUseCase creates the use case, the user fetched from the provider is kept in the session
+// and reused for userTTL while the access token is not expired. Zero userTTL fetches the user
+// on every call.
 func NewUseCase(
 	reg oidccli.ClientRegistry,
 	sm session.Manager,
+	obs event.Observer,
+	userTTL time.Duration,
 ) *UseCase {
 	return &UseCase{
-		reg: reg,
-		sm:  sm,
+		reg:     reg,
+		sm:      sm,
+		obs:     obs,
+		userTTL: userTTL,
+		now:     time.Now,
 	}
 }
 
-func (uc UseCase) Execute(ctx context.Context, sessId string) (*domain.User, error) {
+func (uc UseCase) Execute(ctx context.Context, sessId string) (*Result, error) {
 	sess, err := uc.sm.Get(ctx, sessId)
-	if err != nil {
+	if errors.Is[*session.TerminatedError](err) {
+		err = errors.Wrap(err, "session is terminated")
+		err = errors.WithField(err, "sessId", sessId)
+		return nil, errors.WithCode(err, usecase.ErrCodeSessionTerminated)
+	} else if err != nil {
 		err = errors.Wrap(err, "session not found")
 		err = errors.WithField(err, "sessId", sessId)
 		return nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
 	}
 
-	auth := session.AuthData(sess.Data)
-	if !auth.IsValid() {
+	auth, ok := session.GetAuth(sess.Data)
+	if !ok || !auth.IsValid() {
 		defer uc.sm.Destroy(ctx, sessId) // destroy invalid session
 		err = errors.Errorf("session authentication data not found or invalid: %+v", sess.Data)
 		err = errors.WithField(err, "sessId", sessId)
 		return nil, errors.WithCode(err, usecase.ErrCodeSessionInterrupt)
 	}
 
-	client, err := uc.reg.GetClient(ctx, auth.GetProviderName())
+	now := uc.now()
+	if uc.isUserFresh(auth, now) {
+		user := *auth.User
+		return &Result{
+			Session: sess,
+			User:    &user,
+		}, nil
+	}
+
+	client, err := uc.reg.GetClient(ctx, auth.ProviderName)
 	if err != nil {
 		defer uc.sm.Destroy(ctx, sessId) // destroy invalid session
-		err = errors.Wrapf(err, "client not found for provider %s", auth.GetProviderName())
+		err = errors.Wrapf(err, "client not found for provider %s", auth.ProviderName)
 		err = errors.WithField(err, "sessId", sessId)
 		return nil, errors.WithCode(err, usecase.ErrCodeEntityNotFound)
 	}
 
-	user, err := client.FetchUserByToken(ctx, &oidccli.Token{
-		Access:  auth.GetAccessToken(),
-		Refresh: auth.GetRefreshToken(),
-	})
+	token := newToken(auth)
+	var user *domain.User
+	if auth.IsExpired(now, expiryLeeway) && token.Refresh != nil {
+		err = oidccli.ErrTokenRejected // refresh without asking the provider to reject it first
+	} else {
+		user, err = client.FetchUserByToken(ctx, token)
+	}
+	if errors.HasCause(err, oidccli.ErrTokenRejected) && token.Refresh != nil {
+		sess, token, err = uc.refresh(ctx, client, sess.Id, token)
+		if err != nil {
+			err = errors.WithField(err, "sessId", sessId)
+			return nil, errors.WithCode(err, usecase.ErrCodeUserUnauthorized)
+		}
+		user, err = client.FetchUserByToken(ctx, token)
+	}
 	if err != nil {
 		err = errors.Wrap(err, "failed to fetch user by oidc token")
 		err = errors.WithField(err, "sessId", sessId)
 		return nil, err
 	}
 
-	return user, nil
+	if uc.userTTL > 0 {
+		sess, err = uc.storeUser(ctx, sess.Id, user, now)
+		if err != nil {
+			err = errors.WithField(err, "sessId", sessId)
+			return nil, err
+		}
+	}
+	return &Result{
+		Session: sess,
+		User:    user,
+	}, nil
+}
+
+func (uc UseCase) isUserFresh(auth session.Auth, now time.Time) bool {
+	return uc.userTTL > 0 && auth.User != nil && now.Sub(auth.UserCheckedAt) < uc.userTTL &&
+		!auth.IsExpired(now, expiryLeeway)
+}
+
+// refresh replaces rejected tokens in the session with ones issued by the refresh token.
+// The provider is called within session.Modify, so a request losing the race to a concurrent
+// refresh reuses tokens stored by the winner instead of spending the refresh token again.
+func (uc UseCase) refresh(ctx context.Context, client oidccli.Client, sessId string, rejected *oidccli.Token) (*session.Session, *oidccli.Token, error) {
+	var issued, token *oidccli.Token
+	sess, err := session.Modify(ctx, uc.sm, sessId, func(sess *session.Session) error {
+		auth, ok := session.GetAuth(sess.Data)
+		if !ok {
+			return errors.Error("session authentication data not found")
+		}
+		if auth.AccessToken != rejected.Access {
+			token = newToken(auth) // refreshed by a concurrent request
+			return nil
+		}
+		if issued == nil {
+			refreshed, err := client.RefreshToken(ctx, rejected)
+			if err != nil {
+				return errors.Wrap(err, "failed to refresh oidc token")
+			}
+			// providers may keep the refresh token and skip the id token on refresh
+			if refreshed.Refresh == nil {
+				refreshed.Refresh = rejected.Refresh
+			}
+			if refreshed.ID == "" {
+				refreshed.ID = rejected.ID
+			}
+			issued = refreshed
+		}
+		auth.AccessToken = issued.Access
+		auth.RefreshToken = *issued.Refresh
+		auth.IDToken = issued.ID
+		auth.Expiry = issued.Expiry
+		session.SetAuth(sess.Data, auth)
+		token = issued
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to store refreshed oidc token")
+	}
+	if issued != nil && token == issued {
+		auth, _ := session.GetAuth(sess.Data)
+		uc.obs.OnEvent(ctx, event.Event{
+			Type:         event.Refreshed,
+			SessRef:      session.Ref(sess.Id),
+			UserId:       sess.UserId,
+			ProviderName: auth.ProviderName,
+		})
+	}
+	return sess, token, nil
+}
+
+// storeUser keeps the user in the session, so it is not fetched again until userTTL passes.
+func (uc UseCase) storeUser(ctx context.Context, sessId string, user *domain.User, now time.Time) (*session.Session, error) {
+	sess, err := session.Modify(ctx, uc.sm, sessId, func(sess *session.Session) error {
+		auth, ok := session.GetAuth(sess.Data)
+		if !ok {
+			return errors.Error("session authentication data not found")
+		}
+		auth.User = user
+		auth.UserCheckedAt = now
+		session.SetAuth(sess.Data, auth)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store user in session")
+	}
+	return sess, nil
+}
+
+func newToken(auth session.Auth) *oidccli.Token {
+	token := &oidccli.Token{
+		Access: auth.AccessToken,
+		ID:     auth.IDToken,
+		Expiry: auth.Expiry,
+	}
+	if auth.RefreshToken != "" {
+		token.Refresh = &auth.RefreshToken
+	}
+	return token
 }
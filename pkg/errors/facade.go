@@ -84,6 +84,21 @@ func Is[T error](err error) bool {
 	return false
 }
 
+// HasCause reports whether target is err itself or any error in its cause chain.
+func HasCause(err error, target error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		e, ok := err.(Causer)
+		if !ok {
+			return false
+		}
+		err = e.Cause()
+	}
+	return false
+}
+
 func As[T error](err error, dist *T) bool {
 	if dist == nil {
 		return false
@@ -0,0 +1,123 @@
+package httpclient
+
+import (
+	"myoidc/pkg/errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+type CircuitBreakerConfig struct {
+	Disabled bool
+	// FailureThreshold is a number of consecutive failures opening the circuit.
+	FailureThreshold int
+	// OpenTimeout is a time the circuit stays open before a trial request is let through.
+	OpenTimeout time.Duration
+}
+
+// ErrCircuitOpen is returned without calling the remote host while the circuit is open.
+var ErrCircuitOpen = errors.Error("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// CircuitBreakerTransport fails fast when remote host keeps failing.
+// Network errors and 5xx responses are counted as failures.
+type CircuitBreakerTransport struct {
+	next        http.RoundTripper
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mx       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewCircuitBreakerTransport(next http.RoundTripper, cfg CircuitBreakerConfig) *CircuitBreakerTransport {
+	t := &CircuitBreakerTransport{
+		next:        next,
+		threshold:   cfg.FailureThreshold,
+		openTimeout: cfg.OpenTimeout,
+		now:         time.Now,
+	}
+	if t.threshold <= 0 {
+		t.threshold = DefaultFailureThreshold
+	}
+	if t.openTimeout <= 0 {
+		t.openTimeout = DefaultOpenTimeout
+	}
+	return t
+}
+
+func (t *CircuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if req.Context().Err() != nil {
+		// canceled by caller, says nothing about remote host health
+		t.release()
+		return res, err
+	}
+	t.record(err == nil && res.StatusCode < http.StatusInternalServerError)
+	return res, err
+}
+
+func (t *CircuitBreakerTransport) allow() bool {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	switch t.state {
+	case stateOpen:
+		if t.now().Sub(t.openedAt) < t.openTimeout {
+			return false
+		}
+		// let a single trial request through
+		t.state = stateHalfOpen
+		return true
+	case stateHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (t *CircuitBreakerTransport) record(success bool) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if success {
+		t.state = stateClosed
+		t.failures = 0
+		return
+	}
+
+	t.failures++
+	if t.state == stateHalfOpen || t.failures >= t.threshold {
+		t.state = stateOpen
+		t.openedAt = t.now()
+	}
+}
+
+// release returns trial slot of half-open circuit without changing its health.
+func (t *CircuitBreakerTransport) release() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.state == stateHalfOpen {
+		t.state = stateOpen
+	}
+}
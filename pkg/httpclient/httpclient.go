@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"myoidc/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	DefaultTimeout         = 15 * time.Second
+	DefaultConnectTimeout  = 5 * time.Second
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// ProxyDirect disables proxy including the one from environment variables.
+const ProxyDirect = "direct"
+
+// Config of outbound http client. Zero values fall back to defaults.
+type Config struct {
+	// Timeout limits the whole request including retries and reading the body.
+	Timeout time.Duration
+	// ConnectTimeout limits dialing and TLS handshake.
+	ConnectTimeout time.Duration
+
+	// Proxy is a proxy url, empty value uses HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment, ProxyDirect disables proxy.
+	Proxy string
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+
+	// CABundles are PEM files with certificates trusted in addition to the system pool.
+	CABundles []string
+	// InsecureSkipVerify disables server certificate verification, use CABundles instead whenever possible.
+	InsecureSkipVerify bool
+
+	Retry          RetryConfig
+	CircuitBreaker CircuitBreakerConfig
+}
+
+// New builds http client: transport <- retries <- circuit breaker.
+func New(cfg Config) (*http.Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var rt http.RoundTripper = transport
+	rt = NewRetryTransport(rt, cfg.Retry)
+	if !cfg.CircuitBreaker.Disabled {
+		rt = NewCircuitBreakerTransport(rt, cfg.CircuitBreaker)
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   timeout,
+	}, nil
+}
+
+func newTransport(cfg Config) (*http.Transport, error) {
+	connectTimeout := cfg.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	idleConnTimeout := cfg.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = DefaultIdleConnTimeout
+	}
+
+	proxy, err := proxyFunc(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+	}, nil
+}
+
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case ProxyDirect:
+		return nil, nil
+	default:
+		proxyUrl, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy url \"%s\"", proxy)
+		}
+		return http.ProxyURL(proxyUrl), nil
+	}
+}
+
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if len(cfg.CABundles) == 0 {
+		return conf, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range cfg.CABundles {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read ca bundle \"%s\"", file)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in ca bundle \"%s\"", file)
+		}
+	}
+	conf.RootCAs = pool
+	return conf, nil
+}
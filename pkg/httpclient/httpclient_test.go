@@ -0,0 +1,112 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		statuses         []int
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{name: "success", method: http.MethodGet, statuses: []int{200}, expectedStatus: 200, expectedAttempts: 1},
+		{name: "recovered", method: http.MethodGet, statuses: []int{503, 502, 200}, expectedStatus: 200, expectedAttempts: 3},
+		{name: "exhausted", method: http.MethodGet, statuses: []int{503, 503, 503, 200}, expectedStatus: 503, expectedAttempts: 3},
+		{name: "not retryable status", method: http.MethodGet, statuses: []int{500, 200}, expectedStatus: 500, expectedAttempts: 1},
+		{name: "not idempotent method", method: http.MethodPost, statuses: []int{503, 200}, expectedStatus: 503, expectedAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(tt.statuses[n-1])
+		}))
+
+		rt := NewRetryTransport(http.DefaultTransport, RetryConfig{MaxAttempts: 3})
+		rt.sleep = func(req *http.Request, d time.Duration) error {
+			assert.LessOrEqual(t, d, DefaultMaxBackoff, tt.name)
+			return nil
+		}
+		req, _ := http.NewRequest(tt.method, server.URL, strings.NewReader(""))
+		if tt.method == http.MethodGet {
+			req.Body, req.GetBody = http.NoBody, nil
+		}
+		res, err := (&http.Client{Transport: rt}).Do(req)
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, tt.expectedStatus, res.StatusCode, tt.name)
+			res.Body.Close()
+		}
+		assert.Equal(t, tt.expectedAttempts, atomic.LoadInt32(&attempts), tt.name)
+
+		server.Close()
+	}
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var status int32 = 500
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	rt := NewCircuitBreakerTransport(http.DefaultTransport, CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute})
+	rt.now = func() time.Time { return now }
+	client := &http.Client{Transport: rt}
+	get := func() error {
+		res, err := client.Get(server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	assert.NoError(t, get(), "first failure")
+	assert.NoError(t, get(), "second failure opens circuit")
+	assert.True(t, errors.Is(get(), ErrCircuitOpen), "open circuit fails fast")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "remote host is not called while open")
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, get(), "trial request fails")
+	assert.True(t, errors.Is(get(), ErrCircuitOpen), "circuit is open again")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&status, 200)
+	assert.NoError(t, get(), "trial request succeeds")
+	assert.NoError(t, get(), "circuit is closed")
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+}
+
+func TestNew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client, err := New(Config{Timeout: 50 * time.Millisecond, Retry: RetryConfig{MaxAttempts: 1}})
+	if assert.NoError(t, err) {
+		_, err = client.Get(server.URL)
+		assert.Error(t, err, "timeout")
+	}
+
+	_, err = New(Config{CABundles: []string{"not_exists.pem"}})
+	assert.Error(t, err, "missing ca bundle")
+
+	_, err = New(Config{Proxy: "://invalid"})
+	assert.Error(t, err, "invalid proxy")
+}
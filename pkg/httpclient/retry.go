@@ -0,0 +1,144 @@
+package httpclient
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 2 * time.Second
+)
+
+type RetryConfig struct {
+	// MaxAttempts including the first one, 1 disables retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// RetryTransport retries safe and idempotent requests on network errors and
+// 429, 502, 503, 504 responses with exponential backoff and full jitter.
+// Requests like token exchange (POST) are never retried: authorization code is single use.
+type RetryTransport struct {
+	next           http.RoundTripper
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	sleep func(req *http.Request, d time.Duration) error
+}
+
+func NewRetryTransport(next http.RoundTripper, cfg RetryConfig) *RetryTransport {
+	t := &RetryTransport{
+		next:           next,
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+		sleep:          sleepContext,
+	}
+	if t.maxAttempts <= 0 {
+		t.maxAttempts = DefaultMaxAttempts
+	}
+	if t.initialBackoff <= 0 {
+		t.initialBackoff = DefaultInitialBackoff
+	}
+	if t.maxBackoff <= 0 {
+		t.maxBackoff = DefaultMaxBackoff
+	}
+	return t
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !retryable(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		res, err := t.next.RoundTrip(r)
+		if attempt >= t.maxAttempts || !shouldRetry(res, err) || req.Context().Err() != nil {
+			return res, err
+		}
+
+		delay := t.backoff(attempt)
+		if res != nil {
+			if retryAfter, ok := parseRetryAfter(res); ok && retryAfter <= t.maxBackoff {
+				delay = retryAfter
+			}
+			// drain to reuse the connection
+			_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+			res.Body.Close()
+		}
+		if err := t.sleep(req, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	d := t.initialBackoff << (attempt - 1)
+	if d <= 0 || d > t.maxBackoff {
+		d = t.maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	default:
+		return false
+	}
+}
+
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func parseRetryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return time.Until(at), true
+	}
+	return 0, false
+}
+
+func sleepContext(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+// Package keyring seals small payloads with AES-GCM and signs values with HMAC-SHA256
+// using a set of rotating keys.
+//
+// Sealed token format is "<key id>.<base64url(nonce|ciphertext)>", so tokens sealed
+// by a retired key are still opened while the key is kept in the ring.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"myoidc/pkg/errors"
+	"strings"
+)
+
+var ErrInvalidToken = errors.Error("sealed token is invalid")
+
+// Key is an AES key, secret must be 16, 24 or 32 bytes long.
+type Key struct {
+	Id     string
+	Secret []byte
+}
+
+// ParseKey builds a key from a base64 (std or url) encoded secret.
+func ParseKey(id string, secret string) (Key, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		b, err := enc.DecodeString(secret)
+		if err == nil {
+			return Key{Id: id, Secret: b}, nil
+		}
+	}
+	return Key{}, errors.Errorf("key \"%s\" secret is not base64 encoded", id)
+}
+
+// KeyRing encrypts with the active key and decrypts with any known key.
+type KeyRing struct {
+	active string
+	aeads  map[string]cipher.AEAD
+}
+
+// New creates key ring, the active key must be one of keys.
+func New(active string, keys ...Key) (*KeyRing, error) {
+	kr := &KeyRing{
+		active: active,
+		aeads:  make(map[string]cipher.AEAD, len(keys)),
+	}
+	for _, key := range keys {
+		if key.Id == "" || strings.Contains(key.Id, ".") {
+			return nil, errors.Errorf("invalid key id \"%s\"", key.Id)
+		}
+		if _, ok := kr.aeads[key.Id]; ok {
+			return nil, errors.Errorf("duplicate key id \"%s\"", key.Id)
+		}
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key \"%s\"", key.Id)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key \"%s\"", key.Id)
+		}
+		kr.aeads[key.Id] = aead
+	}
+	if _, ok := kr.aeads[active]; !ok {
+		return nil, errors.Errorf("active key \"%s\" not found", active)
+	}
+	return kr, nil
+}
+
+// Seal encrypts plaintext with the active key, additional data is authenticated but not stored.
+func (kr *KeyRing) Seal(plaintext []byte, additionalData []byte) (string, error) {
+	aead := kr.aeads[kr.active]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate nonce")
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, kr.additionalData(kr.active, additionalData))
+	return kr.active + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts token sealed by any key of the ring.
+func (kr *KeyRing) Open(token string, additionalData []byte) ([]byte, error) {
+	kid, payload, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	aead, ok := kr.aeads[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidToken
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, kr.additionalData(kid, additionalData))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return plaintext, nil
+}
+
+// ActiveKey returns id of the key used for sealing.
+func (kr *KeyRing) ActiveKey() string {
+	return kr.active
+}
+
+// additionalData binds ciphertext to the key id, so the token header can't be swapped.
+func (kr *KeyRing) additionalData(kid string, additionalData []byte) []byte {
+	return append([]byte(kid+"."), additionalData...)
+}
@@ -0,0 +1,97 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRing(t *testing.T) {
+	k1 := Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)}
+	k2 := Key{Id: "k2", Secret: bytes.Repeat([]byte{2}, 16)}
+	old, err := New("k1", k1)
+	assert.NoError(t, err)
+	rotated, err := New("k2", k1, k2)
+	assert.NoError(t, err)
+
+	token, err := old.Seal([]byte("payload"), []byte("session"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "k1."), "key id is missing")
+
+	plaintext, err := rotated.Open(token, []byte("session"))
+	if assert.NoError(t, err, "retired key") {
+		assert.Equal(t, "payload", string(plaintext))
+	}
+
+	token, err = rotated.Seal([]byte("payload"), nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "k2."), "active key is not used")
+	_, err = old.Open(token, nil)
+	assert.True(t, errors.Is(err, ErrInvalidToken), "unknown key")
+
+	tampered := []string{
+		"",
+		"k2",
+		"k1" + token[2:],
+		token[:len(token)-2] + "AA",
+		token + "AA",
+	}
+	for _, tt := range tampered {
+		_, err = rotated.Open(tt, nil)
+		assert.Error(t, err, tt)
+	}
+	_, err = rotated.Open(token, []byte("other"))
+	assert.Error(t, err, "additional data mismatch")
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("k1", Key{Id: "k1", Secret: []byte("short")})
+	assert.Error(t, err, "invalid key size")
+	_, err = New("k2", Key{Id: "k1", Secret: make([]byte, 32)})
+	assert.Error(t, err, "missing active key")
+	_, err = New("k.1", Key{Id: "k.1", Secret: make([]byte, 32)})
+	assert.Error(t, err, "invalid key id")
+
+	key, err := ParseKey("k1", "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	if assert.NoError(t, err) {
+		assert.Equal(t, bytes.Repeat([]byte{1}, 32), key.Secret)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	k1 := Key{Id: "k1", Secret: bytes.Repeat([]byte{1}, 32)}
+	k2 := Key{Id: "k2", Secret: bytes.Repeat([]byte{2}, 32)}
+	old, err := NewSigner("k1", k1)
+	assert.NoError(t, err)
+	rotated, err := NewSigner("k2", k1, k2)
+	assert.NoError(t, err)
+
+	signed := old.Sign("k0.sealed.value")
+	value, err := rotated.Verify(signed)
+	if assert.NoError(t, err, "retired key") {
+		assert.Equal(t, "k0.sealed.value", value)
+	}
+
+	signed = rotated.Sign("value")
+	assert.True(t, strings.HasPrefix(signed, "value.k2."), "active key is not used")
+	tampered := []string{
+		"",
+		"value",
+		"value.k2",
+		"other" + signed[5:],
+		strings.Replace(signed, ".k2.", ".k1.", 1),
+		signed[:len(signed)-2] + "AA",
+	}
+	for _, tt := range tampered {
+		_, err = rotated.Verify(tt)
+		assert.Error(t, err, tt)
+	}
+	_, err = old.Verify(signed)
+	assert.Error(t, err, "unknown key")
+
+	_, err = NewSigner("k1", Key{Id: "k1", Secret: []byte("short")})
+	assert.Error(t, err, "short key")
+}
@@ -0,0 +1,83 @@
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"myoidc/pkg/errors"
+	"strings"
+)
+
+// minSignKeySize is a minimal HMAC-SHA256 key size, shorter keys weaken the signature.
+const minSignKeySize = 32
+
+var ErrInvalidSignature = errors.Error("signature is invalid")
+
+// Signer signs values with HMAC-SHA256 using the active key and verifies with any known key.
+//
+// Signed value format is "<value>.<key id>.<base64url(mac)>", value itself may contain dots.
+type Signer struct {
+	active string
+	keys   map[string][]byte
+}
+
+func NewSigner(active string, keys ...Key) (*Signer, error) {
+	s := &Signer{
+		active: active,
+		keys:   make(map[string][]byte, len(keys)),
+	}
+	for _, key := range keys {
+		if key.Id == "" || strings.Contains(key.Id, ".") {
+			return nil, errors.Errorf("invalid key id \"%s\"", key.Id)
+		}
+		if _, ok := s.keys[key.Id]; ok {
+			return nil, errors.Errorf("duplicate key id \"%s\"", key.Id)
+		}
+		if len(key.Secret) < minSignKeySize {
+			return nil, errors.Errorf("key \"%s\" must be at least %d bytes long", key.Id, minSignKeySize)
+		}
+		s.keys[key.Id] = key.Secret
+	}
+	if _, ok := s.keys[active]; !ok {
+		return nil, errors.Errorf("active key \"%s\" not found", active)
+	}
+	return s, nil
+}
+
+func (s *Signer) Sign(value string) string {
+	return value + "." + s.active + "." + base64.RawURLEncoding.EncodeToString(s.mac(s.active, value))
+}
+
+// Verify checks the signature in constant time and returns the original value.
+func (s *Signer) Verify(signed string) (string, error) {
+	rest, sig, ok := cutLast(signed)
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+	value, kid, ok := cutLast(rest)
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+	if _, ok = s.keys[kid]; !ok {
+		return "", ErrInvalidSignature
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.mac(kid, value)) {
+		return "", ErrInvalidSignature
+	}
+	return value, nil
+}
+
+func (s *Signer) mac(kid string, value string) []byte {
+	h := hmac.New(sha256.New, s.keys[kid])
+	h.Write([]byte(kid + "." + value))
+	return h.Sum(nil)
+}
+
+func cutLast(s string) (string, string, bool) {
+	i := strings.LastIndexByte(s, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	return s[:i], s[i+1:], true
+}